@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const keystorePasswordEnv = "AUTOWITHDRAW_KEYSTORE_PASSWORD"
+
+var ErrNoAccounts = errors.New("no usable accounts loaded")
+
+type Accounts map[common.Address]*ecdsa.PrivateKey
+
+// AccountStore guards the account set shared by every chain so it can be
+// swapped while they're scanning.
+type AccountStore struct {
+	mu       sync.RWMutex
+	accounts Accounts
+}
+
+func NewAccountStore(accounts Accounts) *AccountStore {
+	store := &AccountStore{}
+	store.Set(accounts)
+	return store
+}
+
+func (s *AccountStore) Lookup(address common.Address) (*ecdsa.PrivateKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	privateKey, ok := s.accounts[address]
+	return privateKey, ok
+}
+
+// Addresses returns a snapshot of the stored addresses.
+func (s *AccountStore) Addresses() []common.Address {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addresses := make([]common.Address, 0, len(s.accounts))
+	for address := range s.accounts {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// Set replaces the stored accounts with a copy of accounts.
+func (s *AccountStore) Set(accounts Accounts) {
+	copied := make(Accounts, len(accounts))
+	for address, privateKey := range accounts {
+		copied[address] = privateKey
+	}
+
+	s.mu.Lock()
+	s.accounts = copied
+	s.mu.Unlock()
+}
+
+// LoadAllAccounts merges the private keys in path with the account files,
+// keystore and mnemonic sources configured in config.
+func LoadAllAccounts(config Config, path string) (Accounts, error) {
+	accounts, err := LoadAccounts(path)
+	if err != nil {
+		hasOtherSource := len(config.AccountSources) > 0 || config.KeystoreDir != "" || config.Mnemonic != "" || config.ExternalSignerURL != "" || config.HardwareWallet != ""
+		if !hasOtherSource || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("couldn't read accounts: %w", err)
+		}
+		accounts = make(Accounts)
+	}
+
+	for _, source := range config.AccountSources {
+		sourceAccounts, err := LoadAccountSource(source)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read accounts from %s: %w", source, err)
+		}
+		accounts.merge(sourceAccounts, source)
+		slog.Info("loaded account source", "source", source, "count", len(sourceAccounts))
+	}
+
+	if config.KeystoreDir != "" {
+		passphrase, err := keystorePassphrase(config.KeystorePasswordFile)
+		if err != nil {
+			return nil, err
+		}
+
+		keystoreAccounts, err := LoadKeystore(config.KeystoreDir, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read keystore: %w", err)
+		}
+		accounts.merge(keystoreAccounts, "keystore")
+		slog.Info("loaded keystore accounts", "count", len(keystoreAccounts))
+	}
+
+	if config.Mnemonic != "" {
+		derivedAccounts, err := DeriveAccounts(config.Mnemonic, config.MnemonicPassphrase, config.DerivationPath, max(config.DerivationCount, 1))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't derive accounts from mnemonic: %w", err)
+		}
+		accounts.merge(derivedAccounts, "mnemonic")
+		slog.Info("derived mnemonic accounts", "count", len(derivedAccounts))
+	}
+
+	// The external signer's accounts are listed once it's dialed.
+	if len(accounts) == 0 && config.ExternalSignerURL == "" {
+		return nil, ErrNoAccounts
+	}
+	if config.MaxAccounts > 0 && len(accounts) > config.MaxAccounts {
+		return nil, fmt.Errorf("loaded %d accounts, more than max_accounts %d", len(accounts), config.MaxAccounts)
+	}
+	return accounts, config.ValidateReceivers(accounts)
+}
+
+// merge adds from to a, warning about addresses a already holds.
+func (a Accounts) merge(from Accounts, source string) {
+	for address, privateKey := range from {
+		if _, ok := a[address]; ok {
+			slog.Warn("duplicate account", "address", address, "source", source)
+		}
+		a[address] = privateKey
+	}
+}
+
+// LoadAccountSource reads the private keys in path, or in every file of path
+// when it's a directory. Subdirectories and hidden files are skipped.
+func LoadAccountSource(path string) (Accounts, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return LoadAccounts(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make(Accounts)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		file := filepath.Join(path, entry.Name())
+		fileAccounts, err := LoadAccounts(file)
+		if err != nil {
+			return nil, err
+		}
+		accounts.merge(fileAccounts, file)
+	}
+	return accounts, nil
+}
+
+// LoadAccounts reads one hex private key per line. Blank lines and lines
+// starting with # are ignored, lines that don't parse are logged and skipped.
+func LoadAccounts(path string) (Accounts, error) {
+	accountsFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer accountsFile.Close()
+
+	accountsScanner := bufio.NewScanner(accountsFile)
+	accounts := make(Accounts)
+
+	for line := 1; accountsScanner.Scan(); line++ {
+		text := strings.TrimSpace(accountsScanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(text, "0x"))
+		if err != nil {
+			slog.Warn("couldn't convert hex to ecdsa", "line", line, "err", err)
+			continue
+		}
+		address := crypto.PubkeyToAddress(privateKey.PublicKey)
+		if _, ok := accounts[address]; ok {
+			slog.Warn("duplicate account", "address", address, "line", line)
+		}
+		accounts[address] = privateKey
+	}
+
+	return accounts, accountsScanner.Err()
+}
+
+// LoadKeystore decrypts every key file in dir with passphrase. Files that
+// can't be read or decrypted are logged and skipped.
+func LoadKeystore(dir, passphrase string) (Accounts, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make(Accounts)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		keyJSON, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("couldn't read keystore file", "file", path, "err", err)
+			continue
+		}
+
+		key, err := keystore.DecryptKey(keyJSON, passphrase)
+		if err != nil {
+			slog.Warn("couldn't decrypt keystore file", "file", path, "err", err)
+			continue
+		}
+		accounts[key.Address] = key.PrivateKey
+	}
+
+	return accounts, nil
+}
+
+// keystorePassphrase reads the passphrase from file, or from the
+// AUTOWITHDRAW_KEYSTORE_PASSWORD env var when no file is set.
+func keystorePassphrase(file string) (string, error) {
+	if file == "" {
+		return os.Getenv(keystorePasswordEnv), nil
+	}
+
+	passphrase, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read keystore password file: %w", err)
+	}
+	return strings.TrimRight(string(passphrase), "\r\n"), nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	testKeyAddress = common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23")
+	// testMnemonicKey is the first account of testMnemonic.
+	testMnemonicKey     = "1ab42cc412b618bdea3a599e3c9bae199ebf030895b039e9db1e30dafb12b727"
+	testMnemonicAddress = common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+)
+
+func TestLoadKeystore(t *testing.T) {
+	dir := t.TempDir()
+	address := writeKeystoreFile(t, dir, "secret")
+	writeKeystoreFile(t, dir, "other secret")
+	// Hidden files and directories aren't key files.
+	if err := os.WriteFile(filepath.Join(dir, ".DS_Store"), []byte("junk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "backup"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key with another passphrase is skipped.
+	accounts, err := LoadKeystore(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 {
+		t.Fatalf("loaded %d accounts, want 1", len(accounts))
+	}
+	if _, ok := accounts[address]; !ok {
+		t.Fatalf("accounts = %v, want %s", accounts, address)
+	}
+}
+
+func TestKeystorePassphrase(t *testing.T) {
+	t.Setenv(keystorePasswordEnv, "from env")
+	if passphrase, err := keystorePassphrase(""); err != nil || passphrase != "from env" {
+		t.Fatalf("keystorePassphrase() = %q, %v, want the env var", passphrase, err)
+	}
+
+	// A trailing newline of the file isn't part of the passphrase.
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if passphrase, err := keystorePassphrase(file); err != nil || passphrase != "from file" {
+		t.Fatalf("keystorePassphrase() = %q, %v, want the file's", passphrase, err)
+	}
+
+	if _, err := keystorePassphrase(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("keystorePassphrase() of a missing file succeeded")
+	}
+}
+
+// writeAccounts writes an accounts file into a temp dir and returns its path.
+func writeAccounts(t *testing.T, accounts string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "accounts.txt")
+	if err := os.WriteFile(path, []byte(accounts), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAccounts(t *testing.T) {
+	path := writeAccounts(t, "# hot wallets\n\n  "+testKey+"  \r\n0x"+testMnemonicKey+"\nnot a key\n")
+
+	accounts, err := LoadAccounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("loaded %d accounts, want 2", len(accounts))
+	}
+	for _, address := range []common.Address{testKeyAddress, testMnemonicAddress} {
+		if _, ok := accounts[address]; !ok {
+			t.Errorf("accounts = %v, want %s", accounts, address)
+		}
+	}
+}
+
+func TestLoadAllAccountsFailsWithoutAccounts(t *testing.T) {
+	for name, accounts := range map[string]string{
+		"empty":        "",
+		"only comment": "# nothing here yet\n",
+		"only garbage": "0xnotakey\n",
+	} {
+		if _, err := LoadAllAccounts(Config{}, writeAccounts(t, accounts)); !errors.Is(err, ErrNoAccounts) {
+			t.Errorf("%s: LoadAllAccounts() = %v, want %v", name, err, ErrNoAccounts)
+		}
+	}
+}
+
+func TestLoadAllAccountsWithoutAccountsFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "accounts.txt")
+
+	// The file may only be missing when another source has accounts.
+	if _, err := LoadAllAccounts(Config{}, missing); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadAllAccounts() = %v, want %v", err, os.ErrNotExist)
+	}
+	accounts, err := LoadAllAccounts(Config{Mnemonic: testMnemonic, DerivationCount: 1}, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := accounts[testMnemonicAddress]; !ok {
+		t.Fatalf("accounts = %v, want %s", accounts, testMnemonicAddress)
+	}
+}
+
+func TestLoadAllAccountsDerivesOneAccountByDefault(t *testing.T) {
+	accounts, err := LoadAllAccounts(Config{Mnemonic: testMnemonic}, filepath.Join(t.TempDir(), "accounts.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := accounts[testMnemonicAddress]; !ok || len(accounts) != 1 {
+		t.Fatalf("accounts = %v, want only %s with derivation_count unset", accounts, testMnemonicAddress)
+	}
+}
+
+func TestAccountStoreCopiesAccounts(t *testing.T) {
+	key, address := newTestKey(t)
+	accounts := Accounts{address: key}
+	store := NewAccountStore(nil)
+	store.Set(accounts)
+
+	// Later changes to the map don't leak into the store.
+	delete(accounts, address)
+	if _, ok := store.Lookup(address); !ok {
+		t.Fatal("Lookup() missed an account deleted from the map Set was given")
+	}
+	if got := store.Addresses(); len(got) != 1 || got[0] != address {
+		t.Fatalf("Addresses() = %v, want [%s]", got, address)
+	}
+}
+
+func TestAccountStoreConcurrentAccess(t *testing.T) {
+	key, address := newTestKey(t)
+	store := NewAccountStore(Accounts{address: key})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				store.Lookup(address)
+				store.Addresses()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				store.Set(Accounts{address: key})
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLoadAccountsWarnsAboutDuplicates(t *testing.T) {
+	logs := captureLogs(t)
+	path := writeAccounts(t, testKey+"\n0x"+testKey+"\n")
+
+	accounts, err := LoadAccounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 {
+		t.Fatalf("loaded %d accounts, want the duplicate once", len(accounts))
+	}
+	if !strings.Contains(logs.String(), "duplicate account") || !strings.Contains(logs.String(), strings.ToLower(testKeyAddress.Hex())) {
+		t.Fatalf("logs = %s, want a duplicate warning", logs)
+	}
+}
+
+func TestLoadAllAccountsMaxAccounts(t *testing.T) {
+	path := writeAccounts(t, testKey+"\n"+testMnemonicKey+"\n")
+
+	if _, err := LoadAllAccounts(Config{MaxAccounts: 1}, path); err == nil || !strings.Contains(err.Error(), "max_accounts") {
+		t.Fatalf("LoadAllAccounts() = %v, want the max_accounts error", err)
+	}
+	if accounts, err := LoadAllAccounts(Config{MaxAccounts: 2}, path); err != nil || len(accounts) != 2 {
+		t.Fatalf("LoadAllAccounts() = %d accounts, %v, want 2", len(accounts), err)
+	}
+}
+
+func TestLoadAllAccountsMergesSources(t *testing.T) {
+	dir := t.TempDir()
+	for name, keys := range map[string]string{
+		"prod.txt":  testKey + "\n",
+		"stage.txt": testKey + "\n" + testMnemonicKey + "\n",
+		".swap":     "not a key\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(keys), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := writeAccounts(t, testKey+"\n")
+	missing := filepath.Join(t.TempDir(), "accounts.txt")
+
+	// The overlapping key is loaded once from the dir and the file.
+	accounts, err := LoadAllAccounts(Config{AccountSources: []string{dir, other}}, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("loaded %d accounts, want 2", len(accounts))
+	}
+	for _, address := range []common.Address{testKeyAddress, testMnemonicAddress} {
+		if _, ok := accounts[address]; !ok {
+			t.Errorf("accounts = %v, want %s", accounts, address)
+		}
+	}
+
+	if _, err := LoadAllAccounts(Config{AccountSources: []string{filepath.Join(dir, "missing")}}, missing); err == nil {
+		t.Fatal("LoadAllAccounts() of a missing source succeeded")
+	}
+}
+
+func TestLoadAllAccountsRejectsControlledReceivers(t *testing.T) {
+	path := writeAccounts(t, testKey+"\n")
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"receiver", Config{Receiver: testKeyAddress}},
+		{"account receiver", Config{Receivers: map[common.Address]common.Address{testMnemonicAddress: testKeyAddress}}},
+		{"chain receiver", Config{Chains: []ChainConfig{{Name: "mainnet", Receiver: &testKeyAddress}}}},
+	}
+	for _, test := range tests {
+		if _, err := LoadAllAccounts(test.config, path); err == nil || !strings.Contains(err.Error(), "controlled account") {
+			t.Errorf("%s: LoadAllAccounts() = %v, want a controlled receiver error", test.name, err)
+		}
+	}
+}
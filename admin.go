@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Admin serves operator actions against the currently connected chains.
+type Admin struct {
+	token    string
+	observed *ObserveList
+	stats    *Stats
+
+	mu     sync.Mutex
+	chains map[string]*Chain
+}
+
+type sweepResult struct {
+	Chain   string         `json:"chain"`
+	Account common.Address `json:"account"`
+	Error   string         `json:"error,omitempty"`
+}
+
+func NewAdmin(token string, observed *ObserveList, stats *Stats) *Admin {
+	return &Admin{token: token, observed: observed, stats: stats, chains: make(map[string]*Chain)}
+}
+
+// register makes chain the connection used for name, and unregister forgets
+// it once it's gone. Both are no-ops on a nil *Admin.
+func (a *Admin) register(name string, chain *Chain) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.chains[name] = chain
+}
+
+func (a *Admin) unregister(name string) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.chains, name)
+}
+
+func (a *Admin) connected(name string) map[string]*Chain {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	chains := make(map[string]*Chain, len(a.chains))
+	for chainName, chain := range a.chains {
+		if name == "" || chainName == name {
+			chains[chainName] = chain
+		}
+	}
+	return chains
+}
+
+func (a *Admin) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// handleSweep sweeps the balance of the account query parameter, or of every
+// account when it's unset, on the chain query parameter or every connected
+// chain.
+func (a *Admin) handleSweep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var account *common.Address
+	if param := r.URL.Query().Get("account"); param != "" {
+		if !common.IsHexAddress(param) {
+			http.Error(w, "invalid account", http.StatusBadRequest)
+			return
+		}
+		address := common.HexToAddress(param)
+		// Observed accounts are read-only, sweeping them takes a /promote.
+		if a.observed.contains(address) {
+			http.Error(w, "account is observed", http.StatusConflict)
+			return
+		}
+		account = &address
+	}
+
+	chains := a.connected(r.URL.Query().Get("chain"))
+	if len(chains) == 0 {
+		http.Error(w, "no connected chain", http.StatusServiceUnavailable)
+		return
+	}
+
+	results := []sweepResult{}
+	for name, chain := range chains {
+		accounts := chain.addresses()
+		if account != nil {
+			if _, ok := chain.sweepKeyFor(*account); !ok {
+				http.Error(w, "unknown account", http.StatusNotFound)
+				return
+			}
+			accounts = []common.Address{*account}
+		}
+
+		for _, address := range accounts {
+			result := sweepResult{Chain: name, Account: address}
+			if _, err := chain.sweepNative(r.Context(), address); err != nil {
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Chain < results[j].Chain })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// handlePromote takes the observed account query parameter off the observe
+// list, once a key for it is loaded, so it's defended from then on.
+func (a *Admin) handlePromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	param := r.URL.Query().Get("account")
+	if !common.IsHexAddress(param) {
+		http.Error(w, "invalid account", http.StatusBadRequest)
+		return
+	}
+	account := common.HexToAddress(param)
+	if !a.observed.contains(account) {
+		http.Error(w, "account not observed", http.StatusNotFound)
+		return
+	}
+
+	chains := a.connected("")
+	if len(chains) == 0 {
+		http.Error(w, "no connected chain", http.StatusServiceUnavailable)
+		return
+	}
+	for _, chain := range chains {
+		if _, ok := chain.accountFor(account); !ok {
+			http.Error(w, "no key loaded for account", http.StatusConflict)
+			return
+		}
+	}
+
+	a.observed.promote(account)
+	slog.Info("promoted observed account", "account", account)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStats serves what confirmed sweeps rescued so far, by chain and
+// account.
+func (a *Admin) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	a.stats.ServeHTTP(w, r)
+}
+
+// ServeAdmin exposes admin on addr until ctx is cancelled.
+func ServeAdmin(ctx context.Context, addr string, admin *Admin) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sweep", admin.handleSweep)
+	mux.HandleFunc("/promote", admin.handlePromote)
+	mux.HandleFunc("/stats", admin.handleStats)
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("serving admin", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("admin server failed", "err", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const testAdminToken = "secret"
+
+// adminRequest runs handler with a request for target, sent with token when
+// it's set, and returns the response.
+func adminRequest(handler http.HandlerFunc, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestAdminSweepSendsSweeps(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{}, key)
+	admin := NewAdmin(testAdminToken, nil, nil)
+	admin.register("test", chain)
+
+	w := adminRequest(admin.handleSweep, http.MethodPost, "/sweep?account="+account.Hex(), testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /sweep = %d %s, want 200", w.Code, w.Body)
+	}
+	var results []sweepResult
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Account != account || results[0].Chain != "test" || results[0].Error != "" {
+		t.Fatalf("results = %+v, want a sweep of %s on test", results, account)
+	}
+
+	sent := backend.sentTxs()
+	if len(sent) != 1 || *sent[0].To() != testReceiverAddress {
+		t.Fatalf("sent %d txs, want a sweep to the receiver", len(sent))
+	}
+}
+
+func TestAdminSweepErrors(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, _ := newRecordingChain(t, Options{}, key)
+	admin := NewAdmin(testAdminToken, nil, nil)
+
+	if w := adminRequest(admin.handleSweep, http.MethodPost, "/sweep", testAdminToken); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("POST /sweep without chains = %d, want 503", w.Code)
+	}
+	admin.register("test", chain)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		want   int
+	}{
+		{"GET", http.MethodGet, "/sweep", testAdminToken, http.StatusMethodNotAllowed},
+		{"no token", http.MethodPost, "/sweep", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "/sweep", "guess", http.StatusUnauthorized},
+		{"invalid account", http.MethodPost, "/sweep?account=0x12", testAdminToken, http.StatusBadRequest},
+		{"unknown account", http.MethodPost, "/sweep?account=" + testAttacker.Hex(), testAdminToken, http.StatusNotFound},
+		{"unknown chain", http.MethodPost, "/sweep?chain=other", testAdminToken, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		if w := adminRequest(admin.handleSweep, test.method, test.target, test.token); w.Code != test.want {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
+
+func TestObserveThenPromote(t *testing.T) {
+	key, account := newTestKey(t)
+	observed := NewObserveList([]common.Address{account, testAttacker})
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, Observed: observed}, key)
+	admin := NewAdmin(testAdminToken, observed, nil)
+	admin.register("test", chain)
+	ctx := context.Background()
+
+	// Observed accounts are only logged, not defended or swept.
+	orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+	chain.replacePending(ctx, orig, time.Now())
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs for an observed account, want none", len(sent))
+	}
+	if w := adminRequest(admin.handleSweep, http.MethodPost, "/sweep?account="+account.Hex(), testAdminToken); w.Code != http.StatusConflict {
+		t.Fatalf("POST /sweep of an observed account = %d, want 409", w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"invalid account", "/promote?account=0x12", http.StatusBadRequest},
+		{"not observed", "/promote?account=" + testReceiverAddress.Hex(), http.StatusNotFound},
+		{"no key loaded", "/promote?account=" + testAttacker.Hex(), http.StatusConflict},
+		{"promoted", "/promote?account=" + account.Hex(), http.StatusNoContent},
+		{"promoted twice", "/promote?account=" + account.Hex(), http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := adminRequest(admin.handlePromote, http.MethodPost, test.target, testAdminToken); w.Code != test.want {
+			t.Fatalf("%s: POST %s = %d %s, want %d", test.name, test.target, w.Code, w.Body, test.want)
+		}
+	}
+
+	// Once promoted the account is defended.
+	chain.replacePending(ctx, orig, time.Now())
+	if sent := backend.sentTxs(); len(sent) != 1 {
+		t.Fatalf("sent %d txs after promoting, want the replacement", len(sent))
+	}
+	if !observed.contains(testAttacker) {
+		t.Fatal("promoting one account dropped another")
+	}
+}
+
+func TestObserveListNilObservesNothing(t *testing.T) {
+	var observed *ObserveList
+	if observed.contains(testAttacker) || observed.promote(testAttacker) {
+		t.Fatal("nil ObserveList observes accounts")
+	}
+	observed.Set([]common.Address{testAttacker})
+}
+
+func TestAdminStats(t *testing.T) {
+	admin := NewAdmin(testAdminToken, nil, NewStats())
+	if w := adminRequest(admin.handleStats, http.MethodGet, "/stats", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /stats without token = %d, want 401", w.Code)
+	}
+	if w := adminRequest(admin.handleStats, http.MethodGet, "/stats", testAdminToken); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /stats = %d %s, want JSON", w.Code, w.Header().Get("Content-Type"))
+	}
+}
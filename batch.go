@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// batchWindow is how long pending hashes are collected before they're
+	// looked up together.
+	batchWindow  = 20 * time.Millisecond
+	maxBatchSize = 50
+
+	// invalidRequestCode is what some endpoints without batch support
+	// answer a batch with.
+	invalidRequestCode = -32600
+)
+
+// BatchCaller sends several JSON-RPC calls in one round-trip, *rpc.Client
+// implements it.
+type BatchCaller interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+}
+
+// batching reports whether pending tx lookups should be batched.
+func (c *Chain) batching() bool {
+	return c.batch != nil && !c.batchUnsupported.Load()
+}
+
+// transactionsByHash looks hashes up in a single batch call. errs holds the
+// error of each lookup, a tx that isn't known fails with ethereum.NotFound.
+// When the endpoint rejects the batch, batching is turned off and the hashes
+// are looked up one by one, any other failure of the call is the error of
+// every lookup.
+func (c *Chain) transactionsByHash(ctx context.Context, hashes []common.Hash) (txs []*types.Transaction, errs []error) {
+	txs, errs = make([]*types.Transaction, len(hashes)), make([]error, len(hashes))
+	if !c.batching() {
+		for i, hash := range hashes {
+			txs[i], errs[i] = c.transactionByHash(ctx, hash)
+		}
+		return txs, errs
+	}
+
+	if c.limiter != nil && !c.limiter.Allow() {
+		for i := range errs {
+			errs[i] = errRateLimited
+		}
+		return txs, errs
+	}
+
+	batch := make([]rpc.BatchElem, len(hashes))
+	for i, hash := range hashes {
+		batch[i] = rpc.BatchElem{Method: "eth_getTransactionByHash", Args: []any{hash}, Result: &txs[i]}
+	}
+
+	batchCtx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	err := c.batch.BatchCallContext(batchCtx, batch)
+	cancel()
+	if err != nil && batchRejected(err) {
+		if ok, dropped := c.sampler.allow("batch lookup"); ok {
+			c.log.Warn("couldn't batch tx lookups, looking them up one by one", "err", err, "dropped_logs", dropped)
+		}
+		c.batchUnsupported.Store(true)
+		return c.transactionsByHash(ctx, hashes)
+	}
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return txs, errs
+	}
+
+	for i, elem := range batch {
+		switch {
+		case elem.Error != nil:
+			errs[i] = elem.Error
+		case txs[i] == nil:
+			errs[i] = ethereum.NotFound
+		}
+	}
+	return txs, errs
+}
+
+// batchRejected reports whether err is the endpoint refusing batch calls, as
+// opposed to the call failing on the way.
+func batchRejected(err error) bool {
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.ErrorCode() {
+	case invalidRequestCode, methodNotFoundCode:
+		return true
+	}
+	return strings.Contains(strings.ToLower(rpcErr.Error()), "batch")
+}
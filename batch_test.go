@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testBatcher answers tx lookup batches from txs, or fails them with err.
+type testBatcher struct {
+	err     error
+	txs     map[common.Hash]*types.Transaction
+	mu      sync.Mutex
+	batches [][]rpc.BatchElem
+}
+
+func (b *testBatcher) BatchCallContext(ctx context.Context, batch []rpc.BatchElem) error {
+	b.mu.Lock()
+	b.batches = append(b.batches, batch)
+	b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+
+	for _, elem := range batch {
+		if tx, ok := b.txs[elem.Args[0].(common.Hash)]; ok {
+			*elem.Result.(**types.Transaction) = tx
+		}
+	}
+	return nil
+}
+
+func (b *testBatcher) batchSizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sizes := make([]int, len(b.batches))
+	for i, batch := range b.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+// newBatchTestChain returns a chain looking txs up through batcher, and
+// one by one through the returned backend.
+func newBatchTestChain(t *testing.T, batcher *testBatcher) (*Chain, *lookupBackend) {
+	t.Helper()
+
+	sim, _ := newSimulatedBackend(t)
+	backend := newLookupBackend(sim)
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, NewAccountStore(nil), Options{Workers: 1})
+	chain.batch = batcher
+	return chain, backend
+}
+
+func TestTransactionsByHashBatches(t *testing.T) {
+	known := newLegacyTx(0, 1, 1)
+	batcher := &testBatcher{txs: map[common.Hash]*types.Transaction{known.Hash(): known}}
+	chain, backend := newBatchTestChain(t, batcher)
+	unknown := common.HexToHash("0x01")
+
+	txs, errs := chain.transactionsByHash(context.Background(), []common.Hash{known.Hash(), unknown})
+	if sizes := batcher.batchSizes(); len(sizes) != 1 || sizes[0] != 2 {
+		t.Fatalf("batch sizes = %v, want both hashes in one batch", sizes)
+	}
+	if errs[0] != nil || txs[0].Hash() != known.Hash() {
+		t.Fatalf("known tx = %v, %v, want it found", txs[0], errs[0])
+	}
+	if !errors.Is(errs[1], ethereum.NotFound) {
+		t.Fatalf("unknown tx error = %v, want %v", errs[1], ethereum.NotFound)
+	}
+	if n := backend.lookupCount(unknown); n != 0 {
+		t.Fatalf("looked up %d times one by one, want none", n)
+	}
+}
+
+func TestTransactionsByHashFallsBackWhenBatchesRejected(t *testing.T) {
+	batcher := &testBatcher{err: testRPCError{code: methodNotFoundCode, msg: "the method does not exist"}}
+	chain, backend := newBatchTestChain(t, batcher)
+	hash := common.HexToHash("0x01")
+
+	_, errs := chain.transactionsByHash(context.Background(), []common.Hash{hash})
+	if !errors.Is(errs[0], ethereum.NotFound) {
+		t.Fatalf("lookup error = %v, want %v from the single lookup", errs[0], ethereum.NotFound)
+	}
+	if n := backend.lookupCount(hash); n != 1 {
+		t.Fatalf("looked up %d times one by one, want 1", n)
+	}
+	if chain.batching() {
+		t.Fatal("batching still on after the endpoint rejected it")
+	}
+}
+
+func TestTransactionsByHashKeepsBatchingOnOtherErrors(t *testing.T) {
+	failure := errors.New("connection reset")
+	chain, backend := newBatchTestChain(t, &testBatcher{err: failure})
+	hash := common.HexToHash("0x01")
+
+	_, errs := chain.transactionsByHash(context.Background(), []common.Hash{hash})
+	if !errors.Is(errs[0], failure) {
+		t.Fatalf("lookup error = %v, want %v", errs[0], failure)
+	}
+	if n := backend.lookupCount(hash); n != 0 {
+		t.Fatalf("looked up %d times one by one, want none", n)
+	}
+	if !chain.batching() {
+		t.Fatal("batching turned off by a failed call")
+	}
+}
+
+func TestBatchRejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{testRPCError{code: invalidRequestCode, msg: "invalid request"}, true},
+		{testRPCError{code: methodNotFoundCode, msg: "method not found"}, true},
+		{testRPCError{code: -32000, msg: "batch requests are disabled"}, true},
+		{testRPCError{code: -32000, msg: "execution timeout"}, false},
+		{errors.New("batch failed: connection reset"), false},
+	}
+	for _, test := range tests {
+		if got := batchRejected(test.err); got != test.want {
+			t.Errorf("batchRejected(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestWatchPendingBatchesHashes(t *testing.T) {
+	batcher := &testBatcher{}
+	chain, _ := newBatchTestChain(t, batcher)
+	txChan := startWatchPending(t, chain)
+
+	for i := byte(1); i <= 3; i++ {
+		txChan <- common.Hash{i}
+	}
+	waitFor(t, func() bool {
+		total := 0
+		for _, size := range batcher.batchSizes() {
+			total += size
+		}
+		return total >= 3
+	})
+	if sizes := batcher.batchSizes(); sizes[0] < 2 {
+		t.Fatalf("batch sizes = %v, want hashes announced together in one batch", sizes)
+	}
+}
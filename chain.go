@@ -0,0 +1,1374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+
+	methodNotFoundCode = -32601
+
+	defaultRPCTimeout = 5 * time.Second
+
+	defaultConnectRetries    = 3
+	defaultConnectRetryDelay = time.Second
+
+	// maxSubscribeAttempts is how many times in a row ScanPending tries to
+	// resubscribe before giving the endpoint up.
+	maxSubscribeAttempts = 5
+
+	// blobTxType is EIP-4844's tx type, which this go-ethereum version can't
+	// decode yet, lookups of blob txs fail with types.ErrTxTypeNotSupported.
+	blobTxType = 3
+
+	// defaultGasMultiplier pads gas estimates of replacements calling
+	// contracts, whose gas use may change by the time they're mined.
+	defaultGasMultiplier = 1.2
+
+	defaultSeenCacheSize = 10000
+	defaultWorkers       = 4
+
+	// A pending hash may be announced before the tx reaches the node it's
+	// looked up on.
+	defaultNotFoundRetries    = 3
+	defaultNotFoundRetryDelay = 50 * time.Millisecond
+	// notFoundQueueSize bounds the batches waiting to be looked up again.
+	notFoundQueueSize = 64
+)
+
+type PendingSource interface {
+	SubscribePendingTransactions(ctx context.Context, ch chan<- common.Hash) (ethereum.Subscription, error)
+}
+
+type TxFetcher interface {
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+}
+
+type TxSender interface {
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// EthClient is what a Chain needs from its node once connected. Connect
+// reads the chain ID up front, so it isn't required here and in-process
+// backends such as backends.SimulatedBackend satisfy it as is.
+type EthClient interface {
+	TxFetcher
+	TxSender
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// gethPendingSource adapts gethclient to PendingSource, since it returns a
+// concrete *rpc.ClientSubscription.
+type gethPendingSource struct {
+	client *gethclient.Client
+}
+
+func (g gethPendingSource) SubscribePendingTransactions(ctx context.Context, ch chan<- common.Hash) (ethereum.Subscription, error) {
+	sub, err := g.client.SubscribePendingTransactions(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Options holds the tunables a Chain reads while scanning.
+type Options struct {
+	DryRun    bool
+	MinSweep  *big.Int
+	MinValue  *big.Int
+	Whitelist map[common.Address]bool
+	// ActiveAccounts limits which accounts' pending txs are replaced, all
+	// of them are when it's empty.
+	ActiveAccounts map[common.Address]bool
+	// BlacklistTokens and BlacklistDestinations are never interacted with.
+	BlacklistTokens       map[common.Address]bool
+	BlacklistDestinations map[common.Address]bool
+	BumpPercent           uint64
+	MaxGasPrice           *big.Int
+	// MinGasPrice and MinTip are the floors replacement fees are raised to.
+	MinGasPrice *big.Int
+	MinTip      *big.Int
+	Receivers   map[common.Address]common.Address
+	// SplitReceivers splits balance sweeps of accounts without an entry in
+	// Receivers, replacements still go to the chain's receiver.
+	SplitReceivers []WeightedReceiver
+	// BroadcastAll sends replacements to every endpoint of the chain, not
+	// just the connected one.
+	BroadcastAll bool
+	// CancelMode cancels pending txs with a zero-value self-send instead of
+	// redirecting them to the receiver.
+	CancelMode bool
+	// ZeroValueCalls is what's done with pending calls moving no value,
+	// they're handled like any other tx when it's empty.
+	ZeroValueCalls string
+	// Rescues are the token calls replaced by a rescue.
+	Rescues rescueSet
+	// ReceiverData is sent along with native value to receivers.
+	ReceiverData []byte
+	// SweepFullBalance makes native replacements send the account's whole
+	// balance minus fees and GasReserve instead of the original's value.
+	SweepFullBalance bool
+	GasReserve       *big.Int
+
+	SweepTokens        []common.Address
+	TokenSweepInterval time.Duration
+	PollInterval       time.Duration
+
+	Metrics *Metrics
+	// Observed are the accounts only logged, never acted on.
+	Observed *ObserveList
+	// Events receives every replacement decision.
+	Events *EventStream
+	Health *Health
+	// Stats tallies what confirmed sweeps rescued.
+	Stats *Stats
+	State *StateStore
+	Admin *Admin
+	// Notifiers are alerted about sweeps, failed replacements and lost
+	// subscriptions.
+	Notifiers Notifiers
+	Relay     PrivateSender
+	// ExternalSigner signs for accounts whose keys aren't loaded locally.
+	ExternalSigner *ExternalSigner
+	// HardwareSigner signs balance sweeps of the accounts on a hardware
+	// wallet, pending txs from them aren't replaced.
+	HardwareSigner *HardwareSigner
+
+	RebumpBlocks uint64
+	// GasLimitOverride replaces estimating each replacement's gas.
+	GasLimitOverride uint64
+	GasMultiplier    float64
+	// ConfirmBlocks is how long replacements are watched for being mined.
+	// 0 disables the watcher.
+	ConfirmBlocks      uint64
+	RPCTimeout         time.Duration
+	SimulateBeforeSend bool
+	// CompetitiveGas raises replacement fees to CompetitivePercentile of
+	// recently seen pending fees.
+	CompetitiveGas        bool
+	CompetitivePercentile float64
+	// Proxy routes RPC connections when set.
+	Proxy *url.URL
+
+	// LogSampleRate logs only one in this many routine per-tx errors.
+	LogSampleRate int
+
+	// ChainName names the chain in metrics, alerts, events, stats and the
+	// state file. The chain ID is used when it's empty.
+	ChainName string
+
+	// ExpectedChainID makes Connect refuse endpoints of other chains.
+	ExpectedChainID *big.Int
+
+	// CooldownAfter failed replacements in a row suppress an account's
+	// replacements for Cooldown, doubled with every further failure.
+	CooldownAfter int
+	Cooldown      time.Duration
+
+	ConnectRetries    int
+	ConnectRetryDelay time.Duration
+	// RPCRate limits tx lookups and sends to this many per second on each
+	// endpoint, with bursts of up to RPCBurst. 0 disables it.
+	RPCRate  float64
+	RPCBurst int
+	// StallTimeout resubscribes when no pending tx arrived for this long.
+	// 0 disables it.
+	StallTimeout time.Duration
+
+	SeenCacheSize int
+	Workers       int
+	// NotFoundRetries is how often a pending hash the node doesn't know yet
+	// is looked up again, NotFoundRetryDelay apart and doubling.
+	NotFoundRetries    int
+	NotFoundRetryDelay time.Duration
+}
+
+func (o Options) notFoundRetries() int {
+	if o.NotFoundRetries <= 0 {
+		return defaultNotFoundRetries
+	}
+	return o.NotFoundRetries
+}
+
+func (o Options) notFoundRetryDelay() time.Duration {
+	if o.NotFoundRetryDelay <= 0 {
+		return defaultNotFoundRetryDelay
+	}
+	return o.NotFoundRetryDelay
+}
+
+func (o Options) workers() int {
+	if o.Workers <= 0 {
+		return defaultWorkers
+	}
+	return o.Workers
+}
+
+func (o Options) chainName(chainID *big.Int) string {
+	if o.ChainName == "" {
+		return chainID.String()
+	}
+	return o.ChainName
+}
+
+func (o Options) seenCacheSize() int {
+	if o.SeenCacheSize <= 0 {
+		return defaultSeenCacheSize
+	}
+	return o.SeenCacheSize
+}
+
+func (o Options) connectRetries() int {
+	if o.ConnectRetries <= 0 {
+		return defaultConnectRetries
+	}
+	return o.ConnectRetries
+}
+
+func (o Options) connectRetryDelay() time.Duration {
+	if o.ConnectRetryDelay <= 0 {
+		return defaultConnectRetryDelay
+	}
+	return o.ConnectRetryDelay
+}
+
+// rpcBurst defaults to a second's worth of calls.
+func (o Options) rpcBurst() int {
+	if o.RPCBurst <= 0 {
+		return max(int(o.RPCRate), 1)
+	}
+	return o.RPCBurst
+}
+
+func (o Options) gasMultiplier() float64 {
+	if o.GasMultiplier <= 0 {
+		return defaultGasMultiplier
+	}
+	return o.GasMultiplier
+}
+
+func (o Options) cooldownAfter() int {
+	if o.CooldownAfter <= 0 {
+		return defaultCooldownAfter
+	}
+	return o.CooldownAfter
+}
+
+func (o Options) cooldown() time.Duration {
+	if o.Cooldown <= 0 {
+		return defaultCooldown
+	}
+	return o.Cooldown
+}
+
+func (o Options) competitivePercentile() float64 {
+	if o.CompetitivePercentile <= 0 {
+		return defaultCompetitivePercentile
+	}
+	return o.CompetitivePercentile
+}
+
+func (o Options) fees() feePolicy {
+	return feePolicy{bumpPercent: o.BumpPercent, maxGasPrice: o.MaxGasPrice, minGasPrice: o.MinGasPrice, minTip: o.MinTip}
+}
+
+func (o Options) pollInterval() time.Duration {
+	if o.PollInterval <= 0 {
+		return defaultPollInterval
+	}
+	return o.PollInterval
+}
+
+func (o Options) rpcTimeout() time.Duration {
+	if o.RPCTimeout <= 0 {
+		return defaultRPCTimeout
+	}
+	return o.RPCTimeout
+}
+
+type Chain struct {
+	accounts *AccountStore
+	receiver *common.Address
+	eth      EthClient
+	geth     PendingSource
+	signer   types.Signer
+	opts     Options
+	log      *slog.Logger
+	// name labels this chain's metrics.
+	name     string
+	endpoint string
+	health   *endpointHealth
+	// batch is nil when pending tx lookups can't be batched.
+	batch            BatchCaller
+	batchUnsupported atomic.Bool
+	// peers are the chain's other endpoints, replacements are broadcast to
+	// them too. It's empty unless BroadcastAll is set.
+	peers []TxSender
+	// london is false on chains without EIP-1559, every replacement is a
+	// legacy tx there whatever the original's type.
+	london bool
+	// limiter is nil when RPCRate is unset.
+	limiter  *rate.Limiter
+	heads    *headFanout
+	inflight *inflightTracker
+	// confirmations is nil unless ConfirmBlocks is set.
+	confirmations *confirmationTracker
+	nonces        *nonceTracker
+	failures      *failureTracker
+	dust          *dustTracker
+	sampler       *logSampler
+	feeSamples    *feeSamples
+	// seen holds recently processed pending tx hashes.
+	seen *lruCache[common.Hash, struct{}]
+	// replaced holds the latest replacement sent per (from, nonce), so an
+	// original seen again isn't replaced twice.
+	replaced *lruCache[inflightKey, *types.Transaction]
+	// senders caches recovered senders by tx hash.
+	senders      *lruCache[common.Hash, common.Address]
+	accountLocks *sync.Map
+}
+
+func NewChain(eth EthClient, pending PendingSource, signer types.Signer, receiver common.Address, accounts *AccountStore, opts Options) *Chain {
+	var limiter *rate.Limiter
+	if opts.RPCRate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.RPCRate), opts.rpcBurst())
+	}
+
+	var confirmations *confirmationTracker
+	if opts.ConfirmBlocks > 0 {
+		confirmations = newConfirmationTracker()
+	}
+
+	return &Chain{
+		limiter:       limiter,
+		confirmations: confirmations,
+		eth:           eth,
+		geth:          pending,
+		signer:        signer,
+		accounts:      accounts,
+		receiver:      &receiver,
+		opts:          opts,
+		log:           slog.Default().With("chainID", signer.ChainID()),
+		name:          opts.chainName(signer.ChainID()),
+		london:        true,
+		heads:         newHeadFanout(),
+		inflight:      newInflightTracker(),
+		nonces:        newNonceTracker(),
+		failures:      newFailureTracker(opts.cooldownAfter(), opts.cooldown()),
+		dust:          newDustTracker(),
+		sampler:       newLogSampler(opts.LogSampleRate),
+		feeSamples:    newFeeSamples(),
+		seen:          newLRUCache[common.Hash, struct{}](opts.seenCacheSize()),
+		senders:       newLRUCache[common.Hash, common.Address](opts.seenCacheSize()),
+		replaced:      newLRUCache[inflightKey, *types.Transaction](opts.seenCacheSize()),
+
+		accountLocks: &sync.Map{},
+	}
+}
+
+// carryOver keeps state from an earlier connection to the same chain.
+func (c *Chain) carryOver(prev *Chain) {
+	c.inflight = prev.inflight
+	c.confirmations = prev.confirmations
+	c.nonces = prev.nonces
+	c.failures = prev.failures
+	c.dust = prev.dust
+	c.feeSamples = prev.feeSamples
+	c.seen = prev.seen
+	c.senders = prev.senders
+	c.replaced = prev.replaced
+	c.accountLocks = prev.accountLocks
+}
+
+// accountFor returns the key of address when it's a controlled account, held
+// locally or by the external signer.
+func (c *Chain) accountFor(address common.Address) (accountKey, bool) {
+	if privateKey, ok := c.accounts.Lookup(address); ok {
+		return localKey{key: privateKey}, true
+	}
+	return c.opts.ExternalSigner.key(address)
+}
+
+// sweepKeyFor is accountFor for balance sweeps, which may also be signed by
+// the hardware wallet.
+func (c *Chain) sweepKeyFor(address common.Address) (accountKey, bool) {
+	if key, ok := c.accountFor(address); ok {
+		return key, true
+	}
+	return c.opts.HardwareSigner.key(address)
+}
+
+// addresses returns every account that isn't observed whose balance is
+// swept, including the hardware wallet's.
+func (c *Chain) addresses() []common.Address {
+	var addresses []common.Address
+	controlled := append(c.accounts.Addresses(), c.opts.ExternalSigner.Addresses()...)
+	for _, address := range append(controlled, c.opts.HardwareSigner.Addresses()...) {
+		if !c.opts.Observed.contains(address) {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// receiverFor returns where funds from account should be swept, falling back
+// to the chain's receiver when there's no per-account override.
+func (c *Chain) receiverFor(account common.Address) *common.Address {
+	if receiver, ok := c.opts.Receivers[account]; ok {
+		return &receiver
+	}
+	return c.receiver
+}
+
+// swept records a successful sweep of value from account to receiver.
+// origTx is nil when the sweep wasn't triggered by a transaction.
+func (c *Chain) swept(account common.Address, receiver *common.Address, origTx *common.Hash, signedTx *types.Transaction) {
+	c.opts.Metrics.swept(c.name, signedTx.Value())
+	c.notify(SeverityInfo, EventSweep, &SweepEvent{
+		Chain:         c.name,
+		From:          account,
+		Receiver:      *receiver,
+		OrigTx:        origTx,
+		ReplacementTx: signedTx.Hash(),
+		Value:         signedTx.Value().String(),
+	}, "swept %s wei from %s to %s in %s", signedTx.Value(), account, receiver, signedTx.Hash())
+}
+
+func (c *Chain) notify(severity Severity, kind string, sweep *SweepEvent, format string, args ...any) {
+	c.opts.Notifiers.Notify(Event{
+		Kind:     kind,
+		Severity: severity,
+		Chain:    c.name,
+		Message:  fmt.Sprintf(format, args...),
+		Sweep:    sweep,
+	})
+}
+
+// supportsSubscriptions reports whether endpoint's transport can deliver
+// subscriptions, which plain HTTP can't. Anything without a scheme is taken
+// to be an IPC socket path, as is an ipc:// URL.
+func supportsSubscriptions(endpoint string) (bool, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false, err
+	}
+
+	switch u.Scheme {
+	case "ws", "wss", "ipc", "":
+		return true, nil
+	case "http", "https":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported endpoint scheme %q", u.Scheme)
+	}
+}
+
+// Connect dials endpoint, retrying with backoff when the dial or the initial
+// chain ID lookup fails.
+func Connect(ctx context.Context, endpoint string, receiver common.Address, accounts *AccountStore, opts Options) (*Chain, error) {
+	delay := opts.connectRetryDelay()
+	for attempt := 0; ; attempt++ {
+		chain, err := connect(ctx, endpoint, receiver, accounts, opts)
+		if err == nil || errors.Is(err, ErrChainIDMismatch) || attempt >= opts.connectRetries() {
+			return chain, err
+		}
+
+		slog.Warn("couldn't connect, retrying", "endpoint", endpoint, "retry_in", delay, "err", err)
+		if !sleepContext(ctx, delay) {
+			return nil, ctx.Err()
+		}
+		delay = nextReconnectDelay(delay)
+	}
+}
+
+// dialTarget returns what rpc.DialContext needs to reach endpoint, it only
+// takes IPC endpoints as a plain path.
+func dialTarget(endpoint string) string {
+	if path, ok := strings.CutPrefix(endpoint, "ipc://"); ok {
+		return path
+	}
+	return endpoint
+}
+
+func connect(ctx context.Context, endpoint string, receiver common.Address, accounts *AccountStore, opts Options) (*Chain, error) {
+	rpcClient, err := dialRPC(ctx, endpoint, opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	eth := ethclient.NewClient(rpcClient)
+
+	chainIDCtx, cancel := context.WithTimeout(ctx, opts.rpcTimeout())
+	chainId, err := eth.ChainID(chainIDCtx)
+	cancel()
+	if err != nil {
+		rpcClient.Close()
+		return nil, err
+	}
+	if opts.ExpectedChainID != nil && chainId.Cmp(opts.ExpectedChainID) != 0 {
+		rpcClient.Close()
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrChainIDMismatch, opts.ExpectedChainID, chainId)
+	}
+
+	signer := types.LatestSignerForChainID(chainId)
+
+	geth := gethPendingSource{client: gethclient.New(rpcClient)}
+
+	chain := NewChain(eth, geth, signer, receiver, accounts, opts)
+
+	// Pre-London chains have no base fee and reject dynamic fee txs.
+	headerCtx, cancel := context.WithTimeout(ctx, opts.rpcTimeout())
+	header, err := eth.HeaderByNumber(headerCtx, nil)
+	cancel()
+	if err != nil {
+		chain.log.Warn("couldn't get latest header, assuming dynamic fee support", "endpoint", endpoint, "err", err)
+	} else if header.BaseFee == nil {
+		chain.log.Info("chain has no base fee, replacing with legacy txs only", "endpoint", endpoint)
+		chain.london = false
+	}
+
+	chain.batch = rpcClient
+	chain.log = chain.log.With("endpoint", endpoint)
+	chain.endpoint = endpoint
+	chain.health = opts.Health.endpoint(chain.name, endpoint)
+
+	return chain, nil
+}
+
+// errRateLimited is returned by lookups dropped because the endpoint's rate
+// limit is used up.
+var errRateLimited = errors.New("rpc rate limit exceeded")
+
+// transactionByHash fails with errRateLimited rather than waiting when the
+// rate limit is used up, a burst of lookups shouldn't hold back sends.
+func (c *Chain) transactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+	if c.limiter != nil && !c.limiter.Allow() {
+		return nil, errRateLimited
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	tx, _, err := c.eth.TransactionByHash(ctx, hash)
+	return tx, err
+}
+
+func (c *Chain) sendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	return c.eth.SendTransaction(ctx, tx)
+}
+
+func (c *Chain) suggestGasPrice(ctx context.Context) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	return c.eth.SuggestGasPrice(ctx)
+}
+
+// balanceAt returns the latest balance of account.
+func (c *Chain) balanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	return c.eth.BalanceAt(ctx, account, nil)
+}
+
+// nonceAt returns the latest nonce of account, not counting pending txs.
+func (c *Chain) nonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	return c.eth.NonceAt(ctx, account, nil)
+}
+
+func (c *Chain) blockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	return c.eth.BlockByHash(ctx, hash)
+}
+
+// simulate runs tx as a call so replacements that would revert aren't
+// broadcast. It runs against the latest block rather than the pending one,
+// since pending state may already include the transaction being replaced.
+func (c *Chain) simulate(ctx context.Context, from common.Address, tx *types.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	_, err := c.eth.CallContract(ctx, ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}, nil)
+	return err
+}
+
+// senderOf returns the sender of tx, recovering it only when it isn't cached
+// already, e.g. for a tx seen again after reconnecting.
+func (c *Chain) senderOf(tx *types.Transaction) (common.Address, error) {
+	if from, ok := c.senders.Get(tx.Hash()); ok {
+		return from, nil
+	}
+
+	from, err := c.recoverSender(tx)
+	if err != nil {
+		return from, err
+	}
+	c.senders.Add(tx.Hash(), from)
+	return from, nil
+}
+
+// recoverSender recovers the sender of tx, falling back to pre-EIP-155 and
+// tx-declared chain ID signers for legacy transactions the chain signer
+// rejects.
+func (c *Chain) recoverSender(tx *types.Transaction) (common.Address, error) {
+	from, err := c.signer.Sender(tx)
+	if err == nil || tx.Type() != types.LegacyTxType {
+		return from, err
+	}
+
+	if !tx.Protected() {
+		return types.HomesteadSigner{}.Sender(tx)
+	}
+	if fallback, fallbackErr := types.NewEIP155Signer(tx.ChainId()).Sender(tx); fallbackErr == nil {
+		return fallback, nil
+	}
+	return from, err
+}
+
+func (c *Chain) ScanIncoming(ctx context.Context) error {
+	heads, unsubscribe := c.heads.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case header := <-heads:
+			block, err := c.blockByHash(ctx, header.Hash())
+			if err != nil {
+				c.log.Warn("couldn't get block by hash", "block", header.Hash(), "err", err)
+				continue
+			}
+
+			for _, transaction := range block.Transactions() {
+				if transaction.To() == nil {
+					continue
+				}
+
+				if c.opts.Observed.contains(*transaction.To()) {
+					continue
+				}
+				if key, ok := c.accountFor(*transaction.To()); ok {
+					c.resendIncoming(ctx, transaction, key)
+				}
+
+			}
+		}
+	}
+}
+
+// resendIncoming forwards the value of incoming transaction to the receiver
+// of the account it was sent to.
+func (c *Chain) resendIncoming(ctx context.Context, transaction *types.Transaction, key accountKey) {
+	account := *transaction.To()
+	receiver := c.receiverFor(account)
+
+	gasPrice, err := c.suggestGasPrice(ctx)
+	if err != nil {
+		c.log.Warn("couldn't get gas price", "err", err)
+		return
+	}
+
+	gas, err := c.sweepGas(ctx, account, *receiver, transaction.Value())
+	if err != nil {
+		c.log.Warn("couldn't get resend gas", "orig_tx", transaction.Hash(), "err", err)
+		return
+	}
+
+	unlock := c.lockAccount(account)
+	defer unlock()
+
+	nonce, err := c.nextNonce(ctx, account)
+	if err != nil {
+		c.log.Warn("couldn't get nonce", "orig_tx", transaction.Hash(), "err", err)
+		return
+	}
+
+	resendTx := &types.LegacyTx{
+		To:       receiver,
+		Value:    new(big.Int).Sub(transaction.Value(), new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))),
+		GasPrice: gasPrice,
+		Gas:      gas,
+		Nonce:    nonce,
+		Data:     c.opts.ReceiverData,
+	}
+
+	signedTx, err := key.sign(types.NewTx(resendTx), c.signer)
+	if err != nil {
+		c.log.Error("couldn't sign replacement tx", "orig_tx", transaction.Hash(), "err", err)
+		return
+	}
+
+	if c.opts.DryRun {
+		c.log.Info("[DRY-RUN] would resend incoming tx", "to", account, "orig_tx", transaction.Hash(), "replacement_tx", signedTx.Hash(), "value", signedTx.Value(), "gas_price", signedTx.GasPrice())
+		return
+	}
+
+	err = c.sendTransaction(ctx, signedTx)
+	if err != nil {
+		c.nonces.forget(account)
+		c.log.Error("couldn't send replacement tx", "orig_tx", transaction.Hash(), "err", err)
+		return
+	}
+	c.nonces.used(account, signedTx)
+	c.confirmations.watch(account, signedTx)
+	origTx := transaction.Hash()
+	c.swept(account, receiver, &origTx, signedTx)
+
+	c.log.Info("resent incoming tx", "to", account, "orig_tx", transaction.Hash(), "replacement_tx", signedTx.Hash(), "value", signedTx.Value(), "gas_price", signedTx.GasPrice())
+}
+
+func (c *Chain) ScanPending(ctx context.Context) error {
+	delay := minReconnectDelay
+	for attempt := 1; ctx.Err() == nil; attempt++ {
+		txChan := make(chan common.Hash)
+		sub, err := c.geth.SubscribePendingTransactions(ctx, txChan)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if isUnsupported(err) {
+				c.log.Warn("pending subscriptions unsupported, switching to balance polling", "err", err)
+				return c.SweepOnBalance(ctx, c.opts.PollInterval)
+			}
+			if attempt >= maxSubscribeAttempts {
+				return fmt.Errorf("couldn't subscribe to pending txs after %d attempts: %w", attempt, err)
+			}
+			c.log.Warn("couldn't subscribe to pending txs", "retry_in", delay, "err", err)
+			if !sleepContext(ctx, delay) {
+				break
+			}
+			delay = nextReconnectDelay(delay)
+			continue
+		}
+		delay, attempt = minReconnectDelay, 0
+
+		c.opts.Metrics.subscribed(c.name, 1)
+		c.health.setConnected(true)
+		err = c.watchPending(ctx, sub, txChan)
+		sub.Unsubscribe()
+		c.health.setConnected(false)
+		c.opts.Metrics.subscribed(c.name, -1)
+		if err != nil {
+			c.log.Warn("pending subscription dropped, resubscribing", "err", err)
+			c.notify(SeverityWarning, EventSubscriptionLost, nil, "pending subscription on %s dropped: %v", c.endpoint, err)
+		}
+	}
+	return nil
+}
+
+var errStalled = errors.New("subscription stalled")
+
+// ErrChainIDMismatch is returned by Connect when an endpoint serves another
+// chain than the configured one.
+var ErrChainIDMismatch = errors.New("endpoint serves another chain")
+
+// isUnsupported reports whether err means the endpoint can't serve
+// subscriptions at all, so retrying is pointless.
+func isUnsupported(err error) bool {
+	if errors.Is(err, rpc.ErrNotificationsUnsupported) {
+		return true
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFoundCode {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not supported") || strings.Contains(msg, "method not found") || strings.Contains(msg, "does not exist")
+}
+
+// sleepContext waits for d and reports false if ctx was cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	return delay
+}
+
+// pendingHash is a pending tx hash along with when it was received, so
+// replacement latency can be measured from detection.
+type pendingHash struct {
+	hash   common.Hash
+	seenAt time.Time
+	// lookups is how often the hash was looked up without being found.
+	lookups int
+}
+
+func (c *Chain) watchPending(ctx context.Context, sub ethereum.Subscription, txChan <-chan common.Hash) error {
+	// A nil watchdog channel never fires when StallTimeout is disabled.
+	var (
+		watchdog *time.Timer
+		stalled  <-chan time.Time
+	)
+	if c.opts.StallTimeout > 0 {
+		watchdog = time.NewTimer(c.opts.StallTimeout)
+		defer watchdog.Stop()
+		stalled = watchdog.C
+	}
+	jobs := make(chan []pendingHash, c.opts.workers())
+	retries := make(chan []pendingHash, notFoundQueueSize)
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pending := range jobs {
+				c.replaceBatch(ctx, pending, retries)
+			}
+		}()
+	}
+	// Hashes the node doesn't know yet wait in retries until they're handed
+	// back to the workers, the scheduler stops before jobs is closed.
+	stopRetries, retriesStopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(retriesStopped)
+		c.scheduleRetries(ctx, retries, jobs, stopRetries)
+	}()
+	defer func() {
+		close(stopRetries)
+		<-retriesStopped
+		close(jobs)
+		wg.Wait()
+	}()
+
+	// Hashes are collected for batchWindow so they can be looked up in one
+	// call, flush is nil while there's nothing collected.
+	var (
+		batch []pendingHash
+		flush <-chan time.Time
+	)
+	dispatch := func() bool {
+		select {
+		case jobs <- batch:
+		case <-ctx.Done():
+			return false
+		}
+		batch, flush = nil, nil
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			return err
+		case <-stalled:
+			return fmt.Errorf("no pending txs for %s: %w", c.opts.StallTimeout, errStalled)
+		case txHash := <-txChan:
+			seenAt := time.Now()
+			c.health.event()
+			if watchdog != nil {
+				watchdog.Reset(c.opts.StallTimeout)
+			}
+			if !c.seen.Add(txHash, struct{}{}) {
+				continue
+			}
+
+			batch = append(batch, pendingHash{hash: txHash, seenAt: seenAt})
+			if !c.batching() || len(batch) >= maxBatchSize {
+				if !dispatch() {
+					return nil
+				}
+			} else if flush == nil {
+				flush = time.After(batchWindow)
+			}
+		case <-flush:
+			if !dispatch() {
+				return nil
+			}
+		}
+	}
+}
+
+// replaceBatch looks pending hashes up and replaces each of them. The ones
+// the node doesn't know yet are looked up again in the background.
+func (c *Chain) replaceBatch(ctx context.Context, pending []pendingHash, retries chan<- []pendingHash) {
+	missing := c.replaceFound(ctx, pending)
+
+	// A hash announced moments ago may not have reached the node queried
+	// yet, one still unknown after NotFoundRetries lookups was dropped or
+	// mined already.
+	var retry []pendingHash
+	for _, p := range missing {
+		if p.lookups++; p.lookups <= c.opts.notFoundRetries() {
+			retry = append(retry, p)
+		} else if ok, dropped := c.sampler.allow("tx not found"); ok {
+			c.log.Debug("pending tx still not found, dropped or mined", "orig_tx", p.hash, "retries", c.opts.notFoundRetries(), "dropped_logs", dropped)
+		}
+	}
+	if len(retry) == 0 {
+		return
+	}
+
+	select {
+	case retries <- retry:
+	default:
+		if ok, dropped := c.sampler.allow("retry queue full"); ok {
+			c.log.Warn("not found retry queue full, dropping hashes", "count", len(retry), "dropped_logs", dropped)
+		}
+	}
+}
+
+// scheduledRetry is a batch of hashes waiting to be looked up again.
+type scheduledRetry struct {
+	pending []pendingHash
+	due     time.Time
+}
+
+// scheduleRetries hands each batch from retries back to jobs once its delay
+// passed, NotFoundRetryDelay doubling with every lookup, until ctx is done or
+// stop is closed.
+func (c *Chain) scheduleRetries(ctx context.Context, retries <-chan []pendingHash, jobs chan<- []pendingHash, stop <-chan struct{}) {
+	var waiting []scheduledRetry
+	for {
+		// A nil channel never fires while nothing is waiting.
+		var next <-chan time.Time
+		if len(waiting) > 0 {
+			earliest := waiting[0].due
+			for _, retry := range waiting[1:] {
+				if retry.due.Before(earliest) {
+					earliest = retry.due
+				}
+			}
+			next = time.After(time.Until(earliest))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case pending := <-retries:
+			delay := c.opts.notFoundRetryDelay() << (pending[0].lookups - 1)
+			waiting = append(waiting, scheduledRetry{pending: pending, due: time.Now().Add(delay)})
+		case now := <-next:
+			remaining := waiting[:0]
+			for _, retry := range waiting {
+				if retry.due.After(now) {
+					remaining = append(remaining, retry)
+					continue
+				}
+				select {
+				case jobs <- retry.pending:
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				}
+			}
+			waiting = remaining
+		}
+	}
+}
+
+// replaceFound looks pending hashes up and replaces the txs found, it
+// returns the hashes the node doesn't know.
+func (c *Chain) replaceFound(ctx context.Context, pending []pendingHash) (missing []pendingHash) {
+	hashes := make([]common.Hash, len(pending))
+	for i, p := range pending {
+		hashes[i] = p.hash
+	}
+	txs, errs := c.transactionsByHash(ctx, hashes)
+	for i, tx := range txs {
+		if errors.Is(errs[i], types.ErrTxTypeNotSupported) {
+			if ok, dropped := c.sampler.allow("unsupported tx type"); ok {
+				c.log.Debug("skipping tx of unsupported type, e.g. a blob tx", "orig_tx", hashes[i], "dropped_logs", dropped)
+			}
+			continue
+		}
+		if errors.Is(errs[i], ethereum.NotFound) {
+			missing = append(missing, pending[i])
+			continue
+		}
+		if errs[i] != nil {
+			if ok, dropped := c.sampler.allow("tx by hash"); ok {
+				c.log.Debug("couldn't get tx by hash", "orig_tx", hashes[i], "err", errs[i], "dropped_logs", dropped)
+			}
+			continue
+		}
+		c.feeSamples.add(tx)
+		c.replaceRecovered(ctx, tx, pending[i].seenAt)
+	}
+	return missing
+}
+
+// replaceRecovered runs replacePending, logging a panic instead of letting
+// it kill the process since workers run outside the scanner's goroutine.
+func (c *Chain) replaceRecovered(ctx context.Context, tx *types.Transaction, seenAt time.Time) {
+	defer func() {
+		if p := recover(); p != nil {
+			c.log.Error("panic while replacing tx", "orig_tx", tx.Hash(), "panic", p, "stack", string(debug.Stack()))
+		}
+	}()
+	c.replacePending(ctx, tx, seenAt)
+}
+
+// replacementGas returns the gas limit for replacing tx: GasLimitOverride
+// when set, otherwise an estimate with GasMultiplier headroom. Plain
+// transfers get exactly transferGas, and tx's own limit is used when the
+// estimate fails.
+func (c *Chain) replacementGas(ctx context.Context, from common.Address, tx *types.Transaction, receiver common.Address) uint64 {
+	if c.opts.GasLimitOverride > 0 {
+		return c.opts.GasLimitOverride
+	}
+
+	to, data, isTokenCall := replacementCall(tx, receiver, c.opts.ReceiverData, c.opts.Rescues)
+	// The replacement keeps tx's access list, which costs intrinsic gas.
+	msg := ethereum.CallMsg{From: from, To: &to, Data: data, AccessList: tx.AccessList()}
+	if !isTokenCall {
+		// Receiver contracts may only accept deposits with value.
+		msg.Value = tx.Value()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	gas, err := c.eth.EstimateGas(ctx, msg)
+	if err != nil {
+		c.log.Warn("couldn't estimate replacement gas, keeping the original's", "from", from, "orig_tx", tx.Hash(), "err", err)
+		return tx.Gas()
+	}
+	if gas == transferGas {
+		return gas
+	}
+	return uint64(float64(gas) * c.opts.gasMultiplier())
+}
+
+// sweepGas returns the gas limit for sending value from account to
+// receiver: transferGas unless ReceiverData is set, then an estimate with
+// GasMultiplier headroom.
+func (c *Chain) sweepGas(ctx context.Context, account, receiver common.Address, value *big.Int) (uint64, error) {
+	if len(c.opts.ReceiverData) == 0 {
+		return transferGas, nil
+	}
+	if c.opts.GasLimitOverride > 0 {
+		return c.opts.GasLimitOverride, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	gas, err := c.eth.EstimateGas(ctx, ethereum.CallMsg{From: account, To: &receiver, Value: value, Data: c.opts.ReceiverData})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't estimate gas: %w", err)
+	}
+	return uint64(float64(gas) * c.opts.gasMultiplier()), nil
+}
+
+// baseFeeFor returns the pending block's base fee when tx is a dynamic fee
+// tx, or nil when it's not, the chain is pre-London or the base fee is
+// unknown.
+func (c *Chain) baseFeeFor(ctx context.Context, tx *types.Transaction) *big.Int {
+	if tx.Type() != types.DynamicFeeTxType || !c.london {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	header, err := c.eth.HeaderByNumber(ctx, big.NewInt(int64(rpc.PendingBlockNumber)))
+	if err != nil {
+		c.log.Warn("couldn't get pending base fee, bumping fee caps only", "orig_tx", tx.Hash(), "err", err)
+		return nil
+	}
+	return header.BaseFee
+}
+
+// withFullBalance returns replacementTx sending the whole balance of from
+// minus its fees and GasReserve. The latest balance is used, the pending one
+// already has the tx being replaced deducted.
+func (c *Chain) withFullBalance(ctx context.Context, from common.Address, replacementTx *types.Transaction) (*types.Transaction, error) {
+	balance, err := c.balanceAt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get balance: %w", err)
+	}
+
+	value, err := fullBalanceValue(balance, c.opts.GasReserve, replacementTx.GasFeeCap(), replacementTx.Gas())
+	if err != nil {
+		return nil, err
+	}
+	return withValue(replacementTx, value), nil
+}
+
+// lockAccount serializes replacements for account so concurrent workers
+// don't race each other on its nonce.
+func (c *Chain) lockAccount(account common.Address) (unlock func()) {
+	mu, _ := c.accountLocks.LoadOrStore(account, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// replacePending replaces tx if it drains a controlled account, seenAt is
+// when its hash was received.
+func (c *Chain) replacePending(ctx context.Context, tx *types.Transaction, seenAt time.Time) {
+	// Blob txs carry their value in sidecars we can't rebuild.
+	if tx.Type() == blobTxType {
+		c.log.Debug("skipping blob tx", "orig_tx", tx.Hash())
+		return
+	}
+
+	from, err := c.senderOf(tx)
+	if err != nil {
+		if ok, dropped := c.sampler.allow("sender"); ok {
+			c.log.Warn("couldn't get sender", "orig_tx", tx.Hash(), "err", err, "dropped_logs", dropped)
+		}
+		return
+	}
+
+	if c.opts.Observed.contains(from) {
+		c.log.Info("observed tx from watched account", "from", from, "orig_tx", tx.Hash(), "to", tx.To(), "nonce", tx.Nonce(), "value", tx.Value(), "gas_price", tx.GasPrice())
+		c.opts.Metrics.replacement(c.name, statusObserved)
+		c.replacementEvent(statusObserved, from, tx, nil, "observed account")
+		return
+	}
+
+	key, ok := c.accountFor(from)
+	if !ok {
+		return
+	}
+	if len(c.opts.ActiveAccounts) > 0 && !c.opts.ActiveAccounts[from] {
+		c.log.Debug("skipping replacement, account not active", "from", from, "orig_tx", tx.Hash())
+		c.replacementEvent(statusSkipped, from, tx, nil, "account not active")
+		return
+	}
+
+	if c.failures.coolingDown(from, time.Now()) {
+		c.log.Debug("skipping replacement, account cooling down after failures", "from", from, "orig_tx", tx.Hash())
+		c.opts.Metrics.replacement(c.name, statusSkipped)
+		c.replacementEvent(statusSkipped, from, tx, nil, "account cooling down")
+		return
+	}
+
+	if prev, ok := c.replaced.Get(inflightKey{from: from, nonce: tx.Nonce()}); ok && !outbids(tx, prev) {
+		c.log.Debug("skipping tx already replaced", "from", from, "orig_tx", tx.Hash(), "replacement_tx", prev.Hash())
+		c.opts.Metrics.replacement(c.name, statusSkipped)
+		c.replacementEvent(statusSkipped, from, tx, prev, "already replaced")
+		return
+	}
+
+	if tx.To() == nil {
+		c.log.Info("skipping contract creation from controlled account", "from", from, "orig_tx", tx.Hash())
+		c.replacementEvent(statusSkipped, from, tx, nil, "contract creation")
+		return
+	}
+
+	// A token call benefits e.g. the recipient of a transfer rather than
+	// the contract it calls.
+	destination := *tx.To()
+	_, beneficiary, isTokenCall := c.opts.Rescues.match(tx.Data())
+	if isTokenCall {
+		destination = beneficiary
+	}
+
+	receiver := c.receiverFor(from)
+	if destination == *receiver {
+		return
+	}
+	if from == *receiver {
+		c.log.Info("skipping tx sent by the receiver itself", "from", from, "orig_tx", tx.Hash())
+		c.replacementEvent(statusSkipped, from, tx, nil, "sent by receiver")
+		return
+	}
+	if from == destination {
+		c.log.Info("skipping self-send", "from", from, "orig_tx", tx.Hash())
+		c.replacementEvent(statusSkipped, from, tx, nil, "self-send")
+		return
+	}
+
+	if isTokenCall && c.opts.BlacklistTokens[*tx.To()] {
+		c.log.Info("skipping transfer of blacklisted token", "from", from, "orig_tx", tx.Hash(), "token", tx.To())
+		c.replacementEvent(statusSkipped, from, tx, nil, "blacklisted token")
+		return
+	}
+	if c.opts.BlacklistDestinations[destination] {
+		c.log.Info("skipping tx to blacklisted destination", "from", from, "orig_tx", tx.Hash(), "to", destination)
+		c.replacementEvent(statusSkipped, from, tx, nil, "blacklisted destination")
+		return
+	}
+
+	if c.opts.Whitelist[destination] {
+		c.log.Info("letting tx to whitelisted destination through", "from", from, "orig_tx", tx.Hash(), "to", destination)
+		c.replacementEvent(statusSkipped, from, tx, nil, "whitelisted destination")
+		return
+	}
+
+	// A call moving no value may still set up moving funds later, e.g. an
+	// approval of an unknown token, there's nothing to redirect.
+	cancel := c.opts.CancelMode
+	if !isTokenCall && tx.Value().Sign() == 0 && len(tx.Data()) > 0 {
+		switch c.opts.ZeroValueCalls {
+		case ZeroValueLog:
+			c.log.Warn("suspicious zero-value call from controlled account", "from", from, "orig_tx", tx.Hash(), "to", tx.To(), "selector", hexutil.Bytes(tx.Data()[:min(len(tx.Data()), 4)]))
+			c.opts.Metrics.replacement(c.name, statusSkipped)
+			c.replacementEvent(statusSkipped, from, tx, nil, "suspicious zero-value call")
+			return
+		case ZeroValueCancel:
+			c.log.Info("cancelling zero-value call from controlled account", "from", from, "orig_tx", tx.Hash(), "to", tx.To())
+			cancel = true
+		}
+	}
+
+	// min_value and min_sweep are native amounts, they don't apply to tokens.
+	if !cancel && !isTokenCall && c.opts.MinValue != nil && tx.Value().Cmp(c.opts.MinValue) < 0 {
+		c.log.Debug("skipping replacement, value below minimum", "from", from, "orig_tx", tx.Hash(), "value", tx.Value(), "min_value", c.opts.MinValue)
+		c.replacementEvent(statusSkipped, from, tx, nil, "value below min_value")
+		return
+	}
+
+	unlock := c.lockAccount(from)
+	defer unlock()
+
+	var replacementTx *types.Transaction
+	if cancel {
+		replacementTx, err = buildCancel(tx, from, !c.london, c.fees(), c.baseFeeFor(ctx, tx))
+	} else {
+		replacementTx, err = buildReplacement(tx, *receiver, c.opts.ReceiverData, c.opts.Rescues, !c.london, c.replacementGas(ctx, from, tx, *receiver), c.fees(), c.baseFeeFor(ctx, tx))
+	}
+	if err != nil {
+		c.log.Info("skipping replacement", "from", from, "orig_tx", tx.Hash(), "value", tx.Value(), "gas_price", tx.GasPrice(), "max_gas_price", c.opts.MaxGasPrice, "reason", err)
+		c.opts.Metrics.replacement(c.name, statusSkipped)
+		c.replacementEvent(statusSkipped, from, tx, nil, err.Error())
+		return
+	}
+	// A cancel sends nothing, a native replacement may sweep more or too little.
+	sweepsNative := !isTokenCall && !cancel
+	if sweepsNative && c.opts.SweepFullBalance {
+		replacementTx, err = c.withFullBalance(ctx, from, replacementTx)
+		if err != nil {
+			c.log.Info("skipping replacement", "from", from, "orig_tx", tx.Hash(), "reason", err)
+			c.opts.Metrics.replacement(c.name, statusSkipped)
+			c.replacementEvent(statusSkipped, from, tx, nil, err.Error())
+			return
+		}
+	}
+	if sweepsNative && c.opts.MinSweep != nil && replacementTx.Value().Cmp(c.opts.MinSweep) < 0 {
+		c.log.Info("skipping replacement, net sweep below minimum", "from", from, "orig_tx", tx.Hash(), "value", replacementTx.Value(), "min_sweep", c.opts.MinSweep)
+		c.opts.Metrics.replacement(c.name, statusSkipped)
+		c.replacementEvent(statusSkipped, from, tx, nil, "net sweep below min_sweep")
+		return
+	}
+
+	signedTx, err := key.sign(replacementTx, c.signer)
+	if err != nil {
+		c.log.Error("couldn't sign replacement tx", "from", from, "orig_tx", tx.Hash(), "err", err)
+		c.opts.Metrics.replacement(c.name, statusFailed)
+		c.replacementEvent(statusFailed, from, tx, nil, err.Error())
+		return
+	}
+
+	if c.opts.SimulateBeforeSend {
+		if err := c.simulate(ctx, from, signedTx); err != nil {
+			c.log.Warn("skipping replacement, simulation failed", "from", from, "orig_tx", tx.Hash(), "replacement_tx", signedTx.Hash(), "err", err)
+			c.opts.Metrics.replacement(c.name, statusSkipped)
+			c.replacementEvent(statusSkipped, from, tx, signedTx, "simulation failed: "+err.Error())
+			return
+		}
+	}
+
+	if c.opts.DryRun {
+		c.log.Info("[DRY-RUN] would replace tx", "from", from, "orig_tx", tx.Hash(), "replacement_tx", signedTx.Hash(), "value", signedTx.Value(), "gas", signedTx.Gas(), "gas_price", signedTx.GasPrice())
+		c.opts.Metrics.replacement(c.name, statusDryRun)
+		c.replacementEvent(statusDryRun, from, tx, signedTx, "")
+		return
+	}
+
+	signedTx, err = c.sendReplacement(ctx, key, from, *receiver, signedTx)
+	if err != nil {
+		c.log.Error("couldn't send replacement tx", "from", from, "orig_tx", tx.Hash(), "err", err)
+		c.notify(SeverityError, EventReplacementFailed, nil, "couldn't replace %s from %s: %v", tx.Hash(), from, err)
+		if cooldown := c.failures.failed(from, time.Now()); cooldown > 0 {
+			c.log.Warn("replacements keep failing, cooling account down", "from", from, "cooldown", cooldown)
+		}
+		c.opts.Metrics.replacement(c.name, statusFailed)
+		c.replacementEvent(statusFailed, from, tx, signedTx, err.Error())
+		return
+	}
+	latency := time.Since(seenAt)
+	c.opts.Metrics.replacement(c.name, statusSent)
+	c.replacementEvent(statusSent, from, tx, signedTx, "")
+	c.opts.Metrics.replacementLatency(c.name, latency)
+	c.log.Debug("replacement latency", "orig_tx", tx.Hash(), "replacement_tx", signedTx.Hash(), "latency", latency)
+	c.failures.succeeded(from)
+	c.nonces.used(from, signedTx)
+	// Only the replacement chaser forgets what's tracked.
+	if c.opts.RebumpBlocks > 0 {
+		c.inflight.track(from, signedTx)
+	}
+	c.confirmations.watch(from, signedTx)
+	c.replaced.Add(inflightKey{from: from, nonce: signedTx.Nonce()}, signedTx)
+
+	if cancel {
+		c.log.Info("cancelled tx", "from", from, "orig_tx", tx.Hash(), "replacement_tx", signedTx.Hash(), "gas_price", signedTx.GasPrice())
+		return
+	}
+	origTx := tx.Hash()
+	c.swept(from, receiver, &origTx, signedTx)
+	c.log.Info("replaced tx", "from", from, "orig_tx", tx.Hash(), "replacement_tx", signedTx.Hash(), "value", signedTx.Value(), "gas_price", signedTx.GasPrice())
+}
@@ -0,0 +1,1628 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Chains run against a node through ethclient, or in-process backends in tests.
+var (
+	_ EthClient = (*ethclient.Client)(nil)
+	_ EthClient = (*backends.SimulatedBackend)(nil)
+)
+
+var (
+	testReceiverAddress = common.HexToAddress(testReceiver)
+	// testAttacker is where a compromised key tries to move funds to.
+	testAttacker = common.HexToAddress("0x2222222222222222222222222222222222222222")
+)
+
+// newTestKey returns a fresh key and its address.
+func newTestKey(t testing.TB) (*ecdsa.PrivateKey, common.Address) {
+	t.Helper()
+
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, crypto.PubkeyToAddress(privateKey.PublicKey)
+}
+
+// waitFor polls cond until it holds, failing the test after five seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition never held")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newSimulatedBackend returns an in-process chain funding each of keys with
+// one ether, and the accounts of keys.
+func newSimulatedBackend(t *testing.T, keys ...*ecdsa.PrivateKey) (*backends.SimulatedBackend, *AccountStore) {
+	t.Helper()
+
+	alloc := make(core.GenesisAlloc)
+	accounts := make(Accounts)
+	for _, key := range keys {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		alloc[address] = core.GenesisAccount{Balance: big.NewInt(params.Ether)}
+		accounts[address] = key
+	}
+	sim := backends.NewSimulatedBackend(alloc, 30_000_000)
+	t.Cleanup(func() { sim.Close() })
+	return sim, NewAccountStore(accounts)
+}
+
+// newSimulatedChain returns a Chain defending keys on a simulated backend.
+func newSimulatedChain(t *testing.T, opts Options, keys ...*ecdsa.PrivateKey) (*Chain, *backends.SimulatedBackend) {
+	t.Helper()
+
+	sim, accounts := newSimulatedBackend(t, keys...)
+	return NewChain(sim, nil, simulatedSigner(sim), testReceiverAddress, accounts, opts), sim
+}
+
+func simulatedSigner(sim *backends.SimulatedBackend) types.Signer {
+	return types.LatestSignerForChainID(sim.Blockchain().Config().ChainID)
+}
+
+// signTestTx signs a legacy transfer of value wei from key at nonce.
+func signTestTx(t testing.TB, signer types.Signer, key *ecdsa.PrivateKey, to common.Address, nonce uint64, value, gasPrice *big.Int) *types.Transaction {
+	t.Helper()
+
+	tx, err := types.SignNewTx(key, signer, &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &to,
+		Value:    value,
+		Gas:      transferGas,
+		GasPrice: gasPrice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestReplacePendingRedirectsToReceiver(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	// The attacker's transfer is only announced, the replacement takes its
+	// nonce.
+	gasPrice, err := sim.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := big.NewInt(params.Ether / 2)
+	orig := signTestTx(t, chain.signer, key, testAttacker, 0, value, gasPrice)
+	chain.replacePending(ctx, orig, time.Now())
+	sim.Commit()
+
+	nonce, err := sim.NonceAt(ctx, account, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 1 {
+		t.Fatalf("account nonce = %d, want 1 after the replacement", nonce)
+	}
+
+	replacementTx, ok := chain.replaced.Get(inflightKey{from: account, nonce: 0})
+	if !ok {
+		t.Fatal("no replacement recorded")
+	}
+	if to := replacementTx.To(); to == nil || *to != testReceiverAddress {
+		t.Fatalf("replacement sent to %v, want %s", to, testReceiverAddress)
+	}
+	wantPrice, _ := bumpPrice(gasPrice, defaultBumpPercent, nil)
+	if replacementTx.GasPrice().Cmp(wantPrice) < 0 {
+		t.Fatalf("replacement gas price = %s, want at least %s", replacementTx.GasPrice(), wantPrice)
+	}
+
+	receipt, err := sim.TransactionReceipt(ctx, replacementTx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("replacement receipt status = %d, want success", receipt.Status)
+	}
+
+	received, err := sim.BalanceAt(ctx, testReceiverAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The replacement spends what the original could have, value and fees.
+	budget := new(big.Int).Add(value, new(big.Int).Mul(orig.GasPrice(), new(big.Int).SetUint64(orig.Gas())))
+	fee := new(big.Int).Mul(replacementTx.GasPrice(), new(big.Int).SetUint64(replacementTx.Gas()))
+	if want := new(big.Int).Sub(budget, fee); received.Cmp(want) != 0 {
+		t.Fatalf("receiver balance = %s, want %s", received, want)
+	}
+	if attacker, _ := sim.BalanceAt(ctx, testAttacker, nil); attacker.Sign() != 0 {
+		t.Fatalf("attacker balance = %s, want 0", attacker)
+	}
+}
+
+func TestReplacePendingLeavesTxsToReceiver(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	gasPrice, err := sim.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testReceiverAddress, 0, big.NewInt(1), gasPrice), time.Now())
+	sim.Commit()
+
+	if nonce, _ := sim.NonceAt(ctx, account, nil); nonce != 0 {
+		t.Fatalf("account nonce = %d, want 0, a tx to the receiver isn't replaced", nonce)
+	}
+}
+
+func TestReplacePendingComparesReceiversByValue(t *testing.T) {
+	key, account := newTestKey(t)
+	override := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	opts := Options{BumpPercent: defaultBumpPercent, Receivers: map[common.Address]common.Address{account: override}}
+	chain, sim := newSimulatedChain(t, opts, key)
+	ctx := context.Background()
+
+	// A separately parsed copy of the override, not the pointer the chain holds.
+	to := common.HexToAddress(override.Hex())
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, to, 0, big.NewInt(1), big.NewInt(params.GWei)), time.Now())
+	sim.Commit()
+
+	if nonce, _ := sim.NonceAt(ctx, account, nil); nonce != 0 {
+		t.Fatalf("account nonce = %d, want 0, a tx to the account's receiver isn't replaced", nonce)
+	}
+}
+
+func TestReplacePendingDryRunDoesntBroadcast(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{BumpPercent: defaultBumpPercent, DryRun: true}, key)
+	ctx := context.Background()
+
+	gasPrice, err := sim.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), gasPrice), time.Now())
+	sim.Commit()
+
+	if nonce, _ := sim.NonceAt(ctx, account, nil); nonce != 0 {
+		t.Fatalf("account nonce = %d, want 0 in dry-run", nonce)
+	}
+}
+
+// countingSigner counts the senders it recovers.
+type countingSigner struct {
+	types.Signer
+	recovered int
+}
+
+func (s *countingSigner) Sender(tx *types.Transaction) (common.Address, error) {
+	s.recovered++
+	return s.Signer.Sender(tx)
+}
+
+func newSenderTestChain(t testing.TB, signer types.Signer) *Chain {
+	t.Helper()
+	return NewChain(nil, nil, signer, testReceiverAddress, NewAccountStore(nil), Options{})
+}
+
+func TestSenderOfCachesRecoveredSenders(t *testing.T) {
+	key, account := newTestKey(t)
+	signer := &countingSigner{Signer: types.LatestSignerForChainID(big.NewInt(1))}
+	chain := newSenderTestChain(t, signer)
+	tx := signTestTx(t, signer, key, testAttacker, 0, big.NewInt(1), big.NewInt(1))
+
+	for i := 0; i < 3; i++ {
+		from, err := chain.senderOf(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from != account {
+			t.Fatalf("senderOf() = %s, want %s", from, account)
+		}
+	}
+	if signer.recovered != 1 {
+		t.Fatalf("recovered the sender %d times, want once", signer.recovered)
+	}
+}
+
+func TestSenderOfDoesntCacheFailures(t *testing.T) {
+	signer := &countingSigner{Signer: types.LatestSignerForChainID(big.NewInt(1))}
+	chain := newSenderTestChain(t, signer)
+	// An unsigned dynamic fee tx has no sender to recover.
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), To: &testAttacker, GasTipCap: new(big.Int), GasFeeCap: new(big.Int), Value: new(big.Int)})
+
+	for i := 0; i < 2; i++ {
+		if _, err := chain.senderOf(tx); err == nil {
+			t.Fatal("senderOf() of an unsigned tx succeeded")
+		}
+	}
+	if signer.recovered != 2 {
+		t.Fatalf("tried recovering %d times, want every time", signer.recovered)
+	}
+}
+
+func TestSenderOfRecoversOtherChainIDs(t *testing.T) {
+	key, account := newTestKey(t)
+	chain := newSenderTestChain(t, types.LatestSignerForChainID(big.NewInt(1)))
+
+	// Pre-EIP-155 and foreign chain ID legacy txs fall back to their own signer.
+	for _, signer := range []types.Signer{types.HomesteadSigner{}, types.NewEIP155Signer(big.NewInt(5))} {
+		tx := signTestTx(t, signer, key, testAttacker, 0, big.NewInt(1), big.NewInt(1))
+		if from, err := chain.senderOf(tx); err != nil || from != account {
+			t.Fatalf("senderOf() = %s, %v, want %s", from, err, account)
+		}
+	}
+}
+
+func benchmarkSenderOf(b *testing.B, cached bool) {
+	key, _ := newTestKey(b)
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	chain := newSenderTestChain(b, signer)
+	tx := signTestTx(b, signer, key, testAttacker, 0, big.NewInt(1), big.NewInt(1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !cached {
+			chain.senders = newLRUCache[common.Hash, common.Address](1)
+		}
+		if _, err := chain.senderOf(tx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSenderOfCached(b *testing.B)   { benchmarkSenderOf(b, true) }
+func BenchmarkSenderOfUncached(b *testing.B) { benchmarkSenderOf(b, false) }
+
+// testSubscription is a subscription that fails when told to.
+type testSubscription struct {
+	err  chan error
+	once sync.Once
+}
+
+func newTestSubscription() *testSubscription {
+	return &testSubscription{err: make(chan error, 1)}
+}
+
+func (s *testSubscription) Err() <-chan error { return s.err }
+
+func (s *testSubscription) Unsubscribe() {
+	s.once.Do(func() { close(s.err) })
+}
+
+// testPendingSource hands out a new subscription for every subscribe, after
+// failing it with errs in turn.
+type testPendingSource struct {
+	mu         sync.Mutex
+	errs       []error
+	subscribes int
+	subs       chan *testSubscription
+}
+
+func newTestPendingSource(errs ...error) *testPendingSource {
+	return &testPendingSource{errs: errs, subs: make(chan *testSubscription, 16)}
+}
+
+func (s *testPendingSource) SubscribePendingTransactions(ctx context.Context, ch chan<- common.Hash) (ethereum.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribes++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	sub := newTestSubscription()
+	s.subs <- sub
+	return sub, nil
+}
+
+func (s *testPendingSource) subscribeCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribes
+}
+
+// nextSubscription waits for the next successful subscribe.
+func (s *testPendingSource) nextSubscription(t *testing.T) *testSubscription {
+	t.Helper()
+
+	select {
+	case sub := <-s.subs:
+		return sub
+	case <-time.After(5 * time.Second):
+		t.Fatal("no subscription")
+		return nil
+	}
+}
+
+func TestScanPendingResubscribesWhenDropped(t *testing.T) {
+	source := newTestPendingSource()
+	chain := NewChain(nil, source, types.LatestSignerForChainID(big.NewInt(1)), testReceiverAddress, NewAccountStore(nil), Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- chain.ScanPending(ctx) }()
+
+	source.nextSubscription(t).err <- errors.New("connection reset")
+	source.nextSubscription(t)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ScanPending() = %v, want nil once cancelled", err)
+	}
+	if n := source.subscribeCount(); n != 2 {
+		t.Fatalf("subscribed %d times, want 2", n)
+	}
+}
+
+func TestScanPendingRetriesFailedSubscribes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits out the reconnect delay")
+	}
+	source := newTestPendingSource(errors.New("dial timeout"))
+	chain := NewChain(nil, source, types.LatestSignerForChainID(big.NewInt(1)), testReceiverAddress, NewAccountStore(nil), Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- chain.ScanPending(ctx) }()
+
+	// The second attempt comes after minReconnectDelay.
+	source.nextSubscription(t)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ScanPending() = %v, want nil once cancelled", err)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	if !sleepContext(context.Background(), time.Millisecond) {
+		t.Fatal("sleepContext() = false without cancelling")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if sleepContext(ctx, time.Hour) {
+		t.Fatal("sleepContext() = true after cancelling")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("sleepContext() took %s after cancelling", elapsed)
+	}
+}
+
+func TestScannersStopWhenCancelled(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, _ := newSimulatedChain(t, Options{}, key)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scanners := map[string]func(context.Context) error{
+		"balance poller":   func(ctx context.Context) error { return chain.SweepOnBalance(ctx, time.Hour) },
+		"incoming scanner": chain.ScanIncoming,
+		"rebumper":         chain.ChaseReplacements,
+	}
+	for name, scan := range scanners {
+		done := make(chan error, 1)
+		go func() { done <- scan(ctx) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%s returned %v, want nil once cancelled", name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s didn't stop once cancelled", name)
+		}
+	}
+}
+
+func TestResendIncoming(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		key, account := newTestKey(t)
+		chain, sim := newSimulatedChain(t, Options{DryRun: dryRun}, key)
+		ctx := context.Background()
+
+		stranger, _ := newTestKey(t)
+		incoming := signTestTx(t, chain.signer, stranger, account, 0, big.NewInt(params.Ether/10), big.NewInt(params.GWei))
+		accountKey, _ := chain.accountFor(account)
+		chain.resendIncoming(ctx, incoming, accountKey)
+		sim.Commit()
+
+		received, err := sim.BalanceAt(ctx, testReceiverAddress, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dryRun {
+			if received.Sign() != 0 {
+				t.Fatalf("receiver got %s in dry-run, want nothing", received)
+			}
+			continue
+		}
+		// The incoming value minus the resend's fee.
+		if received.Sign() <= 0 || received.Cmp(incoming.Value()) >= 0 {
+			t.Fatalf("receiver got %s, want a little less than %s", received, incoming.Value())
+		}
+	}
+}
+
+func TestReplacePendingUsesPerAccountReceiver(t *testing.T) {
+	key, account := newTestKey(t)
+	otherKey, other := newTestKey(t)
+	override := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	opts := Options{BumpPercent: defaultBumpPercent, Receivers: map[common.Address]common.Address{account: override}}
+	chain, sim := newSimulatedChain(t, opts, key, otherKey)
+	ctx := context.Background()
+
+	if got := chain.receiverFor(other); *got != testReceiverAddress {
+		t.Fatalf("receiverFor(other) = %s, want the chain receiver %s", got, testReceiverAddress)
+	}
+
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	sim.Commit()
+
+	replacementTx, ok := chain.replaced.Get(inflightKey{from: account, nonce: 0})
+	if !ok {
+		t.Fatal("no replacement recorded")
+	}
+	if *replacementTx.To() != override {
+		t.Fatalf("replacement sent to %s, want the account's receiver %s", replacementTx.To(), override)
+	}
+}
+
+// testRPCError is an rpc.Error with a code.
+type testRPCError struct {
+	code int
+	msg  string
+}
+
+func (e testRPCError) Error() string  { return e.msg }
+func (e testRPCError) ErrorCode() int { return e.code }
+
+func TestIsUnsupported(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{rpc.ErrNotificationsUnsupported, true},
+		{fmt.Errorf("subscribe: %w", rpc.ErrNotificationsUnsupported), true},
+		{testRPCError{code: methodNotFoundCode, msg: "eth_subscribe"}, true},
+		{errors.New("the method eth_subscribe does not exist/is not available"), true},
+		{errors.New("subscriptions not supported"), true},
+		{errors.New("connection refused"), false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isUnsupported(tt.err); got != tt.want {
+			t.Errorf("isUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestScanPendingFallsBackToPolling(t *testing.T) {
+	key, _ := newTestKey(t)
+	sim, accounts := newSimulatedBackend(t, key)
+	source := newTestPendingSource(rpc.ErrNotificationsUnsupported)
+	chain := NewChain(sim, source, simulatedSigner(sim), testReceiverAddress, accounts, Options{PollInterval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- chain.ScanPending(ctx) }()
+
+	// Polling sweeps the balance right away instead of resubscribing.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if received, _ := sim.BalanceAt(ctx, testReceiverAddress, nil); received.Sign() > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("balance wasn't swept")
+		}
+		sim.Commit()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ScanPending() = %v, want nil once cancelled", err)
+	}
+	if n := source.subscribeCount(); n != 1 {
+		t.Fatalf("subscribed %d times, want 1", n)
+	}
+}
+
+// recordingBackend records the txs sent to it instead of mining them, so
+// several replacements of one nonce can be sent. errs fail the first sends.
+type recordingBackend struct {
+	*backends.SimulatedBackend
+	mu   sync.Mutex
+	errs []error
+	sent []*types.Transaction
+}
+
+func (b *recordingBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.errs) > 0 {
+		err := b.errs[0]
+		b.errs = b.errs[1:]
+		return err
+	}
+	b.sent = append(b.sent, tx)
+	return nil
+}
+
+// TransactionByHash reports the recorded txs as pending, like the node they
+// were sent to would.
+func (b *recordingBackend) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	for _, tx := range b.sentTxs() {
+		if tx.Hash() == hash {
+			return tx, true, nil
+		}
+	}
+	return b.SimulatedBackend.TransactionByHash(ctx, hash)
+}
+
+func (b *recordingBackend) sentTxs() []*types.Transaction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*types.Transaction(nil), b.sent...)
+}
+
+// newRecordingChain returns a Chain defending keys that records what it
+// sends rather than mining it.
+func newRecordingChain(t *testing.T, opts Options, keys ...*ecdsa.PrivateKey) (*Chain, *recordingBackend) {
+	t.Helper()
+
+	sim, accounts := newSimulatedBackend(t, keys...)
+	backend := &recordingBackend{SimulatedBackend: sim}
+	return NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, accounts, opts), backend
+}
+
+func TestReplacePendingOfPreEIP155Tx(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	// Signed without replay protection.
+	orig := signTestTx(t, types.HomesteadSigner{}, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+	chain.replacePending(ctx, orig, time.Now())
+	sim.Commit()
+
+	replacementTx, ok := chain.replaced.Get(inflightKey{from: account, nonce: 0})
+	if !ok {
+		t.Fatal("pre-EIP-155 tx wasn't replaced")
+	}
+	// The replacement itself is replay protected.
+	if !replacementTx.Protected() || replacementTx.ChainId().Cmp(chain.signer.ChainID()) != 0 {
+		t.Fatalf("replacement chain ID = %s, protected %v, want %s", replacementTx.ChainId(), replacementTx.Protected(), chain.signer.ChainID())
+	}
+}
+
+// hangingBackend never answers reads until their context is done, like a
+// node that stopped responding.
+type hangingBackend struct {
+	*backends.SimulatedBackend
+}
+
+func (hangingBackend) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func (hangingBackend) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRPCsTimeOut(t *testing.T) {
+	key, account := newTestKey(t)
+	sim, accounts := newSimulatedBackend(t, key)
+	chain := NewChain(hangingBackend{sim}, nil, simulatedSigner(sim), testReceiverAddress, accounts, Options{RPCTimeout: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"balance": func() error {
+			_, err := chain.sweepNative(ctx, account)
+			return err
+		},
+		"token balance": func() error {
+			_, err := chain.sweepToken(ctx, account, testToken)
+			return err
+		},
+		"nonce": func() error {
+			_, err := chain.nonceAt(ctx, account)
+			return err
+		},
+		"block": func() error {
+			_, err := chain.blockByHash(ctx, common.Hash{})
+			return err
+		},
+	}
+	for name, call := range calls {
+		start := time.Now()
+		err := call()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: err = %v, want %v", name, err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s took %s, want it bounded by the RPC timeout", name, elapsed)
+		}
+	}
+}
+
+// lookupBackend counts the tx lookups made through it and announces each
+// looked up hash on looked. Lookups of a hash in hold wait until its channel
+// is closed.
+type lookupBackend struct {
+	*backends.SimulatedBackend
+	hold    map[common.Hash]chan struct{}
+	mu      sync.Mutex
+	lookups map[common.Hash]int
+	looked  chan common.Hash
+}
+
+func newLookupBackend(sim *backends.SimulatedBackend) *lookupBackend {
+	return &lookupBackend{
+		SimulatedBackend: sim,
+		hold:             make(map[common.Hash]chan struct{}),
+		lookups:          make(map[common.Hash]int),
+		looked:           make(chan common.Hash, 16),
+	}
+}
+
+func (b *lookupBackend) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	b.mu.Lock()
+	b.lookups[hash]++
+	b.mu.Unlock()
+	b.looked <- hash
+	if hold, ok := b.hold[hash]; ok {
+		select {
+		case <-hold:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	return b.SimulatedBackend.TransactionByHash(ctx, hash)
+}
+
+func (b *lookupBackend) lookupCount(hash common.Hash) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lookups[hash]
+}
+
+// waitLookup waits until hash is looked up.
+func (b *lookupBackend) waitLookup(t *testing.T, hash common.Hash) {
+	t.Helper()
+
+	for {
+		select {
+		case looked := <-b.looked:
+			if looked == hash {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s never looked up", hash)
+		}
+	}
+}
+
+// startWatchPending runs watchPending on a test subscription until the test
+// ends, and returns the channel announcing pending hashes.
+func startWatchPending(t *testing.T, chain *Chain) chan<- common.Hash {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	txChan := make(chan common.Hash)
+	done := make(chan error, 1)
+	go func() { done <- chain.watchPending(ctx, newTestSubscription(), txChan) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watchPending() = %v, want nil once cancelled", err)
+		}
+	})
+	return txChan
+}
+
+func TestWatchPendingSkipsSeenHashes(t *testing.T) {
+	sim, _ := newSimulatedBackend(t)
+	backend := newLookupBackend(sim)
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, NewAccountStore(nil), Options{Workers: 1})
+	txChan := startWatchPending(t, chain)
+
+	hash, next := common.HexToHash("0x01"), common.HexToHash("0x02")
+	txChan <- hash
+	txChan <- hash
+	txChan <- next
+	// A single worker looks hashes up in order.
+	backend.waitLookup(t, next)
+
+	if n := backend.lookupCount(hash); n != 1 {
+		t.Fatalf("hash looked up %d times, want 1", n)
+	}
+}
+
+func TestWatchPendingForgetsEvictedHashes(t *testing.T) {
+	sim, _ := newSimulatedBackend(t)
+	backend := newLookupBackend(sim)
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, NewAccountStore(nil), Options{Workers: 1, SeenCacheSize: 1})
+	txChan := startWatchPending(t, chain)
+
+	hash, next, last := common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")
+	txChan <- hash
+	txChan <- next
+	txChan <- hash
+	txChan <- last
+	backend.waitLookup(t, last)
+
+	if n := backend.lookupCount(hash); n != 2 {
+		t.Fatalf("hash looked up %d times, want 2 once evicted", n)
+	}
+}
+
+func TestWatchPendingLooksUpConcurrently(t *testing.T) {
+	sim, _ := newSimulatedBackend(t)
+	backend := newLookupBackend(sim)
+	slow, fast := common.HexToHash("0x01"), common.HexToHash("0x02")
+	release := make(chan struct{})
+	backend.hold[slow] = release
+	defer close(release)
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, NewAccountStore(nil), Options{Workers: 2})
+	txChan := startWatchPending(t, chain)
+
+	txChan <- slow
+	backend.waitLookup(t, slow)
+	txChan <- fast
+	backend.waitLookup(t, fast)
+}
+
+func TestLockAccountSerializesAccounts(t *testing.T) {
+	chain := NewChain(nil, nil, types.LatestSignerForChainID(big.NewInt(1)), testReceiverAddress, NewAccountStore(nil), Options{})
+	account, other := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+
+	unlock := chain.lockAccount(account)
+
+	// Another account isn't held up.
+	chain.lockAccount(other)()
+
+	locked := make(chan struct{})
+	go func() {
+		chain.lockAccount(account)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("account locked twice at once")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("account never unlocked")
+	}
+}
+
+// simulatingBackend records the calls made through it, failing them with
+// err when it's set.
+type simulatingBackend struct {
+	*recordingBackend
+	err   error
+	mu    sync.Mutex
+	calls []ethereum.CallMsg
+}
+
+func (b *simulatingBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	b.mu.Lock()
+	b.calls = append(b.calls, call)
+	b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.recordingBackend.CallContract(ctx, call, blockNumber)
+}
+
+// newSimulatingChain returns a recording chain simulating replacements
+// before sending them.
+func newSimulatingChain(t *testing.T, err error, keys ...*ecdsa.PrivateKey) (*Chain, *simulatingBackend) {
+	t.Helper()
+
+	chain, recording := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, SimulateBeforeSend: true}, keys...)
+	backend := &simulatingBackend{recordingBackend: recording, err: err}
+	chain.eth = backend
+	return chain, backend
+}
+
+func TestReplacePendingSimulatesBeforeSending(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newSimulatingChain(t, nil, key)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the simulated replacement", len(sent))
+	}
+	if len(backend.calls) != 1 {
+		t.Fatalf("simulated %d times, want 1", len(backend.calls))
+	}
+	call := backend.calls[0]
+	if call.From != account || *call.To != testReceiverAddress || call.Value.Cmp(sent[0].Value()) != 0 {
+		t.Fatalf("simulated %+v, want the replacement from the account", call)
+	}
+}
+
+func TestReplacePendingSkipsRevertingReplacements(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newSimulatingChain(t, errors.New("execution reverted"), key)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+
+	if len(backend.calls) != 1 {
+		t.Fatalf("simulated %d times, want 1", len(backend.calls))
+	}
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs, want none after the simulation reverted", len(sent))
+	}
+}
+
+// replaceTestTransfer has a recording chain defending key replace a
+// transfer of value to to, and returns what the chain sent.
+func replaceTestTransfer(t *testing.T, opts Options, key *ecdsa.PrivateKey, to common.Address, value *big.Int) []*types.Transaction {
+	t.Helper()
+
+	opts.BumpPercent = defaultBumpPercent
+	chain, backend := newRecordingChain(t, opts, key)
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, to, 0, value, big.NewInt(params.GWei)), time.Now())
+	return backend.sentTxs()
+}
+
+func TestReplacePendingMinValue(t *testing.T) {
+	minValue := big.NewInt(params.Ether / 10)
+	tests := []struct {
+		name  string
+		value *big.Int
+		sends int
+	}{
+		{"just below", new(big.Int).Sub(minValue, big.NewInt(1)), 0},
+		{"at the minimum", minValue, 1},
+		{"just above", new(big.Int).Add(minValue, big.NewInt(1)), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, _ := newTestKey(t)
+			if sent := replaceTestTransfer(t, Options{MinValue: minValue}, key, testAttacker, test.value); len(sent) != test.sends {
+				t.Fatalf("sent %d txs, want %d", len(sent), test.sends)
+			}
+		})
+	}
+}
+
+func TestReplacePendingWhitelist(t *testing.T) {
+	trusted := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	opts := Options{Whitelist: map[common.Address]bool{trusted: true}}
+
+	key, _ := newTestKey(t)
+	if sent := replaceTestTransfer(t, opts, key, trusted, big.NewInt(params.Ether/2)); len(sent) != 0 {
+		t.Fatalf("sent %d txs for a whitelisted destination, want none", len(sent))
+	}
+	if sent := replaceTestTransfer(t, opts, key, testAttacker, big.NewInt(params.Ether/2)); len(sent) != 1 {
+		t.Fatalf("sent %d txs for another destination, want the replacement", len(sent))
+	}
+}
+
+func TestReplacePendingSkipsEdgeTxs(t *testing.T) {
+	key, account := newTestKey(t)
+
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	create, err := types.SignNewTx(key, chain.signer, &types.LegacyTx{
+		Value:    big.NewInt(params.Ether / 2),
+		Gas:      100_000,
+		GasPrice: big.NewInt(params.GWei),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.replacePending(context.Background(), create, time.Now())
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs for a contract creation, want none", len(sent))
+	}
+
+	if sent := replaceTestTransfer(t, Options{}, key, account, big.NewInt(params.Ether/2)); len(sent) != 0 {
+		t.Fatalf("sent %d txs for a self-send, want none", len(sent))
+	}
+
+	// The account is its own receiver.
+	opts := Options{Receivers: map[common.Address]common.Address{account: account}}
+	if sent := replaceTestTransfer(t, opts, key, testAttacker, big.NewInt(params.Ether/2)); len(sent) != 0 {
+		t.Fatalf("sent %d txs for a tx from the receiver, want none", len(sent))
+	}
+}
+
+// panickingSigner panics recovering any sender, like a bug triggered by a
+// malformed tx.
+type panickingSigner struct {
+	types.Signer
+}
+
+func (panickingSigner) Sender(tx *types.Transaction) (common.Address, error) {
+	panic("malformed tx")
+}
+
+func TestWatchPendingSurvivesPanickingTxs(t *testing.T) {
+	key, _ := newTestKey(t)
+	sim, accounts := newSimulatedBackend(t, key)
+	backend := newLookupBackend(sim)
+	signer := simulatedSigner(sim)
+	chain := NewChain(backend, nil, panickingSigner{signer}, testReceiverAddress, accounts, Options{Workers: 1})
+	txChan := startWatchPending(t, chain)
+
+	// A tx the node knows, so the worker gets as far as its sender.
+	tx := signTestTx(t, signer, key, testAttacker, 0, big.NewInt(1), big.NewInt(params.GWei))
+	if err := sim.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	next := common.HexToHash("0x02")
+	txChan <- tx.Hash()
+	txChan <- next
+	// The only worker is still around to look the next hash up.
+	backend.waitLookup(t, next)
+}
+
+func TestConnectRetries(t *testing.T) {
+	node := &testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)}
+	url := newTestNode(t, node)
+	ctx := context.Background()
+
+	node.chainIDFailures.Store(2)
+	chain, err := Connect(ctx, url, testReceiverAddress, NewAccountStore(nil), Options{ConnectRetries: 2, ConnectRetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Connect() = %v, want it to succeed on the third attempt", err)
+	}
+	if chain.signer.ChainID().Int64() != node.chainID {
+		t.Fatalf("chain ID = %s, want %d", chain.signer.ChainID(), node.chainID)
+	}
+
+	node.chainIDFailures.Store(2)
+	if _, err := Connect(ctx, url, testReceiverAddress, NewAccountStore(nil), Options{ConnectRetries: 1, ConnectRetryDelay: time.Millisecond}); err == nil {
+		t.Fatal("Connect() succeeded with fewer retries than failures")
+	}
+}
+
+func TestScanPendingResubscribesWhenStalled(t *testing.T) {
+	source := newTestPendingSource()
+	chain := NewChain(nil, source, types.LatestSignerForChainID(big.NewInt(1)), testReceiverAddress, NewAccountStore(nil), Options{StallTimeout: 20 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- chain.ScanPending(ctx) }()
+
+	// The first subscription goes silent without failing.
+	silent := source.nextSubscription(t)
+	source.nextSubscription(t)
+	select {
+	case <-silent.err:
+	default:
+		t.Fatal("stalled subscription wasn't torn down")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ScanPending() = %v, want nil once cancelled", err)
+	}
+}
+
+func TestWatchPendingStallsWithoutHashes(t *testing.T) {
+	chain := NewChain(nil, nil, types.LatestSignerForChainID(big.NewInt(1)), testReceiverAddress, NewAccountStore(nil), Options{StallTimeout: 10 * time.Millisecond})
+
+	err := chain.watchPending(context.Background(), newTestSubscription(), make(chan common.Hash))
+	if !errors.Is(err, errStalled) {
+		t.Fatalf("watchPending() = %v, want %v", err, errStalled)
+	}
+}
+
+func TestSupportsSubscriptions(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     bool
+		wantErr  bool
+	}{
+		{"ws://localhost:8546", true, false},
+		{"wss://mainnet.example.com/v3/key", true, false},
+		{"ipc:///var/run/geth.ipc", true, false},
+		{"/var/run/geth.ipc", true, false},
+		{"http://localhost:8545", false, false},
+		{"https://mainnet.example.com/v3/key", false, false},
+		{"ftp://localhost", false, true},
+	}
+	for _, test := range tests {
+		got, err := supportsSubscriptions(test.endpoint)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("supportsSubscriptions(%q) = %v, %v, want %v, error %v", test.endpoint, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestRateLimitDropsLookups(t *testing.T) {
+	sim, _ := newSimulatedBackend(t)
+	backend := newLookupBackend(sim)
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, NewAccountStore(nil), Options{RPCRate: 0.001, RPCBurst: 3})
+	hash := common.HexToHash("0x01")
+
+	limited := 0
+	for i := 0; i < 5; i++ {
+		if _, err := chain.transactionByHash(context.Background(), hash); errors.Is(err, errRateLimited) {
+			limited++
+		}
+	}
+	if n := backend.lookupCount(hash); n != 3 || limited != 2 {
+		t.Fatalf("%d lookups made and %d dropped, want the burst of 3 made and 2 dropped", n, limited)
+	}
+}
+
+func TestRateLimitDelaysSends(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{RPCRate: 20, RPCBurst: 1}, key)
+
+	start := time.Now()
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx := signTestTx(t, chain.signer, key, testReceiverAddress, nonce, big.NewInt(1), big.NewInt(params.GWei))
+		if err := chain.sendTransaction(context.Background(), tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Sends wait for the limiter instead of being dropped.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("3 sends at 20/s took %s, want at least 100ms", elapsed)
+	}
+	if sent := backend.sentTxs(); len(sent) != 3 {
+		t.Fatalf("sent %d txs, want 3", len(sent))
+	}
+}
+
+func TestReplacePendingBlacklists(t *testing.T) {
+	dodgy := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	opts := Options{BlacklistTokens: map[common.Address]bool{testToken: true}, BlacklistDestinations: map[common.Address]bool{dodgy: true}}
+	rescues, err := newRescueSet(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Rescues = rescues
+
+	key, _ := newTestKey(t)
+	if sent := replaceTestTransfer(t, opts, key, dodgy, big.NewInt(params.Ether/2)); len(sent) != 0 {
+		t.Fatalf("sent %d txs for a blacklisted destination, want none", len(sent))
+	}
+
+	opts.BumpPercent = defaultBumpPercent
+	tests := []struct {
+		name  string
+		token common.Address
+		to    common.Address
+		sends int
+	}{
+		{"blacklisted token", testToken, testAttacker, 0},
+		{"transfer to a blacklisted destination", common.HexToAddress("0x4444444444444444444444444444444444444444"), dodgy, 0},
+		{"other token", common.HexToAddress("0x4444444444444444444444444444444444444444"), testAttacker, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, backend := newRecordingChain(t, opts, key)
+			orig := signTestCall(t, chain.signer, key, test.token, 0, transferData(test.to, big.NewInt(1_000_000)))
+			chain.replacePending(context.Background(), orig, time.Now())
+			if sent := backend.sentTxs(); len(sent) != test.sends {
+				t.Fatalf("sent %d txs, want %d", len(sent), test.sends)
+			}
+		})
+	}
+}
+
+// blobNode serves every tx as an EIP-4844 blob tx.
+type blobNode struct {
+	*testNode
+}
+
+func (blobNode) GetTransactionByHash(hash common.Hash) map[string]any {
+	return map[string]any{"type": "0x3", "hash": hash, "nonce": "0x0"}
+}
+
+func TestReplaceFoundSkipsBlobTxs(t *testing.T) {
+	node := blobNode{&testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)}}
+	chain, err := Connect(context.Background(), newTestNode(t, node), testReceiverAddress, NewAccountStore(nil), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := common.HexToHash("0x01")
+
+	if _, err := chain.transactionByHash(context.Background(), hash); !errors.Is(err, types.ErrTxTypeNotSupported) {
+		t.Fatalf("transactionByHash() = %v, want %v", err, types.ErrTxTypeNotSupported)
+	}
+	// Skipped for good rather than looked up again.
+	if missing := chain.replaceFound(context.Background(), []pendingHash{{hash: hash}}); len(missing) != 0 {
+		t.Fatalf("replaceFound() = %v, want the blob tx skipped", missing)
+	}
+}
+
+// estimateBackend answers gas estimates with gas, or err when it's set.
+type estimateBackend struct {
+	*recordingBackend
+	gas uint64
+	err error
+}
+
+func (b *estimateBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return b.gas, b.err
+}
+
+// newEstimatingChain returns a recording chain defending key whose gas
+// estimates are gas, or fail with err.
+func newEstimatingChain(t *testing.T, opts Options, gas uint64, err error, key *ecdsa.PrivateKey) (*Chain, *estimateBackend) {
+	t.Helper()
+
+	chain, recording := newRecordingChain(t, opts, key)
+	backend := &estimateBackend{recordingBackend: recording, gas: gas, err: err}
+	chain.eth = backend
+	return chain, backend
+}
+
+func TestReplacementGas(t *testing.T) {
+	key, account := newTestKey(t)
+	orig := signTestTx(t, types.HomesteadSigner{}, key, testAttacker, 0, big.NewInt(1), big.NewInt(params.GWei))
+
+	tests := []struct {
+		name string
+		gas  uint64
+		err  error
+		opts Options
+		want uint64
+	}{
+		{"plain transfer", transferGas, nil, Options{}, transferGas},
+		{"estimate with headroom", 40_000, nil, Options{GasMultiplier: 1.5}, 60_000},
+		{"default headroom", 40_000, nil, Options{}, 48_000},
+		{"override", 40_000, nil, Options{GasLimitOverride: 90_000}, 90_000},
+		{"failed estimate", 0, errors.New("execution reverted"), Options{}, orig.Gas()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, _ := newEstimatingChain(t, test.opts, test.gas, test.err, key)
+			if got := chain.replacementGas(context.Background(), account, orig, testReceiverAddress); got != test.want {
+				t.Fatalf("replacementGas() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplacePendingUsesEstimatedGas(t *testing.T) {
+	key, _ := newTestKey(t)
+	rescues, err := newRescueSet(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The estimate replaces the original's gas limit.
+	chain, backend := newEstimatingChain(t, Options{BumpPercent: defaultBumpPercent, Rescues: rescues, GasMultiplier: 1}, 52_000, nil, key)
+
+	orig := signTestCall(t, chain.signer, key, testToken, 0, transferData(testAttacker, big.NewInt(1)))
+	chain.replacePending(context.Background(), orig, time.Now())
+	if sent := backend.sentTxs(); len(sent) != 1 || sent[0].Gas() != 52_000 {
+		t.Fatalf("sent %d txs, want the rescue with the estimated gas", len(sent))
+	}
+}
+
+// pendingNode announces hash to every pending tx subscription.
+type pendingNode struct {
+	*testNode
+	hash common.Hash
+}
+
+func (n pendingNode) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go notifier.Notify(sub.ID, n.hash)
+	return sub, nil
+}
+
+// newIPCNode serves the eth_ methods of service on an IPC socket and
+// returns its path.
+func newIPCNode(t *testing.T, service any) string {
+	t.Helper()
+
+	// Socket paths are limited to about a hundred bytes, test temp dirs may
+	// be longer.
+	dir, err := os.MkdirTemp("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "geth.ipc")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeListener(listener)
+	t.Cleanup(func() {
+		listener.Close()
+		server.Stop()
+	})
+	return path
+}
+
+func TestConnectOverIPC(t *testing.T) {
+	hash := common.HexToHash("0x01")
+	path := newIPCNode(t, pendingNode{&testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)}, hash})
+
+	for _, endpoint := range []string{path, "ipc://" + path} {
+		if ok, err := supportsSubscriptions(endpoint); !ok || err != nil {
+			t.Fatalf("supportsSubscriptions(%q) = %v, %v, want true", endpoint, ok, err)
+		}
+		chain, err := Connect(context.Background(), endpoint, testReceiverAddress, NewAccountStore(nil), Options{})
+		if err != nil {
+			t.Fatalf("Connect(%q) = %v", endpoint, err)
+		}
+
+		// Pending subscriptions work over the socket.
+		hashes := make(chan common.Hash, 1)
+		sub, err := chain.geth.SubscribePendingTransactions(context.Background(), hashes)
+		if err != nil {
+			t.Fatalf("couldn't subscribe over %q: %v", endpoint, err)
+		}
+		select {
+		case got := <-hashes:
+			if got != hash {
+				t.Fatalf("got pending hash %s, want %s", got, hash)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no pending hash over IPC")
+		}
+		sub.Unsubscribe()
+	}
+}
+
+func TestDialTarget(t *testing.T) {
+	tests := map[string]string{
+		"ipc:///var/run/geth.ipc": "/var/run/geth.ipc",
+		"/var/run/geth.ipc":       "/var/run/geth.ipc",
+		"ws://localhost:8546":     "ws://localhost:8546",
+	}
+	for endpoint, want := range tests {
+		if got := dialTarget(endpoint); got != want {
+			t.Errorf("dialTarget(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
+
+func TestConnectChecksExpectedChainID(t *testing.T) {
+	node := &testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)}
+	url := newTestNode(t, node)
+	ctx := context.Background()
+
+	if _, err := Connect(ctx, url, testReceiverAddress, NewAccountStore(nil), Options{ExpectedChainID: big.NewInt(1337)}); err != nil {
+		t.Fatalf("Connect() to the expected chain = %v", err)
+	}
+
+	// A mismatch isn't retried, the node won't change chains.
+	_, err := Connect(ctx, url, testReceiverAddress, NewAccountStore(nil), Options{ExpectedChainID: big.NewInt(1), ConnectRetryDelay: time.Hour})
+	if !errors.Is(err, ErrChainIDMismatch) {
+		t.Fatalf("Connect() to another chain = %v, want %v", err, ErrChainIDMismatch)
+	}
+}
+
+func TestReplacePendingAttachesReceiverData(t *testing.T) {
+	key, _ := newTestKey(t)
+	data := common.FromHex("0xd0e30db0")
+	chain, backend := newEstimatingChain(t, Options{BumpPercent: defaultBumpPercent, ReceiverData: data, GasMultiplier: 1}, 45_000, nil, key)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the replacement", len(sent))
+	}
+	if !bytes.Equal(sent[0].Data(), data) || sent[0].Gas() != 45_000 {
+		t.Fatalf("replacement data %x gas %d, want %x with the estimated 45000", sent[0].Data(), sent[0].Gas(), data)
+	}
+}
+
+func TestReplacePendingSweepsFullBalance(t *testing.T) {
+	key, _ := newTestKey(t)
+	reserve := big.NewInt(params.Ether / 100)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, SweepFullBalance: true, GasReserve: reserve}, key)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/10), big.NewInt(params.GWei)), time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the replacement", len(sent))
+	}
+	// The simulated backend funds accounts with an ether.
+	fee := new(big.Int).Mul(sent[0].GasFeeCap(), new(big.Int).SetUint64(sent[0].Gas()))
+	want := new(big.Int).Sub(big.NewInt(params.Ether), fee)
+	want.Sub(want, reserve)
+	if sent[0].Value().Cmp(want) != 0 {
+		t.Fatalf("replacement value = %s, want the balance %s minus fees and reserve", sent[0].Value(), want)
+	}
+}
+
+func TestReplacePendingActiveAccounts(t *testing.T) {
+	key, account := newTestKey(t)
+	otherKey, other := newTestKey(t)
+
+	tests := []struct {
+		name   string
+		active map[common.Address]bool
+		sends  int
+	}{
+		{"all active", nil, 2},
+		{"allowlisted", map[common.Address]bool{account: true}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, ActiveAccounts: test.active}, key, otherKey)
+			ctx := context.Background()
+
+			chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+			chain.replacePending(ctx, signTestTx(t, chain.signer, otherKey, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+			sent := backend.sentTxs()
+			if len(sent) != test.sends {
+				t.Fatalf("sent %d txs, want %d", len(sent), test.sends)
+			}
+			for _, tx := range sent {
+				if from, _ := types.Sender(chain.signer, tx); test.active != nil && from == other {
+					t.Fatalf("replaced a tx of inactive %s", other)
+				}
+			}
+		})
+	}
+}
+
+func TestReplacePendingSkipsTxsOfTheReceiver(t *testing.T) {
+	key, account := newTestKey(t)
+	sim, accounts := newSimulatedBackend(t, key)
+	backend := &recordingBackend{SimulatedBackend: sim}
+	chain := NewChain(backend, nil, simulatedSigner(sim), account, accounts, Options{BumpPercent: defaultBumpPercent})
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs replacing the receiver's own tx, want none", len(sent))
+	}
+}
+
+func TestConnectDetectsLondon(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseFee *big.Int
+		want    bool
+	}{
+		{"london", big.NewInt(params.GWei), true},
+		{"pre-london", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url := newTestNode(t, &testNode{chainID: 1337, baseFee: test.baseFee})
+			chain, err := Connect(context.Background(), url, testReceiverAddress, NewAccountStore(nil), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chain.london != test.want {
+				t.Fatalf("london = %v, want %v", chain.london, test.want)
+			}
+		})
+	}
+}
+
+func TestReplacePendingOnPreLondonChain(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	chain.london = false
+
+	orig, err := types.SignNewTx(key, chain.signer, &types.DynamicFeeTx{
+		ChainID:   chain.signer.ChainID(),
+		To:        &testAttacker,
+		Value:     big.NewInt(params.Ether / 2),
+		Gas:       transferGas,
+		GasTipCap: big.NewInt(params.GWei),
+		GasFeeCap: big.NewInt(10 * params.GWei),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.replacePending(context.Background(), orig, time.Now())
+	if sent := backend.sentTxs(); len(sent) != 1 || sent[0].Type() != types.LegacyTxType {
+		t.Fatalf("sent %d txs, want a legacy replacement", len(sent))
+	}
+}
+
+func TestReplacePendingSkipsReplacedNonces(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	// The same original seen again, e.g. from another endpoint.
+	orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+	chain.replacePending(ctx, orig, time.Now())
+	chain.replacePending(ctx, orig, time.Now())
+	// A different tx of the nonce our replacement already outbids.
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/4), big.NewInt(11*params.GWei/10)), time.Now())
+	if sent := backend.sentTxs(); len(sent) != 1 {
+		t.Fatalf("sent %d txs, want one replacement of the nonce", len(sent))
+	}
+
+	// The attacker outbidding our replacement is replaced again.
+	rebid := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(2*params.GWei))
+	chain.replacePending(ctx, rebid, time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 2 || !outbids(sent[1], rebid) {
+		t.Fatalf("sent %d txs, want a replacement outbidding the rebid", len(sent))
+	}
+	if got, _ := chain.replaced.Get(inflightKey{from: account, nonce: 0}); got.Hash() != sent[1].Hash() {
+		t.Fatal("the latest replacement isn't recorded")
+	}
+}
+
+func TestReplacePendingCancelMode(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, CancelMode: true}, key)
+
+	orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+	chain.replacePending(context.Background(), orig, time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the cancel", len(sent))
+	}
+	if !isCancel(account, sent[0]) || sent[0].Nonce() != orig.Nonce() || !outbids(sent[0], orig) {
+		t.Fatalf("sent nonce %d to %s value %s, want a bumped zero-value self-send", sent[0].Nonce(), sent[0].To(), sent[0].Value())
+	}
+}
+
+func TestReplacePendingZeroValueCalls(t *testing.T) {
+	// setApprovalForAll(attacker, true), calldata without native value.
+	data := callData([]byte{0xa2, 0x2c, 0xb4, 0x65}, common.LeftPadBytes(testAttacker.Bytes(), 32), common.LeftPadBytes([]byte{1}, 32))
+
+	tests := []struct {
+		mode       string
+		wantCancel bool
+		wantLog    string
+	}{
+		{ZeroValueLog, false, "suspicious zero-value call"},
+		{ZeroValueCancel, true, "cancelling zero-value call"},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			logs := captureLogs(t)
+			key, account := newTestKey(t)
+			chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, ZeroValueCalls: test.mode}, key)
+
+			orig := signTestCall(t, chain.signer, key, testAttacker, 0, data)
+			chain.replacePending(context.Background(), orig, time.Now())
+			if !strings.Contains(logs.String(), test.wantLog) {
+				t.Fatalf("logs = %s, want %q", logs, test.wantLog)
+			}
+			sent := backend.sentTxs()
+			if !test.wantCancel {
+				if len(sent) != 0 {
+					t.Fatalf("sent %d txs, want the call only logged", len(sent))
+				}
+				return
+			}
+			if len(sent) != 1 || !isCancel(account, sent[0]) || !outbids(sent[0], orig) {
+				t.Fatalf("sent %d txs, want a cancel of the call", len(sent))
+			}
+		})
+	}
+}
+
+// notFoundBackend is a recordingBackend whose node knows tx only after
+// misses lookups of it.
+type notFoundBackend struct {
+	*recordingBackend
+	tx *types.Transaction
+
+	mu      sync.Mutex
+	misses  int
+	lookups int
+}
+
+func (b *notFoundBackend) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lookups++
+	if hash != b.tx.Hash() || b.lookups <= b.misses {
+		return nil, false, ethereum.NotFound
+	}
+	return b.tx, true, nil
+}
+
+func (b *notFoundBackend) lookupCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lookups
+}
+
+func TestWatchPendingRetriesNotFoundHashes(t *testing.T) {
+	tests := []struct {
+		name        string
+		misses      int
+		wantLookups int
+		wantSends   int
+	}{
+		{"found on the third lookup", 2, 3, 1},
+		{"never found", 100, 3, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, _ := newTestKey(t)
+			opts := Options{BumpPercent: defaultBumpPercent, Workers: 1, NotFoundRetries: 2, NotFoundRetryDelay: time.Millisecond}
+			chain, recording := newRecordingChain(t, opts, key)
+			orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+			backend := &notFoundBackend{recordingBackend: recording, tx: orig, misses: test.misses}
+			chain.eth = backend
+
+			startWatchPending(t, chain) <- orig.Hash()
+			waitFor(t, func() bool { return backend.lookupCount() >= test.wantLookups })
+			if test.wantSends > 0 {
+				waitFor(t, func() bool { return len(recording.sentTxs()) == test.wantSends })
+			}
+
+			// Retries stop once the hash is found or given up on.
+			time.Sleep(20 * time.Millisecond)
+			if got := backend.lookupCount(); got != test.wantLookups {
+				t.Fatalf("looked the hash up %d times, want %d", got, test.wantLookups)
+			}
+			if sent := recording.sentTxs(); len(sent) != test.wantSends {
+				t.Fatalf("sent %d txs, want %d", len(sent), test.wantSends)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// chainSet runs a ChainRunner for every enabled chain, starting and stopping
+// them as the config changes.
+type chainSet struct {
+	ctx      context.Context
+	accounts *AccountStore
+	opts     Options
+
+	slots   chainSlots
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	// started, active and failed count the chains started, still running
+	// and stopped on an error.
+	started, active, failed int
+	// idle is closed once no chain is left running after one failed.
+	idle chan struct{}
+}
+
+func newChainSet(ctx context.Context, accounts *AccountStore, opts Options, maxConcurrent int) *chainSet {
+	return &chainSet{ctx: ctx, accounts: accounts, opts: opts, slots: newChainSlots(maxConcurrent), running: make(map[string]context.CancelFunc), idle: make(chan struct{})}
+}
+
+// chainSlots bounds how many chains run at once, a nil one doesn't.
+type chainSlots chan struct{}
+
+func newChainSlots(n int) chainSlots {
+	if n <= 0 {
+		return nil
+	}
+	return make(chainSlots, n)
+}
+
+// acquire blocks until a slot is free, it reports false if ctx is done
+// first.
+func (s chainSlots) acquire(ctx context.Context, name string) bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+	}
+
+	slog.Info("chain queued, waiting for a free slot", "chain", name, "max_concurrent_chains", cap(s))
+	select {
+	case s <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s chainSlots) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// apply starts the enabled chains of config that aren't running yet and stops
+// the disabled ones. Chains already running keep their settings.
+func (s *chainSet) apply(config Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, chainConfig := range config.ChainConfigs() {
+		name := chainConfig.Name
+		cancel, running := s.running[name]
+
+		if !chainConfig.enabled() {
+			if running {
+				slog.Info("chain disabled, stopping it", "chain", name)
+				cancel()
+				delete(s.running, name)
+			} else {
+				slog.Info("chain disabled, not starting it", "chain", name)
+			}
+			continue
+		}
+		if running {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(s.ctx)
+		s.running[name] = cancel
+		runner := newRunner(config, chainConfig, s.accounts, s.opts)
+
+		s.wg.Add(1)
+		s.started++
+		s.active++
+		go func() {
+			defer s.wg.Done()
+			s.stopped(s.runChain(ctx, name, runner))
+		}()
+	}
+}
+
+func (s *chainSet) runChain(ctx context.Context, name string, runner *ChainRunner) error {
+	if !s.slots.acquire(ctx, name) {
+		return nil
+	}
+	defer s.slots.release()
+
+	slog.Info("starting chain", "chain", name)
+	if err := runner.Run(ctx); err != nil {
+		slog.Error("chain failed", "chain", name, "err", err)
+		return err
+	}
+	slog.Info("chain stopped", "chain", name)
+	return nil
+}
+
+// stopped records that a chain stopped with err.
+func (s *chainSet) stopped(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	if err != nil {
+		s.failed++
+	}
+	if s.active == 0 && s.failed > 0 {
+		select {
+		case <-s.idle:
+		default:
+			close(s.idle)
+		}
+	}
+}
+
+// newRunner returns the runner of chainConfig, with opts adjusted to its
+// per-chain settings.
+func newRunner(config Config, chainConfig ChainConfig, accounts *AccountStore, opts Options) *ChainRunner {
+	opts.SplitReceivers = config.splitFor(chainConfig)
+	opts.ChainName = chainConfig.Name
+	opts.ExpectedChainID = chainConfig.ExpectedChainID
+	if chainConfig.BumpPercent != 0 {
+		opts.BumpPercent = chainConfig.BumpPercent
+	}
+	if chainConfig.MaxGasPrice != nil {
+		opts.MaxGasPrice = chainConfig.MaxGasPrice
+	}
+	return NewChainRunner(chainConfig, config.receiverFor(chainConfig), accounts, opts)
+}
+
+// wait blocks until every started chain has stopped. It fails with
+// ErrAllChainsFailed or ErrSomeChainsFailed if any stopped on an error.
+func (s *chainSet) wait() error {
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.failed == 0:
+		return nil
+	case s.failed == s.started:
+		return ErrAllChainsFailed
+	default:
+		return fmt.Errorf("%w: %d of %d", ErrSomeChainsFailed, s.failed, s.started)
+	}
+}
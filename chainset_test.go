@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// runningChains returns the names of the chains s runs.
+func runningChains(s *chainSet) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.running))
+	for name := range s.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestChainSetSkipsDisabledChains(t *testing.T) {
+	disabled := false
+	// Nothing listens on port 1, the runners keep failing to connect.
+	endpoints := []Endpoint{{URL: "http://127.0.0.1:1"}}
+	config := Config{
+		Receiver: testReceiverAddress,
+		Chains: []ChainConfig{
+			{Name: "mainnet", Endpoints: endpoints},
+			{Name: "sepolia", Endpoints: endpoints, Enabled: &disabled},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	chains := newChainSet(ctx, NewAccountStore(nil), Options{ConnectRetries: 1, ConnectRetryDelay: time.Millisecond}, 0)
+	defer func() {
+		cancel()
+		chains.wait()
+	}()
+
+	chains.apply(config)
+	if got := runningChains(chains); len(got) != 1 || got[0] != "mainnet" {
+		t.Fatalf("running %v, want only mainnet", got)
+	}
+
+	// Toggling on reload stops and starts chains.
+	enabled := true
+	config.Chains[0].Enabled, config.Chains[1].Enabled = &disabled, &enabled
+	chains.apply(config)
+	if got := runningChains(chains); len(got) != 1 || got[0] != "sepolia" {
+		t.Fatalf("running %v after toggling, want only sepolia", got)
+	}
+}
+
+func TestChainSetReportsFailedChains(t *testing.T) {
+	wrong := []Endpoint{{URL: newTestNode(t, &testNode{chainID: 1})}}
+	right := []Endpoint{{URL: newTestNode(t, &testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)})}}
+	opts := Options{ConnectRetries: 1, ConnectRetryDelay: time.Millisecond, PollInterval: 10 * time.Millisecond}
+
+	t.Run("all", func(t *testing.T) {
+		config := Config{
+			Receiver: testReceiverAddress,
+			Chains: []ChainConfig{
+				{Name: "mainnet", Endpoints: wrong, ExpectedChainID: big.NewInt(1337)},
+				{Name: "sepolia", Endpoints: wrong, ExpectedChainID: big.NewInt(1337)},
+			},
+		}
+		chains := newChainSet(context.Background(), NewAccountStore(nil), opts, 0)
+		chains.apply(config)
+
+		select {
+		case <-chains.idle:
+		case <-time.After(10 * time.Second):
+			t.Fatal("chain set never noticed every chain failed")
+		}
+		if err := chains.wait(); !errors.Is(err, ErrAllChainsFailed) {
+			t.Fatalf("wait() = %v, want %v", err, ErrAllChainsFailed)
+		}
+	})
+
+	t.Run("some", func(t *testing.T) {
+		config := Config{
+			Receiver: testReceiverAddress,
+			Chains: []ChainConfig{
+				{Name: "mainnet", Endpoints: wrong, ExpectedChainID: big.NewInt(1337)},
+				{Name: "sepolia", Endpoints: right, ExpectedChainID: big.NewInt(1337)},
+			},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		chains := newChainSet(ctx, NewAccountStore(nil), opts, 0)
+		chains.apply(config)
+
+		// Until the failed chain is counted.
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			chains.mu.Lock()
+			failed := chains.failed
+			chains.mu.Unlock()
+			if failed > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("mismatched chain never failed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		select {
+		case <-chains.idle:
+			t.Fatal("chain set idle while sepolia is still running")
+		default:
+		}
+
+		cancel()
+		if err := chains.wait(); !errors.Is(err, ErrSomeChainsFailed) {
+			t.Fatalf("wait() = %v, want %v", err, ErrSomeChainsFailed)
+		}
+	})
+}
+
+func TestNewRunnerExpectsChainID(t *testing.T) {
+	chainConfig := ChainConfig{Name: "mainnet", ExpectedChainID: big.NewInt(1)}
+	runner := newRunner(Config{Receiver: testReceiverAddress}, chainConfig, NewAccountStore(nil), Options{})
+	if runner.opts.ExpectedChainID.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("runner expects chain ID %v, want 1", runner.opts.ExpectedChainID)
+	}
+}
+
+func TestChainSlotsBoundConcurrency(t *testing.T) {
+	slots := newChainSlots(2)
+	var (
+		wg                    sync.WaitGroup
+		mu                    sync.Mutex
+		running, maxSeen, ran int
+	)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !slots.acquire(context.Background(), "test") {
+				t.Error("acquire() failed without a cancelled context")
+				return
+			}
+			defer slots.release()
+
+			mu.Lock()
+			running++
+			maxSeen = max(maxSeen, running)
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			ran++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if ran != 6 || maxSeen > 2 {
+		t.Fatalf("%d chains ran, at most %d at once, want 6 with at most 2", ran, maxSeen)
+	}
+}
+
+func TestChainSlotsAcquireGivesUpOnCancel(t *testing.T) {
+	slots := newChainSlots(1)
+	if !slots.acquire(context.Background(), "first") {
+		t.Fatal("acquire() of a free slot failed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if slots.acquire(ctx, "second") {
+		t.Fatal("acquire() of a taken slot succeeded after cancel")
+	}
+
+	// Without a limit every chain gets a slot.
+	unlimited := newChainSlots(0)
+	for i := 0; i < 3; i++ {
+		if !unlimited.acquire(ctx, "test") {
+			t.Fatal("acquire() without a limit failed")
+		}
+	}
+}
+
+func TestNewRunnerAppliesChainFeeOverrides(t *testing.T) {
+	globals := Options{BumpPercent: 15, MaxGasPrice: big.NewInt(100)}
+	tests := []struct {
+		name       string
+		chain      ChainConfig
+		wantBump   uint64
+		wantMaxGas int64
+	}{
+		{"globals", ChainConfig{Name: "mainnet"}, 15, 100},
+		{"bump override", ChainConfig{Name: "base", BumpPercent: 30}, 30, 100},
+		{"max gas price override", ChainConfig{Name: "arbitrum", MaxGasPrice: big.NewInt(5)}, 15, 5},
+	}
+	for _, test := range tests {
+		runner := newRunner(Config{Receiver: testReceiverAddress}, test.chain, NewAccountStore(nil), globals)
+		if runner.opts.BumpPercent != test.wantBump || runner.opts.MaxGasPrice.Int64() != test.wantMaxGas {
+			t.Errorf("%s: bump %d max gas price %s, want %d and %d", test.name, runner.opts.BumpPercent, runner.opts.MaxGasPrice, test.wantBump, test.wantMaxGas)
+		}
+	}
+	if globals.BumpPercent != 15 || globals.MaxGasPrice.Int64() != 100 {
+		t.Fatal("overrides changed the global options")
+	}
+}
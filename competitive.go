@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// feeSampleSize is how many recent pending txs competitive gas prices
+	// are taken from, and minFeeSamples how many it needs to trust them.
+	feeSampleSize = 1000
+	minFeeSamples = 20
+
+	defaultCompetitivePercentile = 90
+)
+
+// feeSamples remembers the fees of recently seen pending txs so replacements
+// can outbid most of the mempool rather than just the original.
+type feeSamples struct {
+	mu        sync.Mutex
+	gasPrices priceRing
+	feeCaps   priceRing
+	tips      priceRing
+}
+
+func newFeeSamples() *feeSamples {
+	return &feeSamples{gasPrices: newPriceRing(feeSampleSize), feeCaps: newPriceRing(feeSampleSize), tips: newPriceRing(feeSampleSize)}
+}
+
+// add samples tx. A legacy gas price is what the tx pays, a fee cap only
+// bounds it, so the two are sampled apart.
+func (s *feeSamples) add(tx *types.Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx.Type() == types.DynamicFeeTxType {
+		s.feeCaps.add(tx.GasFeeCap())
+		s.tips.add(tx.GasTipCap())
+		return
+	}
+	s.gasPrices.add(tx.GasPrice())
+}
+
+// percentile returns the gas price, fee cap and tip that percent% of the
+// samples don't exceed. Each is nil while there are too few samples of it.
+func (s *feeSamples) percentile(percent float64) (gasPrice, feeCap, tip *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.gasPrices.percentile(percent), s.feeCaps.percentile(percent), s.tips.percentile(percent)
+}
+
+// priceRing holds the last len(prices) prices added.
+type priceRing struct {
+	prices []*big.Int
+	next   int
+	full   bool
+}
+
+func newPriceRing(size int) priceRing {
+	return priceRing{prices: make([]*big.Int, size)}
+}
+
+func (r *priceRing) add(price *big.Int) {
+	r.prices[r.next] = new(big.Int).Set(price)
+	r.next = (r.next + 1) % len(r.prices)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *priceRing) percentile(percent float64) *big.Int {
+	n := r.next
+	if r.full {
+		n = len(r.prices)
+	}
+	if n < minFeeSamples {
+		return nil
+	}
+
+	sorted := make([]*big.Int, n)
+	copy(sorted, r.prices[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+
+	i := int(math.Ceil(percent/100*float64(n))) - 1
+	return sorted[min(max(i, 0), n-1)]
+}
+
+// fees returns the fee policy of replacements. With CompetitiveGas the
+// floors are raised to the configured percentile of recent pending fees,
+// still capped by MaxGasPrice.
+func (c *Chain) fees() feePolicy {
+	fees := c.opts.fees()
+	if !c.opts.CompetitiveGas {
+		return fees
+	}
+
+	gasPrice, feeCap, tip := c.feeSamples.percentile(c.opts.competitivePercentile())
+	fees.minGasPrice = maxPrice(fees.minGasPrice, gasPrice)
+	fees.minFeeCap = maxPrice(fees.minFeeCap, feeCap)
+	fees.minTip = maxPrice(fees.minTip, tip)
+	return fees
+}
+
+// maxPrice returns the higher of a and b, nil counting as no price.
+func maxPrice(a, b *big.Int) *big.Int {
+	if a == nil || (b != nil && b.Cmp(a) > 0) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestPriceRingPercentile(t *testing.T) {
+	ring := newPriceRing(100)
+	for i := int64(1); i < minFeeSamples; i++ {
+		ring.add(big.NewInt(i))
+	}
+	if got := ring.percentile(90); got != nil {
+		t.Fatalf("percentile() of %d samples = %s, want nil", minFeeSamples-1, got)
+	}
+
+	// 1 to 100 in shuffled order.
+	ring = newPriceRing(100)
+	for i := int64(0); i < 100; i++ {
+		ring.add(big.NewInt(i*37%100 + 1))
+	}
+	tests := []struct {
+		percent float64
+		want    int64
+	}{
+		{90, 90},
+		{50, 50},
+		{100, 100},
+		{0, 1},
+	}
+	for _, test := range tests {
+		if got := ring.percentile(test.percent); got.Int64() != test.want {
+			t.Errorf("percentile(%v) = %s, want %d", test.percent, got, test.want)
+		}
+	}
+
+	// Once full it keeps only the latest samples.
+	for i := 0; i < 100; i++ {
+		ring.add(big.NewInt(1000))
+	}
+	if got := ring.percentile(0); got.Int64() != 1000 {
+		t.Fatalf("percentile(0) = %s, want only the latest 1000s", got)
+	}
+}
+
+func TestFeeSamplesSplitTxTypes(t *testing.T) {
+	samples := newFeeSamples()
+	for i := int64(1); i <= minFeeSamples; i++ {
+		samples.add(newLegacyTx(0, 0, i*params.GWei))
+	}
+	gasPrice, feeCap, tip := samples.percentile(100)
+	if gasPrice.Int64() != minFeeSamples*params.GWei || feeCap != nil || tip != nil {
+		t.Fatalf("percentile() = %v, %v, %v, want only a gas price", gasPrice, feeCap, tip)
+	}
+
+	for i := int64(1); i <= minFeeSamples; i++ {
+		samples.add(newDynamicTx(0, 0, i, 100*i, nil))
+	}
+	if _, feeCap, tip := samples.percentile(100); feeCap.Int64() != 100*minFeeSamples || tip.Int64() != minFeeSamples {
+		t.Fatalf("percentile() fee cap %v tip %v, want %d and %d", feeCap, tip, 100*minFeeSamples, minFeeSamples)
+	}
+}
+
+func TestReplacePendingTargetsCompetitiveGasPrice(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, CompetitiveGas: true, CompetitivePercentile: 90}, key)
+	for i := int64(1); i <= 100; i++ {
+		chain.feeSamples.add(newLegacyTx(0, 0, i*params.GWei))
+	}
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 || sent[0].GasPrice().Cmp(big.NewInt(90*params.GWei)) != 0 {
+		t.Fatalf("sent %d txs, want the replacement at the 90th percentile of 90 gwei", len(sent))
+	}
+
+	// Without enough samples the bump alone applies.
+	chain.feeSamples = newFeeSamples()
+	if fees := chain.fees(); fees.minGasPrice != nil {
+		t.Fatalf("gas price floor = %s without samples, want none", fees.minGasPrice)
+	}
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	defaultBumpPercent = 11
+	// Most nodes refuse a same-nonce replacement bumped by less than 10%.
+	minBumpPercent = 10
+)
+
+// The env vars below take precedence over the config file when set.
+const (
+	receiverEnv  = "AUTOWITHDRAW_RECEIVER"
+	endpointsEnv = "AUTOWITHDRAW_ENDPOINTS"
+)
+
+var (
+	ErrConfigCreated = errors.New("empty config created")
+	ErrNoEndpoints   = errors.New("no endpoints configured")
+	ErrNoReceiver    = errors.New("receiver is the zero address")
+)
+
+type Config struct {
+	Receiver  common.Address `json:"receiver"`
+	Endpoints []Endpoint     `json:"endpoints"`
+	// Chains groups endpoints that back the same chain, only one of them is
+	// connected at a time.
+	Chains []ChainConfig `json:"chains"`
+	// MaxConcurrentChains queues chains beyond this many until a running
+	// one stops, 0 means no limit.
+	MaxConcurrentChains int `json:"max_concurrent_chains"`
+
+	DryRun   bool     `json:"dry_run"`
+	MinSweep *big.Int `json:"min_sweep"`
+	MinValue *big.Int `json:"min_value"`
+	// ActiveAccounts are the only accounts defended against pending txs
+	// when set.
+	ActiveAccounts []common.Address `json:"active_accounts"`
+	// ObserveAccounts have their pending txs logged but are never acted on,
+	// even with a key loaded, until they're promoted.
+	ObserveAccounts []common.Address `json:"observe_accounts"`
+	// WhitelistDestinations are left alone when a controlled account sends to them.
+	WhitelistDestinations []common.Address `json:"whitelist_destinations"`
+	// Transactions touching a blacklisted token or destination are never
+	// replaced, nor are blacklisted tokens swept.
+	BlacklistTokens       []common.Address `json:"blacklist_tokens"`
+	BlacklistDestinations []common.Address `json:"blacklist_destinations"`
+	BumpPercent           uint64           `json:"bump_percent"`
+	MaxGasPrice           *big.Int         `json:"max_gas_price"`
+	MinGasPrice           *big.Int         `json:"min_gas_price"`
+	MinTip                *big.Int         `json:"min_tip"`
+	// RebumpBlocks re-broadcasts a replacement with a higher fee when it
+	// hasn't been mined after this many blocks. 0 disables it.
+	RebumpBlocks       uint64  `json:"rebump_blocks"`
+	ConfirmBlocks      uint64  `json:"confirm_blocks"`
+	GasLimitOverride   uint64  `json:"gas_limit_override"`
+	GasMultiplier      float64 `json:"gas_multiplier"`
+	SimulateBeforeSend bool    `json:"simulate_before_send"`
+	// CompetitiveGas outbids CompetitivePercentile of recent pending txs,
+	// not just the original.
+	CompetitiveGas        bool    `json:"competitive_gas"`
+	CompetitivePercentile float64 `json:"competitive_percentile"`
+	BroadcastAll          bool    `json:"broadcast_all"`
+	// SplitReceivers replaces Receiver to split balance sweeps between
+	// several receivers by weight.
+	SplitReceivers []WeightedReceiver `json:"split_receivers"`
+	// Receivers overrides Receiver for individual accounts.
+	Receivers map[common.Address]common.Address `json:"receivers"`
+	// ReceiverData is the calldata of native sweeps and replacements, for
+	// receiver contracts that only credit e.g. a deposit call.
+	ReceiverData     hexutil.Bytes `json:"receiver_data"`
+	SweepFullBalance bool          `json:"sweep_full_balance"`
+	GasReserve       *big.Int      `json:"gas_reserve"`
+
+	// CancelMode cancels pending txs instead of redirecting them.
+	CancelMode bool `json:"cancel_mode"`
+	// ZeroValueCalls picks what's done with pending calls carrying data but
+	// no value: "log" them as suspicious or "cancel" them.
+	ZeroValueCalls string `json:"zero_value_calls"`
+	// RescueMethods are the token calls pending txs are replaced for, by
+	// name. Only ERC-20 transfer is when it's empty.
+	RescueMethods []string `json:"rescue_methods"`
+
+	SweepTokens        []common.Address `json:"sweep_tokens"`
+	TokenSweepInterval Duration         `json:"token_sweep_interval"`
+	PollInterval       Duration         `json:"poll_interval"`
+	RPCTimeout         Duration         `json:"rpc_timeout"`
+	// Proxy is an http:// or socks5:// URL RPC connections go through.
+	Proxy             string   `json:"proxy"`
+	ConnectRetries    int      `json:"connect_retries"`
+	ConnectRetryDelay Duration `json:"connect_retry_delay"`
+	StallTimeout      Duration `json:"stall_timeout"`
+	CooldownAfter     int      `json:"cooldown_after"`
+	Cooldown          Duration `json:"cooldown"`
+	RPCRate           float64  `json:"rpc_rate"`
+	RPCBurst          int      `json:"rpc_burst"`
+	SeenCacheSize     int      `json:"seen_cache_size"`
+	Workers           int      `json:"workers"`
+	// NotFoundRetries looks pending hashes the node doesn't know yet up
+	// again, NotFoundRetryDelay apart and doubling.
+	NotFoundRetries    int      `json:"not_found_retries"`
+	NotFoundRetryDelay Duration `json:"not_found_retry_delay"`
+
+	// EventsJSON writes replacement events to stdout as NDJSON.
+	EventsJSON bool `json:"events_json"`
+
+	LogFormat string `json:"log_format"`
+	// LogSampleRate logs one in this many routine per-tx errors, e.g.
+	// pending txs that got mined before they were looked up.
+	LogSampleRate int    `json:"log_sample_rate"`
+	LogLevel      string `json:"log_level"`
+	MetricsAddr   string `json:"metrics_addr"`
+	HealthAddr    string `json:"health_addr"`
+	// AdminAddr serves POST /sweep, authorized by AdminToken.
+	AdminAddr  string `json:"admin_addr"`
+	AdminToken string `json:"admin_token"`
+	// StateFile keeps nonces and handled txs across restarts.
+	StateFile  string `json:"state_file"`
+	WebhookURL string `json:"webhook_url"`
+	// WebhookTimeout bounds each POST to the webhook and WebhookRetries is
+	// how often a failed one is retried, with backoff.
+	WebhookTimeout Duration `json:"webhook_timeout"`
+	WebhookRetries int      `json:"webhook_retries"`
+
+	DiscordWebhookURL string `json:"discord_webhook_url"`
+	TelegramBotToken  string `json:"telegram_bot_token"`
+	TelegramChatID    string `json:"telegram_chat_id"`
+
+	// PrivateRelayURL submits replacements via eth_sendPrivateTransaction
+	// instead of the public mempool.
+	PrivateRelayURL string `json:"private_relay_url"`
+
+	// ExternalSignerURL signs with a clef compatible signer instead of
+	// local keys, for the accounts it holds.
+	ExternalSignerURL string `json:"external_signer_url"`
+	// HardwareWallet is "ledger" or "trezor" to sweep HardwareAccounts
+	// accounts of the first connected device, derived along DerivationPath.
+	HardwareWallet   string `json:"hardware_wallet"`
+	HardwareAccounts int    `json:"hardware_accounts"`
+
+	// AccountSources are more files or directories of files with one
+	// private key per line, like accounts.txt.
+	AccountSources []string `json:"account_sources"`
+
+	KeystoreDir          string `json:"keystore_dir"`
+	KeystorePasswordFile string `json:"keystore_password_file"`
+
+	Mnemonic           string `json:"mnemonic"`
+	MnemonicPassphrase string `json:"mnemonic_passphrase"`
+	DerivationPath     string `json:"derivation_path"`
+	DerivationCount    int    `json:"derivation_count"`
+
+	// MaxAccounts refuses to start with more local keys than this, 0 means
+	// no limit.
+	MaxAccounts int `json:"max_accounts"`
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+const (
+	ZeroValueLog    = "log"
+	ZeroValueCancel = "cancel"
+)
+
+const (
+	ModePending = "pending"
+	ModePoll    = "poll"
+)
+
+// Endpoint is either a plain URL string or an object picking the scan mode.
+// An empty Mode inherits the chain's mode.
+type Endpoint struct {
+	URL  string `json:"url"`
+	Mode string `json:"mode"`
+}
+
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*e = Endpoint{URL: url}
+		return nil
+	}
+
+	type endpoint Endpoint
+	var decoded endpoint
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*e = Endpoint(decoded)
+	return nil
+}
+
+type ChainConfig struct {
+	Name      string     `json:"name"`
+	Endpoints []Endpoint `json:"endpoints"`
+	Mode      string     `json:"mode"`
+	// Receiver overrides the global receiver for this chain.
+	Receiver *common.Address `json:"receiver"`
+	// ExpectedChainID refuses endpoints serving another chain when set.
+	ExpectedChainID *big.Int `json:"expected_chain_id"`
+	// BumpPercent and MaxGasPrice override the global ones for this chain
+	// when set.
+	BumpPercent uint64   `json:"bump_percent"`
+	MaxGasPrice *big.Int `json:"max_gas_price"`
+	// Enabled defaults to true, a disabled chain isn't scanned.
+	Enabled *bool `json:"enabled"`
+}
+
+func (c ChainConfig) enabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+func (c ChainConfig) modeFor(endpoint Endpoint) string {
+	if endpoint.Mode != "" {
+		return endpoint.Mode
+	}
+	if c.Mode != "" {
+		return c.Mode
+	}
+	return ModePending
+}
+
+// ChainConfigs returns every configured chain. Each endpoint in the legacy
+// top-level list is treated as a chain of its own.
+func (c Config) ChainConfigs() []ChainConfig {
+	chains := make([]ChainConfig, 0, len(c.Chains)+len(c.Endpoints))
+	for _, endpoint := range c.Endpoints {
+		chains = append(chains, ChainConfig{Name: endpoint.URL, Endpoints: []Endpoint{endpoint}})
+	}
+	for i, chain := range c.Chains {
+		if chain.Name == "" {
+			chain.Name = fmt.Sprintf("chain-%d", i)
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+func (c Config) receiverFor(chain ChainConfig) common.Address {
+	if chain.Receiver != nil {
+		return *chain.Receiver
+	}
+	if len(c.SplitReceivers) > 0 {
+		return heaviest(c.SplitReceivers)
+	}
+	return c.Receiver
+}
+
+// splitFor returns the receivers balance sweeps on chain are split between,
+// or nil when chain has a receiver of its own.
+func (c Config) splitFor(chain ChainConfig) []WeightedReceiver {
+	if chain.Receiver != nil {
+		return nil
+	}
+	return c.SplitReceivers
+}
+
+// UnmarshalJSON accepts the legacy misspelled "reciever" key as well as
+// "receiver", preferring the latter when both are set.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type config Config
+	decoded := struct {
+		*config
+		LegacyReceiver *common.Address `json:"reciever"`
+	}{config: (*config)(c)}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	if decoded.LegacyReceiver != nil {
+		slog.Warn(`config key "reciever" is deprecated, rename it to "receiver"`)
+		if c.Receiver == (common.Address{}) {
+			c.Receiver = *decoded.LegacyReceiver
+		}
+	}
+	return nil
+}
+
+// Duration decodes from a Go duration string such as "30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// stdinConfigPath makes LoadConfig read the config from stdin, so secrets
+// injected by a pipeline never touch the disk.
+const stdinConfigPath = "-"
+
+// readStdin reads stdin once, a reload decodes the same config again.
+var readStdin = sync.OnceValues(func() ([]byte, error) {
+	return io.ReadAll(os.Stdin)
+})
+
+// LoadConfig reads the config at path, or stdin when it's "-", and applies
+// env var overrides. If the file doesn't exist and the endpoints don't come
+// from the env, an empty config is written there and ErrConfigCreated is
+// returned.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	if path == stdinConfigPath {
+		data, err := readStdin()
+		if err != nil {
+			return config, fmt.Errorf("couldn't read config from stdin: %w", err)
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("couldn't decode config: %w", err)
+		}
+		return config.finish()
+	}
+
+	configFile, err := os.Open(path)
+	switch {
+	case err == nil:
+		defer configFile.Close()
+		if err = json.NewDecoder(configFile).Decode(&config); err != nil {
+			return config, fmt.Errorf("couldn't decode config: %w", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return config, err
+	case os.Getenv(endpointsEnv) == "":
+		if err := writeEmptyConfig(path); err != nil {
+			return config, fmt.Errorf("couldn't create empty config: %w", err)
+		}
+		return config, ErrConfigCreated
+	}
+	return config.finish()
+}
+
+// finish applies env var overrides and defaults to a decoded config and
+// validates it.
+func (c Config) finish() (Config, error) {
+	if err := c.applyEnv(); err != nil {
+		return c, err
+	}
+
+	if c.BumpPercent == 0 {
+		c.BumpPercent = defaultBumpPercent
+	}
+
+	return c, c.Validate()
+}
+
+// applyEnv overrides the receiver and endpoints with AUTOWITHDRAW_RECEIVER
+// and the comma separated AUTOWITHDRAW_ENDPOINTS. Env endpoints replace
+// both endpoints and chains of the file.
+func (c *Config) applyEnv() error {
+	if receiver := os.Getenv(receiverEnv); receiver != "" {
+		if !common.IsHexAddress(receiver) {
+			return fmt.Errorf("%s: invalid address %q", receiverEnv, receiver)
+		}
+		c.Receiver = common.HexToAddress(receiver)
+	}
+
+	if endpoints := os.Getenv(endpointsEnv); endpoints != "" {
+		c.Endpoints, c.Chains = nil, nil
+		for _, url := range strings.Split(endpoints, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				c.Endpoints = append(c.Endpoints, Endpoint{URL: url})
+			}
+		}
+	}
+	return nil
+}
+
+// checkFloors rejects min_gas_price and min_tip above maxGasPrice, which
+// no replacement could satisfy.
+func (c Config) checkFloors(maxGasPrice *big.Int) error {
+	if maxGasPrice == nil {
+		return nil
+	}
+	if c.MinGasPrice != nil && c.MinGasPrice.Cmp(maxGasPrice) > 0 {
+		return errors.New("min_gas_price exceeds max_gas_price")
+	}
+	if c.MinTip != nil && c.MinTip.Cmp(maxGasPrice) > 0 {
+		return errors.New("min_tip exceeds max_gas_price")
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	chains := c.ChainConfigs()
+	if len(chains) == 0 {
+		return ErrNoEndpoints
+	}
+	if c.BumpPercent < minBumpPercent {
+		return fmt.Errorf("bump_percent must be at least %d, got %d", minBumpPercent, c.BumpPercent)
+	}
+	if err := c.checkFloors(c.MaxGasPrice); err != nil {
+		return err
+	}
+	if c.CompetitivePercentile < 0 || c.CompetitivePercentile > 100 {
+		return fmt.Errorf("competitive_percentile must be within 0 and 100, got %v", c.CompetitivePercentile)
+	}
+	for _, chain := range chains {
+		if chain.BumpPercent != 0 && chain.BumpPercent < minBumpPercent {
+			return fmt.Errorf("chain %s: bump_percent must be at least %d, got %d", chain.Name, minBumpPercent, chain.BumpPercent)
+		}
+		if err := c.checkFloors(chain.MaxGasPrice); err != nil {
+			return fmt.Errorf("chain %s: %w", chain.Name, err)
+		}
+	}
+	if len(c.SplitReceivers) > 0 {
+		if c.Receiver != (common.Address{}) {
+			return errors.New("set either receiver or split_receivers")
+		}
+		if err := validateSplit(c.SplitReceivers); err != nil {
+			return fmt.Errorf("split_receivers: %w", err)
+		}
+	}
+	if (c.TelegramBotToken == "") != (c.TelegramChatID == "") {
+		return errors.New("telegram_bot_token and telegram_chat_id must be set together")
+	}
+	if _, err := newRescueSet(c.RescueMethods); err != nil {
+		return err
+	}
+	if c.Proxy != "" {
+		if _, err := parseProxy(c.Proxy); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+	}
+	if c.AdminAddr != "" && c.AdminToken == "" {
+		return errors.New("admin_addr requires admin_token")
+	}
+	if c.ZeroValueCalls != "" && c.ZeroValueCalls != ZeroValueLog && c.ZeroValueCalls != ZeroValueCancel {
+		return fmt.Errorf("unknown zero_value_calls %q", c.ZeroValueCalls)
+	}
+	if c.HardwareWallet != "" && c.HardwareWallet != HardwareLedger && c.HardwareWallet != HardwareTrezor {
+		return fmt.Errorf("unknown hardware_wallet %q", c.HardwareWallet)
+	}
+	if c.LogFormat != "" && c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		return fmt.Errorf("unknown log_format %q", c.LogFormat)
+	}
+	if c.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			return fmt.Errorf("unknown log_level %q", c.LogLevel)
+		}
+	}
+	for _, chain := range chains {
+		if len(chain.Endpoints) == 0 {
+			return fmt.Errorf("%s: %w", chain.Name, ErrNoEndpoints)
+		}
+		if c.receiverFor(chain) == (common.Address{}) {
+			return fmt.Errorf("%s: %w", chain.Name, ErrNoReceiver)
+		}
+		for _, endpoint := range chain.Endpoints {
+			if mode := chain.modeFor(endpoint); mode != ModePending && mode != ModePoll {
+				return fmt.Errorf("unknown mode %q for %s", mode, endpoint.URL)
+			}
+			if _, err := supportsSubscriptions(endpoint.URL); err != nil {
+				return fmt.Errorf("%s: %w", endpoint.URL, err)
+			}
+		}
+	}
+	return nil
+}
+
+// logLevel returns the configured log level, info when it's unset.
+func (c Config) logLevel() slog.Level {
+	var level slog.Level
+	if c.LogLevel != "" {
+		// Validate already rejected unknown levels.
+		level.UnmarshalText([]byte(c.LogLevel))
+	}
+	return level
+}
+
+func writeEmptyConfig(path string) error {
+	configFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer configFile.Close()
+
+	var emptyConfig Config
+
+	e := json.NewEncoder(configFile)
+	e.SetIndent("", "   ")
+
+	return e.Encode(emptyConfig)
+}
+
+// ValidateReceivers makes sure no receiver sweeps into another account we
+// hold keys for, which would just bounce funds between them.
+func (c Config) ValidateReceivers(accounts Accounts) error {
+	return c.validateReceivers(func(address common.Address) bool {
+		_, ok := accounts[address]
+		return ok
+	})
+}
+
+// validateReceivers fails when any receiver is an address controlled reports
+// true for.
+func (c Config) validateReceivers(controlled func(common.Address) bool) error {
+	if controlled(c.Receiver) {
+		return fmt.Errorf("receiver %s is a controlled account", c.Receiver)
+	}
+	for account, receiver := range c.Receivers {
+		if controlled(receiver) {
+			return fmt.Errorf("receiver %s for %s is a controlled account", receiver, account)
+		}
+	}
+	for _, receiver := range c.SplitReceivers {
+		if controlled(receiver.Address) {
+			return fmt.Errorf("split receiver %s is a controlled account", receiver.Address)
+		}
+	}
+	for _, chain := range c.Chains {
+		if chain.Receiver == nil {
+			continue
+		}
+		if controlled(*chain.Receiver) {
+			return fmt.Errorf("receiver %s for %s is a controlled account", *chain.Receiver, chain.Name)
+		}
+	}
+	return nil
+}
+
+func addressSet(addresses []common.Address) map[common.Address]bool {
+	set := make(map[common.Address]bool, len(addresses))
+	for _, address := range addresses {
+		set[address] = true
+	}
+	return set
+}
+
+func (c Config) Options() Options {
+	// Validate already rejected unparseable proxies, an unset one is nil,
+	// and unknown rescue methods.
+	proxy, _ := parseProxy(c.Proxy)
+	rescues, _ := newRescueSet(c.RescueMethods)
+
+	return Options{
+		DryRun:    c.DryRun,
+		MinSweep:  c.MinSweep,
+		MinValue:  c.MinValue,
+		Whitelist: addressSet(c.WhitelistDestinations),
+
+		ActiveAccounts: addressSet(c.ActiveAccounts),
+		Observed:       NewObserveList(c.ObserveAccounts),
+
+		BlacklistTokens:       addressSet(c.BlacklistTokens),
+		BlacklistDestinations: addressSet(c.BlacklistDestinations),
+
+		BumpPercent: c.BumpPercent,
+		MaxGasPrice: c.MaxGasPrice,
+		MinGasPrice: c.MinGasPrice,
+		MinTip:      c.MinTip,
+		Receivers:   c.Receivers,
+
+		CancelMode:       c.CancelMode,
+		ZeroValueCalls:   c.ZeroValueCalls,
+		Rescues:          rescues,
+		ReceiverData:     c.ReceiverData,
+		SweepFullBalance: c.SweepFullBalance,
+		GasReserve:       c.GasReserve,
+
+		RebumpBlocks:       c.RebumpBlocks,
+		ConfirmBlocks:      c.ConfirmBlocks,
+		GasLimitOverride:   c.GasLimitOverride,
+		GasMultiplier:      c.GasMultiplier,
+		RPCTimeout:         time.Duration(c.RPCTimeout),
+		Proxy:              proxy,
+		ConnectRetries:     c.ConnectRetries,
+		ConnectRetryDelay:  time.Duration(c.ConnectRetryDelay),
+		StallTimeout:       time.Duration(c.StallTimeout),
+		CooldownAfter:      c.CooldownAfter,
+		Cooldown:           time.Duration(c.Cooldown),
+		RPCRate:            c.RPCRate,
+		RPCBurst:           c.RPCBurst,
+		SimulateBeforeSend: c.SimulateBeforeSend,
+		LogSampleRate:      c.LogSampleRate,
+
+		CompetitiveGas:        c.CompetitiveGas,
+		CompetitivePercentile: c.CompetitivePercentile,
+		BroadcastAll:          c.BroadcastAll,
+
+		SeenCacheSize: c.SeenCacheSize,
+		Workers:       c.Workers,
+
+		NotFoundRetries:    c.NotFoundRetries,
+		NotFoundRetryDelay: time.Duration(c.NotFoundRetryDelay),
+
+		SweepTokens:        c.SweepTokens,
+		TokenSweepInterval: time.Duration(c.TokenSweepInterval),
+		PollInterval:       time.Duration(c.PollInterval),
+	}
+}
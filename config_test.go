@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// writeConfig writes config into a temp dir and returns its path.
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearConfigEnv keeps the env overrides of the machine running the tests out
+// of them.
+func clearConfigEnv(t *testing.T) {
+	t.Setenv(receiverEnv, "")
+	t.Setenv(endpointsEnv, "")
+}
+
+func TestLoadConfigCreatesMissingConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	if _, err := LoadConfig(path); !errors.Is(err, ErrConfigCreated) {
+		t.Fatalf("LoadConfig() = %v, want %v", err, ErrConfigCreated)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("empty config wasn't written: %v", err)
+	}
+
+	// The created config decodes but isn't usable until it's filled in.
+	_, err := LoadConfig(path)
+	if err == nil || errors.Is(err, ErrConfigCreated) {
+		t.Fatalf("LoadConfig() of the empty config = %v, want a validation error", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfig(t, `{"receiver": "`+testReceiver+`", "endpoints": [{"url": "ws://localhost:8546"}]}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Receiver != testReceiverAddress {
+		t.Fatalf("Receiver = %s, want %s", config.Receiver, testReceiverAddress)
+	}
+	if config.BumpPercent != defaultBumpPercent {
+		t.Fatalf("BumpPercent = %d, want the default %d", config.BumpPercent, defaultBumpPercent)
+	}
+}
+
+func TestLoadConfigRejectsMalformedJSON(t *testing.T) {
+	clearConfigEnv(t)
+	if _, err := LoadConfig(writeConfig(t, `{"receiver": `)); err == nil {
+		t.Fatal("LoadConfig() = nil, want a decode error")
+	}
+}
+
+// loadTestConfig loads a config with a receiver and one endpoint, plus the
+// JSON fields in extra, e.g. `"bump_percent": 20`.
+func loadTestConfig(t *testing.T, extra string) (Config, error) {
+	t.Helper()
+	clearConfigEnv(t)
+
+	config := `{"receiver": "` + testReceiver + `", "endpoints": [{"url": "ws://localhost:8546"}]`
+	if extra != "" {
+		config += ", " + extra
+	}
+	return LoadConfig(writeConfig(t, config+"}"))
+}
+
+func TestBumpPercent(t *testing.T) {
+	config, err := loadTestConfig(t, `"bump_percent": 25`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Options().BumpPercent; got != 25 {
+		t.Fatalf("Options().BumpPercent = %d, want 25", got)
+	}
+
+	// Nodes reject replacements bumped by less than 10%.
+	if _, err := loadTestConfig(t, `"bump_percent": 5`); err == nil {
+		t.Fatal("LoadConfig() accepted bump_percent 5")
+	}
+}
+
+func TestConfigDecodesLegacyReceiverKey(t *testing.T) {
+	other := "0x3333333333333333333333333333333333333333"
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"receiver", `{"receiver": "` + testReceiver + `"}`, testReceiver},
+		{"reciever", `{"reciever": "` + testReceiver + `"}`, testReceiver},
+		{"both", `{"receiver": "` + testReceiver + `", "reciever": "` + other + `"}`, testReceiver},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var config Config
+			if err := json.Unmarshal([]byte(test.json), &config); err != nil {
+				t.Fatal(err)
+			}
+			if want := common.HexToAddress(test.want); config.Receiver != want {
+				t.Fatalf("Receiver = %s, want %s", config.Receiver, want)
+			}
+		})
+	}
+}
+
+func TestConfigWarnsAboutLegacyReceiverKey(t *testing.T) {
+	logs := captureLogs(t)
+	var config Config
+	if err := json.Unmarshal([]byte(`{"reciever": "`+testReceiver+`"}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "deprecated") {
+		t.Fatalf("no deprecation warning in %q", logs)
+	}
+}
+
+func TestLoadConfigRejectsUnknownSchemes(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfig(t, `{"receiver": "`+testReceiver+`", "endpoints": [{"url": "ftp://localhost"}]}`)
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("LoadConfig() accepted an ftp endpoint")
+	}
+}
+
+func TestRPCRate(t *testing.T) {
+	config, err := loadTestConfig(t, `"rpc_rate": 12.5, "rpc_burst": 4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := config.Options(); opts.RPCRate != 12.5 || opts.RPCBurst != 4 {
+		t.Fatalf("Options() rate = %v burst %d, want 12.5 and 4", opts.RPCRate, opts.RPCBurst)
+	}
+}
+
+func TestChainsAreEnabledByDefault(t *testing.T) {
+	config, err := loadTestConfig(t, `"chains": [{"name": "mainnet", "endpoints": ["ws://localhost:8546"]}, {"name": "sepolia", "endpoints": ["ws://localhost:8547"], "enabled": false}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := map[string]bool{}
+	for _, chain := range config.ChainConfigs() {
+		enabled[chain.Name] = chain.enabled()
+	}
+	if !enabled["mainnet"] || enabled["sepolia"] {
+		t.Fatalf("enabled chains = %v, want mainnet only", enabled)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	config, err := loadTestConfig(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level := config.logLevel(); level != slog.LevelInfo {
+		t.Fatalf("logLevel() = %s, want info by default", level)
+	}
+
+	config, err = loadTestConfig(t, `"log_level": "warn"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level := config.logLevel(); level != slog.LevelWarn {
+		t.Fatalf("logLevel() = %s, want warn", level)
+	}
+
+	if _, err := loadTestConfig(t, `"log_level": "loud"`); err == nil {
+		t.Fatal("LoadConfig() accepted log_level loud")
+	}
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	fileConfig := `{"receiver": "` + testReceiver + `", "endpoints": [{"url": "ws://localhost:8546"}]}`
+	envReceiver := "0x00000000000000000000000000000000000000e1"
+
+	tests := []struct {
+		name          string
+		file          string
+		receiverEnv   string
+		endpointsEnv  string
+		wantReceiver  string
+		wantEndpoints []string
+	}{
+		{"file only", fileConfig, "", "", testReceiver, []string{"ws://localhost:8546"}},
+		{"env only", "", envReceiver, "ws://a:8546, http://b:8545", envReceiver, []string{"ws://a:8546", "http://b:8545"}},
+		{"env overrides file", fileConfig, envReceiver, "ws://a:8546", envReceiver, []string{"ws://a:8546"}},
+		{"env receiver only", fileConfig, envReceiver, "", envReceiver, []string{"ws://localhost:8546"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(receiverEnv, test.receiverEnv)
+			t.Setenv(endpointsEnv, test.endpointsEnv)
+			path := filepath.Join(t.TempDir(), "config.json")
+			if test.file != "" {
+				path = writeConfig(t, test.file)
+			}
+
+			config, err := LoadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Receiver != common.HexToAddress(test.wantReceiver) {
+				t.Fatalf("Receiver = %s, want %s", config.Receiver, test.wantReceiver)
+			}
+			var urls []string
+			for _, endpoint := range config.Endpoints {
+				urls = append(urls, endpoint.URL)
+			}
+			if strings.Join(urls, ",") != strings.Join(test.wantEndpoints, ",") {
+				t.Fatalf("Endpoints = %v, want %v", urls, test.wantEndpoints)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsInvalidEnvReceiver(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfig(t, `{"receiver": "`+testReceiver+`", "endpoints": [{"url": "ws://localhost:8546"}]}`)
+	t.Setenv(receiverEnv, "0xnotanaddress")
+
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), receiverEnv) {
+		t.Fatalf("LoadConfig() = %v, want an invalid %s error", err, receiverEnv)
+	}
+}
+
+func TestReceiverData(t *testing.T) {
+	config, err := loadTestConfig(t, `"receiver_data": "0xd0e30db0"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Options().ReceiverData; common.Bytes2Hex(got) != "d0e30db0" {
+		t.Fatalf("Options().ReceiverData = %x, want d0e30db0", got)
+	}
+}
+
+func TestActiveAccounts(t *testing.T) {
+	config, err := loadTestConfig(t, `"active_accounts": ["`+testReceiver+`"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := config.Options().ActiveAccounts; len(active) != 1 || !active[testReceiverAddress] {
+		t.Fatalf("Options().ActiveAccounts = %v, want %s", active, testReceiverAddress)
+	}
+
+	config, err = loadTestConfig(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := config.Options().ActiveAccounts; len(active) != 0 {
+		t.Fatalf("Options().ActiveAccounts = %v, want every account active", active)
+	}
+}
+
+func TestLoadConfigProxy(t *testing.T) {
+	config, err := loadTestConfig(t, `"proxy": "socks5://localhost:1080"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy := config.Options().Proxy; proxy == nil || proxy.String() != "socks5://localhost:1080" {
+		t.Fatalf("Options().Proxy = %v, want socks5://localhost:1080", proxy)
+	}
+
+	if _, err := loadTestConfig(t, `"proxy": "https://localhost:3128"`); err == nil {
+		t.Fatal("LoadConfig() accepted an https proxy")
+	}
+}
+
+func TestFeeFloors(t *testing.T) {
+	config, err := loadTestConfig(t, `"min_gas_price": 2000000000, "min_tip": 1000000000`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := config.Options(); opts.MinGasPrice.Int64() != 2*params.GWei || opts.MinTip.Int64() != params.GWei {
+		t.Fatalf("Options() floors = %s and %s, want 2 and 1 gwei", opts.MinGasPrice, opts.MinTip)
+	}
+
+	for _, floor := range []string{`"min_gas_price": 2000000000`, `"min_tip": 2000000000`} {
+		if _, err := loadTestConfig(t, floor+`, "max_gas_price": 1000000000`); err == nil {
+			t.Errorf("LoadConfig() accepted %s above max_gas_price", floor)
+		}
+	}
+}
+
+func TestWebhookSettings(t *testing.T) {
+	config, err := loadTestConfig(t, `"webhook_url": "http://localhost:9000", "webhook_timeout": "2s", "webhook_retries": 4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(config.WebhookTimeout) != 2*time.Second || config.WebhookRetries != 4 {
+		t.Fatalf("webhook timeout %v, %d retries, want 2s and 4", time.Duration(config.WebhookTimeout), config.WebhookRetries)
+	}
+}
+
+func TestChainBumpPercent(t *testing.T) {
+	chains := func(bump int) string {
+		return `"chains": [{"name": "base", "endpoints": [{"url": "ws://localhost:8546"}], "bump_percent": ` + strconv.Itoa(bump) + `}]`
+	}
+	if _, err := loadTestConfig(t, chains(30)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTestConfig(t, chains(5)); err == nil {
+		t.Fatal("LoadConfig() accepted a chain bump_percent of 5")
+	}
+}
+
+func TestZeroValueCalls(t *testing.T) {
+	for _, mode := range []string{ZeroValueLog, ZeroValueCancel} {
+		if _, err := loadTestConfig(t, `"zero_value_calls": "`+mode+`"`); err != nil {
+			t.Errorf("LoadConfig() of zero_value_calls %q = %v", mode, err)
+		}
+	}
+	if _, err := loadTestConfig(t, `"zero_value_calls": "ignore"`); err == nil {
+		t.Fatal("LoadConfig() accepted an unknown zero_value_calls")
+	}
+}
+
+// pipeStdin makes config the stdin LoadConfig reads "-" from.
+func pipeStdin(t *testing.T, config string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		io.WriteString(w, config)
+		w.Close()
+	}()
+
+	prevStdin, prevRead := os.Stdin, readStdin
+	os.Stdin = r
+	readStdin = sync.OnceValues(func() ([]byte, error) {
+		return io.ReadAll(os.Stdin)
+	})
+	t.Cleanup(func() {
+		os.Stdin, readStdin = prevStdin, prevRead
+		r.Close()
+	})
+}
+
+func TestLoadConfigFromStdin(t *testing.T) {
+	clearConfigEnv(t)
+	pipeStdin(t, `{"receiver": "`+testReceiver+`", "endpoints": [{"url": "ws://localhost:8546"}], "bump_percent": 20}`)
+
+	// A reload decodes the same config again.
+	for i := 0; i < 2; i++ {
+		config, err := LoadConfig(stdinConfigPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Receiver != testReceiverAddress || config.BumpPercent != 20 || len(config.Endpoints) != 1 {
+			t.Fatalf("LoadConfig(%q) = %+v, want the piped config", stdinConfigPath, config)
+		}
+	}
+	if _, err := os.Stat(stdinConfigPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("config from stdin was written to disk")
+	}
+}
+
+func TestLoadConfigFromStdinRejectsMalformedJSON(t *testing.T) {
+	clearConfigEnv(t)
+	pipeStdin(t, `{"receiver": `)
+
+	if _, err := LoadConfig(stdinConfigPath); err == nil {
+		t.Fatal("LoadConfig() accepted malformed JSON from stdin")
+	}
+}
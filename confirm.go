@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	confirmMined    = "mined"
+	confirmReverted = "reverted"
+	confirmTimedOut = "timed_out"
+)
+
+type pendingConfirmation struct {
+	// txs holds the replacement and every re-bump of it, any of them may
+	// end up mined.
+	txs []*types.Transaction
+	// sentAt is the first block seen after broadcasting.
+	sentAt uint64
+}
+
+// confirmationTracker remembers broadcast replacements until they're mined
+// or ConfirmBlocks pass. A nil *confirmationTracker tracks nothing.
+type confirmationTracker struct {
+	mu      sync.Mutex
+	pending map[inflightKey]*pendingConfirmation
+}
+
+func newConfirmationTracker() *confirmationTracker {
+	return &confirmationTracker{pending: make(map[inflightKey]*pendingConfirmation)}
+}
+
+func (t *confirmationTracker) watch(from common.Address, tx *types.Transaction) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := inflightKey{from: from, nonce: tx.Nonce()}
+	if pending, ok := t.pending[key]; ok {
+		pending.txs = append(pending.txs, tx)
+		return
+	}
+	t.pending[key] = &pendingConfirmation{txs: []*types.Transaction{tx}}
+}
+
+func (t *confirmationTracker) snapshot() map[inflightKey]pendingConfirmation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := make(map[inflightKey]pendingConfirmation, len(t.pending))
+	for key, confirmation := range t.pending {
+		pending[key] = pendingConfirmation{txs: append([]*types.Transaction{}, confirmation.txs...), sentAt: confirmation.sentAt}
+	}
+	return pending
+}
+
+func (t *confirmationTracker) markSent(key inflightKey, block uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if confirmation, ok := t.pending[key]; ok && confirmation.sentAt == 0 {
+		confirmation.sentAt = block
+	}
+}
+
+func (t *confirmationTracker) forget(key inflightKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.pending, key)
+}
+
+// WatchConfirmations watches new heads and reports each broadcast replacement
+// once it's mined, or as timed out after ConfirmBlocks.
+func (c *Chain) WatchConfirmations(ctx context.Context) error {
+	heads, unsubscribe := c.heads.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case header := <-heads:
+			c.checkConfirmations(ctx, header.Number.Uint64())
+		}
+	}
+}
+
+func (c *Chain) checkConfirmations(ctx context.Context, block uint64) {
+	for key, pending := range c.confirmations.snapshot() {
+		if pending.sentAt == 0 {
+			c.confirmations.markSent(key, block)
+			continue
+		}
+
+		receipt, tx, err := c.minedReceipt(ctx, pending.txs)
+		if err != nil {
+			c.log.Warn("couldn't get replacement receipt", "from", key.from, "err", err)
+			continue
+		}
+		if receipt != nil {
+			status := confirmMined
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				status = confirmReverted
+			} else {
+				c.opts.Stats.confirmed(c.name, key.from, tx)
+			}
+			c.log.Info("replacement "+status, "from", key.from, "replacement_tx", receipt.TxHash, "block", receipt.BlockNumber, "gas_used", receipt.GasUsed)
+			c.opts.Metrics.confirmation(c.name, status)
+			c.confirmations.forget(key)
+			continue
+		}
+
+		if block-pending.sentAt >= c.opts.ConfirmBlocks {
+			c.log.Warn("replacement not mined in time", "from", key.from, "replacement_tx", pending.txs[len(pending.txs)-1].Hash(), "blocks", block-pending.sentAt)
+			c.opts.Metrics.confirmation(c.name, confirmTimedOut)
+			c.confirmations.forget(key)
+		}
+	}
+}
+
+// minedReceipt returns whichever of txs got mined with its receipt, or nils
+// when none has yet.
+func (c *Chain) minedReceipt(ctx context.Context, txs []*types.Transaction) (*types.Receipt, *types.Transaction, error) {
+	for _, tx := range txs {
+		receiptCtx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+		receipt, err := c.eth.TransactionReceipt(receiptCtx, tx.Hash())
+		cancel()
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return receipt, tx, nil
+	}
+	return nil, nil, nil
+}
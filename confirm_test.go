@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// receiptBackend serves receipts set with mine instead of mining.
+type receiptBackend struct {
+	*recordingBackend
+	mu       sync.Mutex
+	receipts map[common.Hash]*types.Receipt
+}
+
+func (b *receiptBackend) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	receipt, ok := b.receipts[hash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+func (b *receiptBackend) mine(tx *types.Transaction, status uint64, block int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.receipts[tx.Hash()] = &types.Receipt{Status: status, TxHash: tx.Hash(), BlockNumber: big.NewInt(block), GasUsed: tx.Gas()}
+}
+
+// newConfirmingChain returns a recording chain watching its replacements
+// for confirmBlocks, and the replacement it sent for a transfer from its
+// account.
+func newConfirmingChain(t *testing.T, confirmBlocks uint64) (*Chain, *receiptBackend, *Metrics, *types.Transaction) {
+	t.Helper()
+
+	key, _ := newTestKey(t)
+	metrics := NewMetrics(prometheus.NewRegistry())
+	chain, recording := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, ConfirmBlocks: confirmBlocks, Metrics: metrics, ChainName: "sim"}, key)
+	backend := &receiptBackend{recordingBackend: recording, receipts: make(map[common.Hash]*types.Receipt)}
+	chain.eth = backend
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the replacement", len(sent))
+	}
+	return chain, backend, metrics, sent[0]
+}
+
+func TestCheckConfirmations(t *testing.T) {
+	tests := []struct {
+		name   string
+		status uint64
+		want   string
+	}{
+		{"mined", types.ReceiptStatusSuccessful, confirmMined},
+		{"reverted", types.ReceiptStatusFailed, confirmReverted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, backend, metrics, replacementTx := newConfirmingChain(t, 5)
+			ctx := context.Background()
+
+			chain.checkConfirmations(ctx, 10)
+			chain.checkConfirmations(ctx, 11)
+			if len(chain.confirmations.snapshot()) != 1 {
+				t.Fatal("unmined replacement isn't watched")
+			}
+
+			backend.mine(replacementTx, test.status, 12)
+			chain.checkConfirmations(ctx, 12)
+			if got := testutil.ToFloat64(metrics.confirmations.WithLabelValues("sim", test.want)); got != 1 {
+				t.Fatalf("%s confirmations = %v, want 1", test.want, got)
+			}
+			if len(chain.confirmations.snapshot()) != 0 {
+				t.Fatal("confirmed replacement is still watched")
+			}
+		})
+	}
+}
+
+func TestCheckConfirmationsTimesOut(t *testing.T) {
+	chain, _, metrics, _ := newConfirmingChain(t, 2)
+	ctx := context.Background()
+
+	// Sent before block 10, not mined two blocks later.
+	chain.checkConfirmations(ctx, 10)
+	chain.checkConfirmations(ctx, 11)
+	if got := testutil.ToFloat64(metrics.confirmations.WithLabelValues("sim", confirmTimedOut)); got != 0 {
+		t.Fatalf("timed out confirmations = %v after 1 block, want 0", got)
+	}
+	chain.checkConfirmations(ctx, 12)
+	if got := testutil.ToFloat64(metrics.confirmations.WithLabelValues("sim", confirmTimedOut)); got != 1 {
+		t.Fatalf("timed out confirmations = %v, want 1", got)
+	}
+	if len(chain.confirmations.snapshot()) != 0 {
+		t.Fatal("timed out replacement is still watched")
+	}
+}
+
+func TestCheckConfirmationsOfRebumps(t *testing.T) {
+	chain, backend, metrics, replacementTx := newConfirmingChain(t, 5)
+	ctx := context.Background()
+
+	// A re-bump at the same nonce is mined instead of the replacement.
+	rebumpedTx := withValue(replacementTx, big.NewInt(1))
+	chain.confirmations.watch(chain.addresses()[0], rebumpedTx)
+	chain.checkConfirmations(ctx, 10)
+
+	backend.mine(rebumpedTx, types.ReceiptStatusSuccessful, 11)
+	chain.checkConfirmations(ctx, 11)
+	if got := testutil.ToFloat64(metrics.confirmations.WithLabelValues("sim", confirmMined)); got != 1 {
+		t.Fatalf("mined confirmations = %v, want 1", got)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultCooldownAfter = 3
+	defaultCooldown      = 30 * time.Second
+	maxCooldown          = 10 * time.Minute
+)
+
+type accountFailures struct {
+	count int
+	until time.Time
+}
+
+// failureTracker suppresses replacements for accounts whose replacements
+// keep failing, doubling the cooldown with every further failure.
+type failureTracker struct {
+	after int
+	base  time.Duration
+
+	mu       sync.Mutex
+	accounts map[common.Address]*accountFailures
+}
+
+func newFailureTracker(after int, base time.Duration) *failureTracker {
+	return &failureTracker{after: after, base: base, accounts: make(map[common.Address]*accountFailures)}
+}
+
+// coolingDown reports whether account is suppressed at now.
+func (t *failureTracker) coolingDown(account common.Address, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures, ok := t.accounts[account]
+	return ok && now.Before(failures.until)
+}
+
+// failed records a failed replacement of account and returns how long it's
+// suppressed for, 0 while it's below the threshold.
+func (t *failureTracker) failed(account common.Address, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures, ok := t.accounts[account]
+	if !ok {
+		failures = &accountFailures{}
+		t.accounts[account] = failures
+	}
+	failures.count++
+	if failures.count < t.after {
+		return 0
+	}
+
+	cooldown := t.base
+	for i := t.after; i < failures.count && cooldown < maxCooldown; i++ {
+		cooldown *= 2
+	}
+	cooldown = min(cooldown, maxCooldown)
+	failures.until = now.Add(cooldown)
+	return cooldown
+}
+
+func (t *failureTracker) succeeded(account common.Address) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.accounts, account)
+}
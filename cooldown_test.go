@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestFailureTrackerBacksOff(t *testing.T) {
+	tracker := newFailureTracker(3, time.Minute)
+	now := time.Now()
+
+	tests := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, maxCooldown, maxCooldown}
+	for i, want := range tests {
+		if got := tracker.failed(testAttacker, now); got != want {
+			t.Fatalf("failure %d: failed() = %v, want %v", i+1, got, want)
+		}
+	}
+	if !tracker.coolingDown(testAttacker, now.Add(maxCooldown-time.Second)) {
+		t.Fatal("account isn't cooling down")
+	}
+	if tracker.coolingDown(testAttacker, now.Add(maxCooldown)) {
+		t.Fatal("account is still cooling down after its cooldown")
+	}
+
+	tracker.succeeded(testAttacker)
+	if got := tracker.failed(testAttacker, now); got != 0 {
+		t.Fatalf("failed() after a success = %v, want the count reset", got)
+	}
+}
+
+func TestReplacePendingCoolsDownFailingAccounts(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, CooldownAfter: 2, Cooldown: time.Hour}, key)
+	ctx := context.Background()
+	failed := errors.New("nonce too low")
+	backend.errs = []error{failed, failed}
+
+	for i := 0; i < 3; i++ {
+		chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei+int64(i))), time.Now())
+	}
+	if len(backend.errs) != 0 {
+		t.Fatalf("%d sends weren't attempted, want both failures", len(backend.errs))
+	}
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs while cooling down, want none", len(sent))
+	}
+}
+
+func TestCooldownConfig(t *testing.T) {
+	config, err := loadTestConfig(t, `"cooldown_after": 5, "cooldown": "1m"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := config.Options(); opts.CooldownAfter != 5 || opts.Cooldown != time.Minute {
+		t.Fatalf("Options() cooldown after %d for %v, want 5 for 1m", opts.CooldownAfter, opts.Cooldown)
+	}
+}
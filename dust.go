@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// dustTracker remembers balances the poller left behind because they didn't
+// cover a sweep's fee or min_sweep, e.g. unused gas refunded to an account
+// after a replacement, so it's visible when they've accumulated enough.
+type dustTracker struct {
+	mu       sync.Mutex
+	balances map[common.Address]*big.Int
+}
+
+func newDustTracker() *dustTracker {
+	return &dustTracker{balances: make(map[common.Address]*big.Int)}
+}
+
+// left records balance as dust of account and reports whether it changed
+// since the last poll.
+func (t *dustTracker) left(account common.Address, balance *big.Int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if prev, ok := t.balances[account]; ok && prev.Cmp(balance) == 0 {
+		return false
+	}
+	t.balances[account] = new(big.Int).Set(balance)
+	return true
+}
+
+// take forgets the dust of account and returns it, nil when there was none.
+func (t *dustTracker) take(account common.Address) *big.Int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dust := t.balances[account]
+	delete(t.balances, account)
+	return dust
+}
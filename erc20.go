@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	balanceOfSelector = []byte{0x70, 0xa0, 0x82, 0x31}
+	transferSelector  = []byte{0xa9, 0x05, 0x9c, 0xbb}
+)
+
+const defaultTokenSweepInterval = time.Minute
+
+func balanceOfData(account common.Address) []byte {
+	return append(append([]byte{}, balanceOfSelector...), common.LeftPadBytes(account.Bytes(), 32)...)
+}
+
+func transferData(to common.Address, amount *big.Int) []byte {
+	data := append([]byte{}, transferSelector...)
+	data = append(data, common.LeftPadBytes(to.Bytes(), 32)...)
+	return append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+}
+
+// SweepERC20 periodically moves every configured token balance held by our
+// accounts to their receiver.
+func (c *Chain) SweepERC20(ctx context.Context) error {
+	interval := c.opts.TokenSweepInterval
+	if interval <= 0 {
+		interval = defaultTokenSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, account := range c.addresses() {
+			for _, token := range c.opts.SweepTokens {
+				if c.opts.BlacklistTokens[token] {
+					continue
+				}
+				if _, err := c.sweepToken(ctx, account, token); err != nil {
+					c.log.Warn("couldn't sweep token", "token", token, "from", account, "err", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Chain) tokenBalance(ctx context.Context, token, account common.Address) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	result, err := c.eth.CallContract(ctx, ethereum.CallMsg{To: &token, Data: balanceOfData(account)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 32 {
+		return nil, fmt.Errorf("unexpected balanceOf result %x", result)
+	}
+	return new(big.Int).SetBytes(result[:32]), nil
+}
+
+// sweepToken transfers the token balance of account to its receiver and
+// returns the broadcast transfer, nil when nothing was sent.
+func (c *Chain) sweepToken(ctx context.Context, account, token common.Address) (*types.Transaction, error) {
+	key, ok := c.sweepKeyFor(account)
+	if !ok {
+		return nil, nil
+	}
+
+	balance, err := c.tokenBalance(ctx, token, account)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get balance: %w", err)
+	}
+	if balance.Sign() == 0 {
+		return nil, nil
+	}
+
+	data := transferData(*c.receiverFor(account), balance)
+
+	estimateCtx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	gas, err := c.eth.EstimateGas(estimateCtx, ethereum.CallMsg{From: account, To: &token, Data: data})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't estimate gas: %w", err)
+	}
+
+	gasPrice, err := c.suggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get gas price: %w", err)
+	}
+
+	native, err := c.balanceAt(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get native balance: %w", err)
+	}
+
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	if native.Cmp(fee) < 0 {
+		c.log.Warn("can't fund token sweep", "token", token, "from", account, "amount", balance, "fee", fee, "native_balance", native)
+		return nil, nil
+	}
+
+	unlock := c.lockAccount(account)
+	defer unlock()
+
+	nonce, err := c.nextNonce(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get nonce: %w", err)
+	}
+
+	signedTx, err := key.sign(types.NewTx(&types.LegacyTx{
+		To:       &token,
+		Gas:      gas,
+		GasPrice: gasPrice,
+		Nonce:    nonce,
+		Data:     data,
+	}), c.signer)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't sign transfer: %w", err)
+	}
+
+	if c.opts.DryRun {
+		c.log.Info("[DRY-RUN] would sweep token", "token", token, "from", account, "amount", balance, "replacement_tx", signedTx.Hash())
+		return nil, nil
+	}
+
+	if err = c.sendTransaction(ctx, signedTx); err != nil {
+		c.nonces.forget(account)
+		return nil, fmt.Errorf("couldn't send transfer: %w", err)
+	}
+	c.nonces.used(account, signedTx)
+	c.confirmations.watch(account, signedTx)
+
+	c.log.Info("swept token", "token", token, "from", account, "amount", balance, "replacement_tx", signedTx.Hash(), "gas_price", signedTx.GasPrice())
+	return signedTx, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var testToken = common.HexToAddress("0x5555555555555555555555555555555555555555")
+
+// tokenBackend answers balanceOf calls to testToken from balances, the
+// simulated chain has no token deployed.
+type tokenBackend struct {
+	*backends.SimulatedBackend
+	balances map[common.Address]*big.Int
+}
+
+func (b tokenBackend) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if msg.To != nil && *msg.To == testToken && len(msg.Data) == 36 {
+		balance, ok := b.balances[common.BytesToAddress(msg.Data[4:])]
+		if !ok {
+			balance = new(big.Int)
+		}
+		return common.LeftPadBytes(balance.Bytes(), 32), nil
+	}
+	return b.SimulatedBackend.CallContract(ctx, msg, blockNumber)
+}
+
+func TestTokenCallData(t *testing.T) {
+	account := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	if got, want := hexutil.Encode(balanceOfData(account)), "0x70a08231"+"00000000000000000000000000000000000000000000000000000000000000aa"; got != want {
+		t.Fatalf("balanceOfData() = %s, want %s", got, want)
+	}
+
+	got := hexutil.Encode(transferData(account, big.NewInt(0x1234)))
+	want := "0xa9059cbb" + "00000000000000000000000000000000000000000000000000000000000000aa" + "0000000000000000000000000000000000000000000000000000000000001234"
+	if got != want {
+		t.Fatalf("transferData() = %s, want %s", got, want)
+	}
+}
+
+func TestSweepToken(t *testing.T) {
+	key, account := newTestKey(t)
+	sim, accounts := newSimulatedBackend(t, key)
+	amount := big.NewInt(1_000_000)
+	backend := tokenBackend{SimulatedBackend: sim, balances: map[common.Address]*big.Int{account: amount}}
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, accounts, Options{SweepTokens: []common.Address{testToken}})
+	ctx := context.Background()
+
+	sweepTx, err := chain.sweepToken(ctx, account, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sweepTx == nil {
+		t.Fatal("sweepToken() sent nothing")
+	}
+	if *sweepTx.To() != testToken {
+		t.Fatalf("sweep sent to %s, want the token %s", sweepTx.To(), testToken)
+	}
+	if got, want := hexutil.Encode(sweepTx.Data()), hexutil.Encode(transferData(testReceiverAddress, amount)); got != want {
+		t.Fatalf("sweep data = %s, want %s", got, want)
+	}
+	sim.Commit()
+	if receipt, err := sim.TransactionReceipt(ctx, sweepTx.Hash()); err != nil || receipt.Status != 1 {
+		t.Fatalf("sweep receipt = %v, %v, want a successful one", receipt, err)
+	}
+}
+
+func TestSweepTokenSkipsEmptyBalances(t *testing.T) {
+	key, account := newTestKey(t)
+	sim, accounts := newSimulatedBackend(t, key)
+	backend := tokenBackend{SimulatedBackend: sim}
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, accounts, Options{})
+
+	sweepTx, err := chain.sweepToken(context.Background(), account, testToken)
+	if err != nil || sweepTx != nil {
+		t.Fatalf("sweepToken() = %v, %v, want nothing sent", sweepTx, err)
+	}
+}
+
+func TestSweepERC20SkipsBlacklistedTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		blacklist map[common.Address]bool
+		wantNonce uint64
+	}{
+		{"blacklisted", map[common.Address]bool{testToken: true}, 0},
+		{"allowed", nil, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, account := newTestKey(t)
+			sim, accounts := newSimulatedBackend(t, key)
+			backend := tokenBackend{SimulatedBackend: sim, balances: map[common.Address]*big.Int{account: big.NewInt(1_000_000)}}
+			chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, accounts, Options{SweepTokens: []common.Address{testToken}, BlacklistTokens: test.blacklist})
+
+			// A done context stops the sweeper after its first round.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := chain.SweepERC20(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if nonce, err := sim.PendingNonceAt(context.Background(), account); err != nil || nonce != test.wantNonce {
+				t.Fatalf("pending nonce = %d, %v, want %d", nonce, err, test.wantNonce)
+			}
+		})
+	}
+}
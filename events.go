@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ReplacementEvent is the line written to the event stream for every
+// decision about a pending tx of a controlled or observed account. Status is
+// one of sent, failed, skipped, dry_run or observed, the replacement fields
+// are only set once a replacement was built.
+type ReplacementEvent struct {
+	Time          time.Time      `json:"time"`
+	Chain         string         `json:"chain"`
+	Status        string         `json:"status"`
+	From          common.Address `json:"from"`
+	OrigTx        common.Hash    `json:"orig_tx"`
+	ReplacementTx *common.Hash   `json:"replacement_tx,omitempty"`
+	Value         string         `json:"value,omitempty"`
+	GasPrice      string         `json:"gas_price,omitempty"`
+	Reason        string         `json:"reason,omitempty"`
+}
+
+// EventStream writes replacement events as newline delimited JSON, e.g. to
+// stdout while logs go to stderr. A nil *EventStream drops them.
+type EventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewEventStream(w io.Writer) *EventStream {
+	return &EventStream{enc: json.NewEncoder(w)}
+}
+
+func (s *EventStream) write(event ReplacementEvent) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(event); err != nil {
+		slog.Warn("couldn't write event", "err", err)
+	}
+}
+
+// replacementEvent streams the decision about replacing tx. signedTx is nil
+// when no replacement was signed.
+func (c *Chain) replacementEvent(status string, from common.Address, tx, signedTx *types.Transaction, reason string) {
+	event := ReplacementEvent{
+		Time:   time.Now().UTC(),
+		Chain:  c.name,
+		Status: status,
+		From:   from,
+		OrigTx: tx.Hash(),
+		Reason: reason,
+	}
+	if signedTx != nil {
+		hash := signedTx.Hash()
+		event.ReplacementTx = &hash
+		event.Value = signedTx.Value().String()
+		event.GasPrice = signedTx.GasPrice().String()
+	}
+	c.opts.Events.write(event)
+}
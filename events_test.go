@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// readEvents decodes the NDJSON events in out.
+func readEvents(t *testing.T, out *bytes.Buffer) []ReplacementEvent {
+	t.Helper()
+
+	var events []ReplacementEvent
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var event ReplacementEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("event line isn't JSON: %v: %s", err, scanner.Bytes())
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestReplacementEvents(t *testing.T) {
+	var out bytes.Buffer
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, Events: NewEventStream(&out), ChainName: "sim", MinValue: big.NewInt(params.Ether / 10)}, key)
+	ctx := context.Background()
+
+	orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+	chain.replacePending(ctx, orig, time.Now())
+	dust := signTestTx(t, chain.signer, key, testAttacker, 1, big.NewInt(1), big.NewInt(params.GWei))
+	chain.replacePending(ctx, dust, time.Now())
+
+	events := readEvents(t, &out)
+	if len(events) != 2 {
+		t.Fatalf("wrote %d events, want 2", len(events))
+	}
+	sent := events[0]
+	replacementTx := backend.sentTxs()[0]
+	if sent.Status != statusSent || sent.Chain != "sim" || sent.From != account || sent.OrigTx != orig.Hash() ||
+		sent.ReplacementTx == nil || *sent.ReplacementTx != replacementTx.Hash() || sent.Value != replacementTx.Value().String() {
+		t.Fatalf("sent event = %+v, want the replacement of %s", sent, orig.Hash())
+	}
+	if skipped := events[1]; skipped.Status != statusSkipped || skipped.OrigTx != dust.Hash() || skipped.ReplacementTx != nil || skipped.Reason == "" {
+		t.Fatalf("skipped event = %+v, want a skip of %s with a reason", skipped, dust.Hash())
+	}
+}
+
+func TestEventStreamNilIsNoop(t *testing.T) {
+	var s *EventStream
+	s.write(ReplacementEvent{Status: statusSent})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// panicRestartDelay is how long a scanner that panicked waits before it is
+// started again.
+const panicRestartDelay = 5 * time.Second
+
+// ChainRunner keeps one endpoint of a chain connected at a time, failing over
+// to the next one whenever the connection or one of its scanners dies.
+type ChainRunner struct {
+	config   ChainConfig
+	receiver common.Address
+	accounts *AccountStore
+	opts     Options
+	log      *slog.Logger
+}
+
+func NewChainRunner(config ChainConfig, receiver common.Address, accounts *AccountStore, opts Options) *ChainRunner {
+	return &ChainRunner{
+		config:   config,
+		receiver: receiver,
+		accounts: accounts,
+		opts:     opts,
+		log:      slog.Default().With("chain", config.Name),
+	}
+}
+
+// Run serves the chain until ctx is done. An endpoint serving another chain
+// than expected is dropped from the rotation, Run fails once none is left.
+func (r *ChainRunner) Run(ctx context.Context) error {
+	var (
+		prev  *Chain
+		delay = minReconnectDelay
+		peers map[string]*ethclient.Client
+	)
+	if r.opts.BroadcastAll {
+		peers = r.dialPeers(ctx)
+		defer func() {
+			for _, peer := range peers {
+				peer.Close()
+			}
+		}()
+	}
+
+	endpoints := slices.Clone(r.config.Endpoints)
+	for i := 0; ctx.Err() == nil; {
+		endpoint := endpoints[i]
+		last, next := i == len(endpoints)-1, i+1
+
+		chain, err := Connect(ctx, endpoint.URL, r.receiver, r.accounts, r.opts)
+		if errors.Is(err, ErrChainIDMismatch) {
+			r.log.Error("endpoint serves another chain, dropping it", "endpoint", endpoint.URL, "err", err)
+			if peer, ok := peers[endpoint.URL]; ok {
+				peer.Close()
+				delete(peers, endpoint.URL)
+			}
+			endpoints = slices.Delete(endpoints, i, i+1)
+			if len(endpoints) == 0 {
+				return fmt.Errorf("no endpoint left: %w", err)
+			}
+			next = i
+		} else if err != nil {
+			r.log.Error("couldn't connect", "endpoint", endpoint.URL, "err", err)
+		} else {
+			if prev != nil {
+				chain.carryOver(prev)
+			} else {
+				r.opts.State.restore(chain.name, chain)
+			}
+			prev = chain
+			for url, peer := range peers {
+				if url != endpoint.URL {
+					chain.peers = append(chain.peers, peer)
+				}
+			}
+
+			mode := r.modeFor(endpoint)
+			r.log.Info("connected", "endpoint", endpoint.URL, "mode", mode)
+			r.opts.Admin.register(chain.name, chain)
+			err = r.serve(ctx, chain, mode)
+			r.opts.Admin.unregister(chain.name)
+			if ctx.Err() != nil {
+				break
+			}
+			r.log.Warn("endpoint failed, failing over", "endpoint", endpoint.URL, "err", err)
+			delay = minReconnectDelay
+		}
+
+		// Back off once every endpoint has been tried.
+		if last {
+			if !sleepContext(ctx, delay) {
+				break
+			}
+			delay = nextReconnectDelay(delay)
+		}
+		i = next % len(endpoints)
+	}
+	return nil
+}
+
+// dialPeers connects to every endpoint of the chain for broadcasting.
+// Endpoints that can't be reached are left out.
+func (r *ChainRunner) dialPeers(ctx context.Context) map[string]*ethclient.Client {
+	peers := make(map[string]*ethclient.Client, len(r.config.Endpoints))
+	for _, endpoint := range r.config.Endpoints {
+		client, err := dialRPC(ctx, endpoint.URL, r.opts.Proxy)
+		if err != nil {
+			r.log.Warn("couldn't connect to endpoint for broadcasting", "endpoint", endpoint.URL, "err", err)
+			continue
+		}
+		peers[endpoint.URL] = ethclient.NewClient(client)
+	}
+	return peers
+}
+
+// modeFor returns the configured mode of endpoint, falling back to polling
+// when pending subscriptions were asked for over HTTP.
+func (r *ChainRunner) modeFor(endpoint Endpoint) string {
+	mode := r.config.modeFor(endpoint)
+	if mode != ModePending {
+		return mode
+	}
+
+	// Config validation already rejected unparseable endpoints.
+	if ok, _ := supportsSubscriptions(endpoint.URL); !ok {
+		r.log.Warn("endpoint can't serve pending subscriptions, polling balances instead", "endpoint", endpoint.URL)
+		return ModePoll
+	}
+	return mode
+}
+
+// serve runs the scanners for mode until one of them fails or ctx is done.
+func (r *ChainRunner) serve(ctx context.Context, chain *Chain, mode string) error {
+	scanners := map[string]func(context.Context) error{}
+	switch mode {
+	case ModePoll:
+		scanners["balance poller"] = func(ctx context.Context) error {
+			return chain.SweepOnBalance(ctx, r.opts.PollInterval)
+		}
+	default:
+		scanners["head stream"] = chain.headStream
+		scanners["incoming scanner"] = chain.ScanIncoming
+		scanners["pending scanner"] = chain.ScanPending
+		if r.opts.RebumpBlocks > 0 {
+			scanners["replacement chaser"] = chain.ChaseReplacements
+		}
+		if r.opts.ConfirmBlocks > 0 {
+			scanners["confirmation watcher"] = chain.WatchConfirmations
+		}
+	}
+	if len(r.opts.SweepTokens) > 0 {
+		scanners["token sweeper"] = chain.SweepERC20
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(scanners))
+	for name, scan := range scanners {
+		r.log.Info("starting "+name, "endpoint", chain.endpoint)
+		go func(name string, scan func(context.Context) error) {
+			if err := r.supervise(ctx, name, scan); err != nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+				return
+			}
+			errs <- nil
+		}(name, scan)
+	}
+
+	var err error
+	remaining := len(scanners)
+	for ; remaining > 0 && err == nil; remaining-- {
+		err = <-errs
+	}
+	cancel()
+	for ; remaining > 0; remaining-- {
+		<-errs
+	}
+	return err
+}
+
+// supervise runs scan, restarting it after panicRestartDelay whenever it
+// panics so a bug triggered by one tx doesn't take down every chain.
+func (r *ChainRunner) supervise(ctx context.Context, name string, scan func(context.Context) error) error {
+	for {
+		panicked, err := runRecovered(ctx, scan)
+		if !panicked {
+			return err
+		}
+
+		r.log.Error(name+" panicked, restarting", "panic", err, "delay", panicRestartDelay)
+		if !sleepContext(ctx, panicRestartDelay) {
+			return nil
+		}
+	}
+}
+
+func runRecovered(ctx context.Context, scan func(context.Context) error) (panicked bool, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			panicked, err = true, fmt.Errorf("%v\n%s", p, debug.Stack())
+		}
+	}()
+	return false, scan(ctx)
+}
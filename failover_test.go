@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testNode serves the few eth_ methods a polling chain needs. The first
+// chainIDFailures chain ID lookups fail.
+type testNode struct {
+	chainID         int64
+	baseFee         *big.Int
+	chainIDFailures atomic.Int64
+	balances        atomic.Int64
+}
+
+func (n *testNode) ChainId() (*hexutil.Big, error) {
+	if n.chainIDFailures.Add(-1) >= 0 {
+		return nil, errors.New("node starting up")
+	}
+	return (*hexutil.Big)(big.NewInt(n.chainID)), nil
+}
+
+func (n *testNode) GetBlockByNumber(number rpc.BlockNumber, full bool) *types.Header {
+	return &types.Header{
+		Number:     big.NewInt(1),
+		Difficulty: new(big.Int),
+		GasLimit:   30_000_000,
+		BaseFee:    n.baseFee,
+	}
+}
+
+func (n *testNode) GetBalance(address common.Address, block rpc.BlockNumberOrHash) *hexutil.Big {
+	n.balances.Add(1)
+	return (*hexutil.Big)(new(big.Int))
+}
+
+// newTestNode serves the eth_ methods of service on an HTTP endpoint and
+// returns its URL.
+func newTestNode(t *testing.T, service any) string {
+	t.Helper()
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	return httpServer.URL
+}
+
+func TestRunnerModeFor(t *testing.T) {
+	runner := NewChainRunner(ChainConfig{Name: "test"}, testReceiverAddress, NewAccountStore(nil), Options{})
+
+	tests := []struct {
+		endpoint Endpoint
+		want     string
+	}{
+		{Endpoint{URL: "ws://localhost:8546"}, ModePending},
+		{Endpoint{URL: "/tmp/geth.ipc"}, ModePending},
+		{Endpoint{URL: "http://localhost:8545"}, ModePoll},
+		{Endpoint{URL: "https://localhost:8545", Mode: ModePending}, ModePoll},
+		{Endpoint{URL: "ws://localhost:8546", Mode: ModePoll}, ModePoll},
+	}
+	for _, test := range tests {
+		if got := runner.modeFor(test.endpoint); got != test.want {
+			t.Errorf("modeFor(%+v) = %q, want %q", test.endpoint, got, test.want)
+		}
+	}
+}
+
+func TestRunFailsOverToNextEndpoint(t *testing.T) {
+	node := &testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)}
+	config := ChainConfig{
+		Name: "test",
+		Endpoints: []Endpoint{
+			{URL: "http://127.0.0.1:1"},
+			{URL: newTestNode(t, node)},
+		},
+	}
+	key, address := newTestKey(t)
+	accounts := NewAccountStore(Accounts{address: key})
+	opts := Options{
+		ConnectRetries:    1,
+		ConnectRetryDelay: time.Millisecond,
+		PollInterval:      10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewChainRunner(config, testReceiverAddress, accounts, opts).Run(ctx)
+	}()
+
+	for node.balances.Load() == 0 {
+		select {
+		case err := <-done:
+			t.Fatalf("Run returned early: %v", err)
+		case <-ctx.Done():
+			t.Fatal("runner never polled the second endpoint")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestRunDropsEndpointsOfAnotherChain(t *testing.T) {
+	wrong := &testNode{chainID: 1}
+	node := &testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)}
+	config := ChainConfig{
+		Name: "test",
+		Endpoints: []Endpoint{
+			{URL: newTestNode(t, wrong)},
+			{URL: newTestNode(t, node)},
+		},
+	}
+	key, address := newTestKey(t)
+	accounts := NewAccountStore(Accounts{address: key})
+	opts := Options{
+		ExpectedChainID:   big.NewInt(1337),
+		ConnectRetries:    1,
+		ConnectRetryDelay: time.Millisecond,
+		PollInterval:      10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewChainRunner(config, testReceiverAddress, accounts, opts).Run(ctx)
+	}()
+
+	for node.balances.Load() == 0 {
+		select {
+		case err := <-done:
+			t.Fatalf("Run returned early: %v", err)
+		case <-ctx.Done():
+			t.Fatal("runner never polled the right endpoint")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// chainIDFailures counts down on every lookup.
+	if lookups := -wrong.chainIDFailures.Load(); lookups != 1 {
+		t.Fatalf("wrong endpoint's chain ID looked up %d times, want it dropped after 1", lookups)
+	}
+}
+
+func TestRunFailsWhenEveryEndpointServesAnotherChain(t *testing.T) {
+	config := ChainConfig{
+		Name: "test",
+		Endpoints: []Endpoint{
+			{URL: newTestNode(t, &testNode{chainID: 1})},
+			{URL: newTestNode(t, &testNode{chainID: 5})},
+		},
+	}
+	opts := Options{ExpectedChainID: big.NewInt(1337), ConnectRetries: 1, ConnectRetryDelay: time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := NewChainRunner(config, testReceiverAddress, NewAccountStore(nil), opts).Run(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("Run kept cycling through the wrong endpoints")
+	}
+	if !errors.Is(err, ErrChainIDMismatch) {
+		t.Fatalf("Run() = %v, want %v", err, ErrChainIDMismatch)
+	}
+}
+
+func TestRunRecoveredCatchesPanics(t *testing.T) {
+	panicked, err := runRecovered(context.Background(), func(context.Context) error { panic("boom") })
+	if !panicked || err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("runRecovered() = %v, %v, want the panic", panicked, err)
+	}
+
+	want := errors.New("scan failed")
+	panicked, err = runRecovered(context.Background(), func(context.Context) error { return want })
+	if panicked || err != want {
+		t.Fatalf("runRecovered() = %v, %v, want %v", panicked, err, want)
+	}
+}
+
+func TestSuperviseRestartsPanickedScanner(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits out the panic restart delay")
+	}
+	runner := NewChainRunner(ChainConfig{Name: "test"}, testReceiverAddress, NewAccountStore(nil), Options{})
+
+	runs := 0
+	err := runner.supervise(context.Background(), "test scanner", func(context.Context) error {
+		if runs++; runs == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+	if err != nil || runs != 2 {
+		t.Fatalf("supervise() = %v after %d runs, want nil after a restart", err, runs)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	HardwareLedger = "ledger"
+	HardwareTrezor = "trezor"
+)
+
+// HardwareSigner signs with the accounts of a Ledger or Trezor device. The
+// device may ask for confirmation of every signature, so its accounts are
+// only swept, never raced for in the mempool.
+type HardwareSigner struct {
+	// mu serializes signing, the device handles one request at a time.
+	mu       sync.Mutex
+	wallet   accounts.Wallet
+	accounts map[common.Address]accounts.Account
+}
+
+// DialHardwareWallet opens the first connected device of kind and derives
+// count accounts along pathTemplate, like DeriveAccounts does.
+func DialHardwareWallet(kind, pathTemplate string, count int) (*HardwareSigner, error) {
+	var (
+		hub *usbwallet.Hub
+		err error
+	)
+	switch kind {
+	case HardwareLedger:
+		hub, err = usbwallet.NewLedgerHub()
+	case HardwareTrezor:
+		hub, err = usbwallet.NewTrezorHubWithHID()
+	default:
+		return nil, fmt.Errorf("unknown hardware wallet %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wallets := hub.Wallets()
+	if len(wallets) == 0 {
+		return nil, fmt.Errorf("no %s connected", kind)
+	}
+	wallet := wallets[0]
+	if err := wallet.Open(""); err != nil {
+		return nil, fmt.Errorf("couldn't open %s: %w", kind, err)
+	}
+
+	if pathTemplate == "" {
+		pathTemplate = defaultDerivationPath
+	}
+	derived := make(map[common.Address]accounts.Account, count)
+	for index := 0; index < count; index++ {
+		path, err := accounts.ParseDerivationPath(strings.ReplaceAll(pathTemplate, derivationIndex, strconv.Itoa(index)))
+		if err != nil {
+			wallet.Close()
+			return nil, err
+		}
+		account, err := wallet.Derive(path, true)
+		if err != nil {
+			wallet.Close()
+			return nil, fmt.Errorf("couldn't derive %s: %w", path, err)
+		}
+		derived[account.Address] = account
+	}
+	return &HardwareSigner{wallet: wallet, accounts: derived}, nil
+}
+
+// key returns the key for address when the device holds it. It's false on a
+// nil *HardwareSigner.
+func (s *HardwareSigner) key(address common.Address) (accountKey, bool) {
+	if s == nil {
+		return nil, false
+	}
+	account, ok := s.accounts[address]
+	if !ok {
+		return nil, false
+	}
+	return hardwareKey{signer: s, account: account}, true
+}
+
+func (s *HardwareSigner) Addresses() []common.Address {
+	if s == nil {
+		return nil
+	}
+
+	addresses := make([]common.Address, 0, len(s.accounts))
+	for address := range s.accounts {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+type hardwareKey struct {
+	signer  *HardwareSigner
+	account accounts.Account
+}
+
+func (k hardwareKey) sign(tx *types.Transaction, signer types.Signer) (*types.Transaction, error) {
+	k.signer.mu.Lock()
+	signed, err := k.signer.wallet.SignTx(k.account, tx, signer.ChainID())
+	k.signer.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return nil, errors.New("hardware wallet returned another tx")
+	}
+	from, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, err
+	}
+	if from != k.account.Address {
+		return nil, fmt.Errorf("hardware wallet signed as %s instead of %s", from, k.account.Address)
+	}
+	return signed, nil
+}
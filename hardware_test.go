@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testDevice is a hardware wallet signing every tx with key.
+type testDevice struct {
+	accounts.Wallet
+	key *ecdsa.PrivateKey
+}
+
+func (d *testDevice) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), d.key)
+}
+
+// newTestHardwareSigner returns a HardwareSigner for account whose device
+// signs with key.
+func newTestHardwareSigner(key *ecdsa.PrivateKey, account accounts.Account) *HardwareSigner {
+	return &HardwareSigner{wallet: &testDevice{key: key}, accounts: map[common.Address]accounts.Account{account.Address: account}}
+}
+
+func TestHardwareSignerSignsSweepsOnly(t *testing.T) {
+	key, address := newTestKey(t)
+	signer := newTestHardwareSigner(key, accounts.Account{Address: address})
+	sim, _ := newSimulatedBackend(t, key)
+	backend := &recordingBackend{SimulatedBackend: sim}
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, NewAccountStore(nil), Options{BumpPercent: defaultBumpPercent, HardwareSigner: signer})
+	ctx := context.Background()
+
+	// Pending txs aren't raced for, the device may need a confirmation.
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d replacements signed by the device, want none", len(sent))
+	}
+
+	sent, err := chain.sweepNative(ctx, address)
+	if err != nil || len(sent) != 1 {
+		t.Fatalf("sweepNative() = %d txs, %v, want a sweep", len(sent), err)
+	}
+	if from, err := types.Sender(chain.signer, sent[0]); err != nil || from != address {
+		t.Fatalf("sweep signed by %s (%v), want %s", from, err, address)
+	}
+}
+
+func TestHardwareKeyRejectsOtherSigners(t *testing.T) {
+	_, address := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+	key, ok := newTestHardwareSigner(otherKey, accounts.Account{Address: address}).key(address)
+	if !ok {
+		t.Fatal("device doesn't hold its account")
+	}
+
+	tx := types.NewTx(&types.LegacyTx{To: &testReceiverAddress, Gas: transferGas, GasPrice: big.NewInt(params.GWei)})
+	if _, err := key.sign(tx, types.LatestSignerForChainID(big.NewInt(1337))); err == nil {
+		t.Fatal("sign() accepted a tx signed by another account")
+	}
+}
+
+func TestHardwareSignerNilHoldsNothing(t *testing.T) {
+	var signer *HardwareSigner
+	if _, ok := signer.key(testAttacker); ok || len(signer.Addresses()) != 0 {
+		t.Fatal("nil HardwareSigner holds keys")
+	}
+	if _, err := DialHardwareWallet("keepkey", "", 1); err == nil {
+		t.Fatal("DialHardwareWallet() accepted an unknown device")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	defaultDerivationPath = "m/44'/60'/0'/0/{index}"
+	derivationIndex       = "{index}"
+	hardenedOffset        = 0x80000000
+)
+
+var (
+	errInvalidChild    = errors.New("derived key is invalid")
+	errInvalidMnemonic = errors.New("mnemonic isn't a valid BIP-39 phrase, check for typos or missing words")
+)
+
+// DeriveAccounts derives count accounts from a BIP-39 mnemonic, substituting
+// 0..count-1 for {index} in the BIP-32 path template. A mnemonic with a word
+// outside the English wordlist or a wrong checksum is rejected, it would
+// derive accounts nobody controls.
+func DeriveAccounts(mnemonic, passphrase, pathTemplate string, count int) (Accounts, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, errInvalidMnemonic
+	}
+	if pathTemplate == "" {
+		pathTemplate = defaultDerivationPath
+	}
+	if !strings.Contains(pathTemplate, derivationIndex) {
+		return nil, fmt.Errorf("derivation path %q has no %s placeholder", pathTemplate, derivationIndex)
+	}
+
+	// NewSeed leaves normalizing to us, the English wordlist is already NFKD.
+	seed := bip39.NewSeed(mnemonic, norm.NFKD.String(passphrase))
+	masterKey, masterChain := hdMaster(seed)
+
+	derived := make(Accounts)
+	for index := 0; index < count; index++ {
+		path, err := accounts.ParseDerivationPath(strings.ReplaceAll(pathTemplate, derivationIndex, strconv.Itoa(index)))
+		if err != nil {
+			return nil, err
+		}
+
+		key, chainCode := masterKey, masterChain
+		for _, child := range path {
+			if key, chainCode, err = hdChild(key, chainCode, child); err != nil {
+				return nil, fmt.Errorf("couldn't derive %s: %w", path, err)
+			}
+		}
+
+		privateKey, err := crypto.ToECDSA(key)
+		if err != nil {
+			return nil, err
+		}
+		derived[crypto.PubkeyToAddress(privateKey.PublicKey)] = privateKey
+	}
+
+	return derived, nil
+}
+
+func hdMaster(seed []byte) (key, chainCode []byte) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
+
+func hdChild(key, chainCode []byte, index uint32) ([]byte, []byte, error) {
+	var data []byte
+	if index >= hardenedOffset {
+		data = append([]byte{0}, key...)
+	} else {
+		privateKey, err := crypto.ToECDSA(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = crypto.CompressPubkey(&privateKey.PublicKey)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, nil, errInvalidChild
+	}
+
+	child := tweak.Add(tweak, new(big.Int).SetBytes(key))
+	child.Mod(child, n)
+	if child.Sign() == 0 {
+		return nil, nil, errInvalidChild
+	}
+
+	return math.PaddedBigBytes(child, 32), sum[32:], nil
+}
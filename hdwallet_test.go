@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestDeriveAccounts(t *testing.T) {
+	accounts, err := DeriveAccounts(testMnemonic, "", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The well-known first two accounts of the test mnemonic.
+	for _, want := range []string{"0x9858EfFD232B4033E47d90003D41EC34EcaEda94", "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0"} {
+		if _, ok := accounts[common.HexToAddress(want)]; !ok {
+			t.Errorf("accounts = %v, want %s among them", accounts, want)
+		}
+	}
+}
+
+func TestDeriveAccountsIgnoresExtraWhitespace(t *testing.T) {
+	accounts, err := DeriveAccounts("  "+strings.ReplaceAll(testMnemonic, " ", "\n ")+"\n", "", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := accounts[common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")]; !ok {
+		t.Fatalf("accounts = %v, want the first test account", accounts)
+	}
+}
+
+func TestDeriveAccountsWithPassphrase(t *testing.T) {
+	accounts, err := DeriveAccounts(testMnemonic, "TREZOR", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := accounts[common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")]; ok || len(accounts) != 1 {
+		t.Fatalf("accounts = %v, want one account other than the passphrase-less one", accounts)
+	}
+}
+
+func TestDeriveAccountsRejectsInvalidMnemonic(t *testing.T) {
+	for _, mnemonic := range []string{
+		// Wrong checksum word.
+		strings.Repeat("abandon ", 12),
+		// Not in the wordlist.
+		strings.Replace(testMnemonic, "about", "abuot", 1),
+		// Too few words.
+		"abandon about",
+	} {
+		if _, err := DeriveAccounts(mnemonic, "", "", 1); !errors.Is(err, errInvalidMnemonic) {
+			t.Errorf("DeriveAccounts(%q) = %v, want %v", mnemonic, err, errInvalidMnemonic)
+		}
+	}
+}
+
+func TestDeriveAccountsRequiresIndexPlaceholder(t *testing.T) {
+	if _, err := DeriveAccounts(testMnemonic, "", "m/44'/60'/0'/0/0", 1); err == nil {
+		t.Fatal("DeriveAccounts() = nil, want an error for a path without {index}")
+	}
+}
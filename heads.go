@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// headBuffer is how many headers a slow consumer may lag behind before it
+// holds back the others.
+const headBuffer = 16
+
+// headFanout hands every new header to each subscribed consumer.
+type headFanout struct {
+	mu        sync.Mutex
+	consumers map[chan *types.Header]struct{}
+}
+
+func newHeadFanout() *headFanout {
+	return &headFanout{consumers: make(map[chan *types.Header]struct{})}
+}
+
+func (f *headFanout) subscribe() (heads <-chan *types.Header, unsubscribe func()) {
+	ch := make(chan *types.Header, headBuffer)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.consumers[ch] = struct{}{}
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		delete(f.consumers, ch)
+	}
+}
+
+func (f *headFanout) publish(ctx context.Context, header *types.Header) {
+	f.mu.Lock()
+	consumers := make([]chan *types.Header, 0, len(f.consumers))
+	for ch := range f.consumers {
+		consumers = append(consumers, ch)
+	}
+	f.mu.Unlock()
+
+	for _, ch := range consumers {
+		select {
+		case ch <- header:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// headStream keeps a new head subscription up, resubscribing with backoff
+// when it drops, and publishes every header to the chain's head consumers.
+// It gives up after maxSubscribeAttempts failed attempts in a row, and polls
+// the latest header instead when the endpoint can't subscribe at all.
+func (c *Chain) headStream(ctx context.Context) error {
+	delay := minReconnectDelay
+	for attempt := 1; ctx.Err() == nil; attempt++ {
+		headChan := make(chan *types.Header)
+		sub, err := c.eth.SubscribeNewHead(ctx, headChan)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if isUnsupported(err) {
+				c.log.Warn("head subscriptions unsupported, polling the latest header instead", "interval", c.opts.pollInterval(), "err", err)
+				return c.pollHeads(ctx, c.opts.pollInterval())
+			}
+			if attempt >= maxSubscribeAttempts {
+				return fmt.Errorf("couldn't subscribe to new heads after %d attempts: %w", attempt, err)
+			}
+			c.log.Warn("couldn't subscribe to new heads", "retry_in", delay, "err", err)
+			if !sleepContext(ctx, delay) {
+				break
+			}
+			delay = nextReconnectDelay(delay)
+			continue
+		}
+		delay, attempt = minReconnectDelay, 0
+
+		c.opts.Metrics.subscribed(c.name, 1)
+		err = c.forwardHeads(ctx, sub.Err(), headChan)
+		sub.Unsubscribe()
+		c.opts.Metrics.subscribed(c.name, -1)
+		if err != nil {
+			c.log.Warn("head subscription dropped, resubscribing", "err", err)
+		}
+	}
+	return nil
+}
+
+func (c *Chain) forwardHeads(ctx context.Context, subErr <-chan error, headChan <-chan *types.Header) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-subErr:
+			return err
+		case header := <-headChan:
+			c.heads.publish(ctx, header)
+		}
+	}
+}
+
+// pollHeads publishes the latest header every interval whenever it moved on
+// since the last poll.
+func (c *Chain) pollHeads(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *types.Header
+	for {
+		headerCtx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+		header, err := c.eth.HeaderByNumber(headerCtx, nil)
+		cancel()
+		switch {
+		case err != nil && ctx.Err() == nil:
+			c.log.Warn("couldn't poll latest header", "err", err)
+		case err == nil && (last == nil || header.Hash() != last.Hash()):
+			last = header
+			c.heads.publish(ctx, header)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// headSubscription is a head subscription handed out by headBackend.
+type headSubscription struct {
+	*testSubscription
+	heads chan<- *types.Header
+}
+
+// headBackend hands out head subscriptions the test feeds and drops, after
+// failing subscribes with errs in turn.
+type headBackend struct {
+	*backends.SimulatedBackend
+	errs []error
+	subs chan headSubscription
+}
+
+func (b *headBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	if len(b.errs) > 0 {
+		err := b.errs[0]
+		b.errs = b.errs[1:]
+		return nil, err
+	}
+	sub := headSubscription{testSubscription: newTestSubscription(), heads: ch}
+	b.subs <- sub
+	return sub, nil
+}
+
+func (b *headBackend) nextSubscription(t *testing.T) headSubscription {
+	t.Helper()
+
+	select {
+	case sub := <-b.subs:
+		return sub
+	case <-time.After(5 * time.Second):
+		t.Fatal("no head subscription")
+		return headSubscription{}
+	}
+}
+
+// nextHead waits for the next header published to heads.
+func nextHead(t *testing.T, heads <-chan *types.Header) *types.Header {
+	t.Helper()
+
+	select {
+	case header := <-heads:
+		return header
+	case <-time.After(5 * time.Second):
+		t.Fatal("no header published")
+		return nil
+	}
+}
+
+// startHeadStream runs headStream on chain until the test ends.
+func startHeadStream(t *testing.T, chain *Chain) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- chain.headStream(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("headStream() = %v, want nil once cancelled", err)
+		}
+	})
+}
+
+func TestHeadStreamResubscribesWhenDropped(t *testing.T) {
+	sim, accounts := newSimulatedBackend(t)
+	backend := &headBackend{SimulatedBackend: sim, subs: make(chan headSubscription, 4)}
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, accounts, Options{})
+	heads, unsubscribe := chain.heads.subscribe()
+	defer unsubscribe()
+	startHeadStream(t, chain)
+
+	first := backend.nextSubscription(t)
+	first.heads <- &types.Header{Number: big.NewInt(1)}
+	if header := nextHead(t, heads); header.Number.Int64() != 1 {
+		t.Fatalf("published header %s, want 1", header.Number)
+	}
+
+	first.err <- errors.New("connection reset")
+	second := backend.nextSubscription(t)
+	second.heads <- &types.Header{Number: big.NewInt(2)}
+	if header := nextHead(t, heads); header.Number.Int64() != 2 {
+		t.Fatalf("published header %s after resubscribing, want 2", header.Number)
+	}
+}
+
+func TestHeadStreamPollsWhenUnsupported(t *testing.T) {
+	sim, accounts := newSimulatedBackend(t)
+	backend := &headBackend{SimulatedBackend: sim, errs: []error{errors.New("notifications not supported")}, subs: make(chan headSubscription, 4)}
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, accounts, Options{PollInterval: 5 * time.Millisecond})
+	heads, unsubscribe := chain.heads.subscribe()
+	defer unsubscribe()
+	startHeadStream(t, chain)
+
+	if header := nextHead(t, heads); header.Number.Int64() != 0 {
+		t.Fatalf("polled header %s, want the genesis", header.Number)
+	}
+	// Only a new block is published again.
+	sim.Commit()
+	if header := nextHead(t, heads); header.Number.Int64() != 1 {
+		t.Fatalf("polled header %s, want 1", header.Number)
+	}
+}
+
+func TestHeadFanoutPublishesToEveryConsumer(t *testing.T) {
+	fanout := newHeadFanout()
+	first, unsubscribeFirst := fanout.subscribe()
+	second, unsubscribeSecond := fanout.subscribe()
+	defer unsubscribeSecond()
+
+	fanout.publish(context.Background(), &types.Header{Number: big.NewInt(1)})
+	nextHead(t, first)
+	nextHead(t, second)
+
+	// Unsubscribed consumers aren't waited for.
+	unsubscribeFirst()
+	for i := 0; i <= headBuffer; i++ {
+		fanout.publish(context.Background(), &types.Header{Number: big.NewInt(2)})
+		nextHead(t, second)
+	}
+}
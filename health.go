@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Health tracks whether each endpoint currently has a live subscription and
+// serves the result on /healthz.
+type Health struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointHealth
+}
+
+type endpointHealth struct {
+	chain     string
+	endpoint  string
+	connected atomic.Bool
+	// lastEvent is the unix nanos of the last tx or poll seen on endpoint.
+	lastEvent atomic.Int64
+}
+
+type endpointStatus struct {
+	Chain     string     `json:"chain"`
+	Endpoint  string     `json:"endpoint"`
+	Connected bool       `json:"connected"`
+	LastEvent *time.Time `json:"last_event,omitempty"`
+}
+
+func NewHealth() *Health {
+	return &Health{endpoints: make(map[string]*endpointHealth)}
+}
+
+// endpoint returns the state of endpoint, shared by every connection made to
+// it. It returns nil on a nil *Health.
+func (h *Health) endpoint(chain, endpoint string) *endpointHealth {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, ok := h.endpoints[endpoint]
+	if !ok {
+		e = &endpointHealth{endpoint: endpoint}
+		h.endpoints[endpoint] = e
+	}
+	e.chain = chain
+	return e
+}
+
+func (h *Health) statuses() []endpointStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	statuses := make([]endpointStatus, 0, len(h.endpoints))
+	for _, e := range h.endpoints {
+		status := endpointStatus{Chain: e.chain, Endpoint: e.endpoint, Connected: e.connected.Load()}
+		if nanos := e.lastEvent.Load(); nanos != 0 {
+			lastEvent := time.Unix(0, nanos).UTC()
+			status.LastEvent = &lastEvent
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Endpoint < statuses[j].Endpoint })
+	return statuses
+}
+
+// ServeHTTP responds 200 while at least one endpoint is connected and 503
+// otherwise, listing every endpoint's state either way.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	statuses := h.statuses()
+
+	code := http.StatusServiceUnavailable
+	for _, status := range statuses {
+		if status.Connected {
+			code = http.StatusOK
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// The methods below are no-ops on a nil *endpointHealth so chains can run
+// without a health server.
+
+func (e *endpointHealth) setConnected(connected bool) {
+	if e == nil {
+		return
+	}
+	e.connected.Store(connected)
+}
+
+func (e *endpointHealth) event() {
+	if e == nil {
+		return
+	}
+	e.lastEvent.Store(time.Now().UnixNano())
+}
+
+// ServeHealth exposes health on addr until ctx is cancelled.
+func ServeHealth(ctx context.Context, addr string, health *Health) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", health)
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("serving health", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("health server failed", "err", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// checkHealth requests health and returns the status code and body.
+func checkHealth(t *testing.T, health *Health) (int, []endpointStatus) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	health.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var statuses []endpointStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, statuses
+}
+
+func TestHealthTracksConnections(t *testing.T) {
+	health := NewHealth()
+	first := health.endpoint("mainnet", "ws://a")
+	second := health.endpoint("mainnet", "ws://b")
+
+	if code, statuses := checkHealth(t, health); code != http.StatusServiceUnavailable || len(statuses) != 2 {
+		t.Fatalf("health = %d with %d endpoints, want 503 with 2", code, len(statuses))
+	}
+
+	first.setConnected(true)
+	first.event()
+	code, statuses := checkHealth(t, health)
+	if code != http.StatusOK {
+		t.Fatalf("health = %d with a connected endpoint, want 200", code)
+	}
+	if !statuses[0].Connected || statuses[0].LastEvent == nil || statuses[0].Chain != "mainnet" {
+		t.Fatalf("status = %+v, want ws://a connected with a last event", statuses[0])
+	}
+	if statuses[1].Connected || statuses[1].LastEvent != nil {
+		t.Fatalf("status = %+v, want ws://b disconnected without events", statuses[1])
+	}
+
+	first.setConnected(false)
+	second.setConnected(false)
+	if code, _ := checkHealth(t, health); code != http.StatusServiceUnavailable {
+		t.Fatalf("health = %d once disconnected, want 503", code)
+	}
+}
+
+func TestHealthSharesEndpointsAcrossConnections(t *testing.T) {
+	health := NewHealth()
+	health.endpoint("mainnet", "ws://a").setConnected(true)
+
+	// A reconnect picks the same state up.
+	if !health.endpoint("mainnet", "ws://a").connected.Load() {
+		t.Fatal("reconnected endpoint lost its state")
+	}
+
+	// Chains run without a health server.
+	var none *Health
+	none.endpoint("mainnet", "ws://a").setConnected(true)
+	none.endpoint("mainnet", "ws://a").event()
+}
+
+func TestScanPendingReportsHealth(t *testing.T) {
+	health := NewHealth()
+	source := newTestPendingSource()
+	chain := NewChain(nil, source, types.LatestSignerForChainID(big.NewInt(1)), testReceiverAddress, NewAccountStore(nil), Options{})
+	chain.health = health.endpoint(chain.name, "ws://a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- chain.ScanPending(ctx) }()
+	source.nextSubscription(t)
+	waitFor(t, func() bool {
+		code, _ := checkHealth(t, health)
+		return code == http.StatusOK
+	})
+
+	cancel()
+	<-done
+	if code, _ := checkHealth(t, health); code != http.StatusServiceUnavailable {
+		t.Fatalf("health = %d after the scanner stopped, want 503", code)
+	}
+}
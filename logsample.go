@@ -0,0 +1,37 @@
+package main
+
+import "sync"
+
+// logSampler thins out logs of routine per-tx errors during mempool storms:
+// of every `every` occurrences at a site only the first is logged. Logs of
+// replacement decisions and subscriptions aren't sampled.
+type logSampler struct {
+	every  uint64
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newLogSampler(every int) *logSampler {
+	return &logSampler{every: uint64(max(every, 1)), counts: make(map[string]uint64)}
+}
+
+// allow reports whether this occurrence at site should be logged and how many
+// were dropped since the last logged one.
+func (s *logSampler) allow(site string) (bool, uint64) {
+	if s.every == 1 {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := s.counts[site]
+	s.counts[site] = count + 1
+	if count%s.every != 0 {
+		return false, 0
+	}
+	if count == 0 {
+		return true, 0
+	}
+	return true, s.every - 1
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestLogSamplerAllow(t *testing.T) {
+	sampler := newLogSampler(3)
+	var logged []uint64
+	for i := 0; i < 7; i++ {
+		if ok, dropped := sampler.allow("sender"); ok {
+			logged = append(logged, dropped)
+		}
+	}
+	// The 1st, 4th and 7th are logged, the later ones with the 2 dropped
+	// before them.
+	if len(logged) != 3 || logged[0] != 0 || logged[1] != 2 || logged[2] != 2 {
+		t.Fatalf("logged occurrences with drops %v, want [0 2 2]", logged)
+	}
+
+	// Sites are sampled apart.
+	if ok, _ := sampler.allow("tx by hash"); !ok {
+		t.Fatal("first occurrence at another site wasn't logged")
+	}
+
+	// Without sampling everything is logged.
+	unsampled := newLogSampler(0)
+	for i := 0; i < 3; i++ {
+		if ok, _ := unsampled.allow("sender"); !ok {
+			t.Fatal("unsampled occurrence wasn't logged")
+		}
+	}
+}
+
+func TestSamplingReducesLogLines(t *testing.T) {
+	tests := []struct {
+		rate int
+		want int
+	}{
+		{0, 100},
+		{10, 10},
+	}
+	for _, test := range tests {
+		logs := captureLogs(t)
+		chain, _ := newRecordingChain(t, Options{LogSampleRate: test.rate})
+		unsigned := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1337), To: &testAttacker, GasTipCap: new(big.Int), GasFeeCap: new(big.Int), Value: new(big.Int)})
+
+		for i := 0; i < 100; i++ {
+			chain.replacePending(context.Background(), unsigned, time.Now())
+		}
+		if got := strings.Count(logs.String(), "couldn't get sender"); got != test.want {
+			t.Errorf("rate %d: logged %d lines, want %d", test.rate, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLRUCache[int, string](2)
+	cache.Add(1, "one")
+	cache.Add(2, "two")
+	// Reading 1 makes 2 the least recently used.
+	if _, ok := cache.Get(1); !ok {
+		t.Fatal("Get(1) missed")
+	}
+	cache.Add(3, "three")
+
+	if _, ok := cache.Get(2); ok {
+		t.Fatal("Get(2) hit, want it evicted")
+	}
+	for key, want := range map[int]string{1: "one", 3: "three"} {
+		if got, ok := cache.Get(key); !ok || got != want {
+			t.Fatalf("Get(%d) = %q, %v, want %q, true", key, got, ok, want)
+		}
+	}
+}
+
+func TestLRUCacheAddReportsNewKeys(t *testing.T) {
+	cache := newLRUCache[string, int](4)
+	if !cache.Add("a", 1) {
+		t.Fatal("Add() of a new key = false")
+	}
+	if cache.Add("a", 2) {
+		t.Fatal("Add() of a known key = true")
+	}
+	if got, _ := cache.Get("a"); got != 2 {
+		t.Fatalf("Get() = %d, want the updated 2", got)
+	}
+}
+
+func TestLRUCacheKeys(t *testing.T) {
+	cache := newLRUCache[int, struct{}](3)
+	for key := 1; key <= 4; key++ {
+		cache.Add(key, struct{}{})
+	}
+	cache.Get(2)
+
+	if got, want := cache.Keys(), []int{3, 4, 2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Keys() = %v, want %v", got, want)
+	}
+}
+
+func BenchmarkLRUCacheAdd(b *testing.B) {
+	cache := newLRUCache[int, int](defaultSeenCacheSize)
+	for i := 0; i < b.N; i++ {
+		cache.Add(i, i)
+	}
+}
+
+func BenchmarkLRUCacheGet(b *testing.B) {
+	cache := newLRUCache[int, int](defaultSeenCacheSize)
+	for i := 0; i < defaultSeenCacheSize; i++ {
+		cache.Add(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(i % defaultSeenCacheSize)
+	}
+}
@@ -1,257 +1,266 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"crypto/ecdsa"
-	"encoding/json"
 	"errors"
-	"log"
-	"math/big"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
-	"strings"
-	"sync"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/ethclient/gethclient"
-	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-type Config struct {
-	Reciever  common.Address `json:"reciever"`
-	Endpoints []string       `json:"endpoints"`
-}
-
-type Accounts map[common.Address]*ecdsa.PrivateKey
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
 
-type Chain struct {
-	accounts Accounts
-	reciever *common.Address
-	eth      *ethclient.Client
-	geth     *gethclient.Client
-	signer   types.Signer
-}
+// Errors run fails with, each has its own exit code so orchestration can
+// tell bad input from failures while running.
+var (
+	ErrInvalidConfig    = errors.New("invalid config")
+	ErrInvalidAccounts  = errors.New("couldn't load accounts")
+	ErrAllChainsFailed  = errors.New("every chain failed")
+	ErrSomeChainsFailed = errors.New("some chains failed")
+)
 
-func Connect(endpoint string, reciver common.Address, accounts Accounts) (*Chain, error) {
-	rpcClient, err := rpc.Dial(endpoint)
-	if err != nil {
-		return nil, err
-	}
+const (
+	exitFailure = 1 + iota
+	exitConfig
+	exitAccounts
+	exitAllChainsFailed
+	exitSomeChainsFailed
+)
 
-	eth := ethclient.NewClient(rpcClient)
-	chainId, err := eth.ChainID(context.Background())
-	if err != nil {
-		return nil, err
+// exitCode maps the error run returned to the process exit code.
+func exitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, ErrConfigCreated), errors.Is(err, ErrInvalidConfig):
+		return exitConfig
+	case errors.Is(err, ErrInvalidAccounts):
+		return exitAccounts
+	case errors.Is(err, ErrAllChainsFailed):
+		return exitAllChainsFailed
+	case errors.Is(err, ErrSomeChainsFailed):
+		return exitSomeChainsFailed
+	default:
+		return exitFailure
 	}
-
-	signer := types.NewLondonSigner(chainId)
-
-	geth := gethclient.New(rpcClient)
-
-	return &Chain{eth: eth, geth: geth, signer: signer, accounts: accounts, reciever: &reciver}, nil
 }
 
-func (c *Chain) ScanIncoming() error {
-	blockChan := make(chan *types.Header)
-	sub, err := c.eth.SubscribeNewHead(context.Background(), blockChan)
-	if err != nil {
-		return err
-	}
-
-	for {
-		select {
-		case err := <-sub.Err():
-			return err
-		case header := <-blockChan:
-			block, err := c.eth.BlockByHash(context.Background(), header.Hash())
-			if err != nil {
-				log.Printf("couldn't get block by hash %s: %v", header.Hash(), err)
-				continue
-			}
-
-			for _, transaction := range block.Transactions() {
-				if transaction.To() == nil {
-					continue
-				}
-
-				if privateKey, ok := c.accounts[*transaction.To()]; ok {
-					gasPrice, err := c.eth.SuggestGasPrice(context.Background())
-					if err != nil {
-						log.Printf("couldn't get gas price: %v", err)
-						continue
-					}
-
-					nonce, err := c.eth.NonceAt(context.Background(), *transaction.To(), nil)
-					if err != nil {
-						log.Printf("couldn't get nonce for %s: %v", transaction.Hash(), err)
-						continue
-					}
-
-					resendTx := &types.LegacyTx{
-						To:       c.reciever,
-						Value:    new(big.Int).Sub(transaction.Value(), new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(21000))),
-						GasPrice: gasPrice,
-						Gas:      21000,
-						Nonce:    nonce,
-					}
-
-					signedTx, err := types.SignNewTx(privateKey, c.signer, resendTx)
-					if err != nil {
-						log.Printf("couldn't sign replacement tx for %s: %v", transaction.Hash(), err)
-						continue
-					}
-
-					err = c.eth.SendTransaction(context.Background(), signedTx)
-					if err != nil {
-						log.Printf("couldn't send replacement tx for %s: %v", transaction.Hash(), err)
-						continue
-					}
-
-					log.Printf("resend %s with %s", transaction.Hash(), signedTx.Hash())
-
-				}
-
-			}
-		}
+func newLogger(format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
 	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
 }
 
-func (c *Chain) ScanPending() error {
-	txChan := make(chan common.Hash)
-	sub, err := c.geth.SubscribePendingTransactions(context.Background(), txChan)
-	if err != nil {
-		return err
-	}
+// reloadOnHangup re-reads the config and every account source on SIGHUP,
+// swapping the accounts into store and the observe_accounts into observed,
+// and starting or stopping chains that were enabled or disabled. A failed
+// reload keeps the current state.
+func reloadOnHangup(ctx context.Context, configPath, accountsPath string, store *AccountStore, observed *ObserveList, chains *chainSet) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
 
 	for {
 		select {
-		case err := <-sub.Err():
-			return err
-		case txHash := <-txChan:
-			tx, _, err := c.eth.TransactionByHash(context.Background(), txHash)
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			config, err := LoadConfig(configPath)
 			if err != nil {
-				log.Printf("couldn't get tx by hash %s: %v", txHash, err)
+				slog.Error("couldn't reload config, keeping current one", "err", err)
 				continue
 			}
 
-			if tx.To() == nil {
-				continue
-			}
-
-			from, err := c.signer.Sender(tx)
+			accounts, err := LoadAllAccounts(config, accountsPath)
 			if err != nil {
-				log.Printf("couldn't get sender for tx %s: %v", tx.Hash(), err)
+				slog.Error("couldn't reload accounts, keeping current ones", "err", err)
 				continue
 			}
+			store.Set(accounts)
+			slog.Info("reloaded accounts", "count", len(accounts))
+			observed.Set(config.ObserveAccounts)
 
-			if privateKey, ok := c.accounts[from]; ok && tx.To() != c.reciever {
-				gasPrice := new(big.Int).Mul(new(big.Int).Div(tx.GasPrice(), new(big.Int).SetUint64(100)), new(big.Int).SetUint64(11))
-				additionalFees := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(tx.Gas()))
-
-				replacementTx := &types.LegacyTx{
-					To:       c.reciever,
-					Value:    new(big.Int).Sub(tx.Value(), additionalFees),
-					Gas:      tx.Gas(),
-					GasPrice: new(big.Int).Add(gasPrice, tx.GasPrice()),
-					Nonce:    tx.Nonce(),
-				}
-
-				signedTx, err := types.SignNewTx(privateKey, c.signer, replacementTx)
-				if err != nil {
-					log.Printf("couldn't sign replacement tx for %s: %v", tx.Hash(), err)
-					continue
-				}
-
-				err = c.eth.SendTransaction(context.Background(), signedTx)
-				if err != nil {
-					log.Printf("couldn't send replacement tx for %s: %v", tx.Hash(), err)
-					continue
-				}
-
-				log.Printf("replaced %s with %s", tx.Hash(), signedTx.Hash())
-			}
+			chains.apply(config)
 		}
 	}
 }
 
 func main() {
-	configFile, err := os.Open("config.json")
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			log.Println("config file not found, creating empty config")
+	err := run(os.Args[1:])
+	switch {
+	case errors.Is(err, ErrConfigCreated):
+		slog.Error("config file not found, empty config created, configure it now :)")
+	case err != nil && !errors.Is(err, flag.ErrHelp):
+		slog.Error("exiting", "err", err)
+	}
+	os.Exit(exitCode(err))
+}
 
-			configFile, err := os.Create("config.json")
-			if err != nil {
-				log.Fatalf("couldn't create empty config: %v", err)
-			}
+// run parses args and runs the bot until it's interrupted, or the one-shot
+// sweep is done with -once.
+func run(args []string) error {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "path to the config file")
+	accountsPath := flags.String("accounts", "accounts.txt", "path to the private keys file")
+	dryRun := flags.Bool("dry-run", false, "log replacements without broadcasting them")
+	eventsJSON := flags.Bool("events-json", false, "write replacement events to stdout as JSON lines")
+	once := flags.Bool("once", false, "sweep current balances once, wait for them to be mined and exit")
+	selfTest := flags.Bool("selftest", false, "check that every loaded key signs as its account and exit")
+	pprofAddr := flags.String("pprof", "", "serve runtime profiles on this address, e.g. localhost:6060")
+	showVersion := flags.Bool("version", false, "print the version and exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
 
-			var emtpyConfig Config
+	if *showVersion {
+		fmt.Println(version)
+		return nil
+	}
 
-			e := json.NewEncoder(configFile)
-			e.SetIndent("", "   ")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			if err = e.Encode(emtpyConfig); err != nil {
-				log.Fatalf("couldn't encode empty config: %v", err)
-			}
-			log.Fatal("empty config created, configure it now :)")
-		} else {
-			log.Fatalf("unknown error while reading config: %v", err)
-		}
+	config, err := LoadConfig(*configPath)
+	if errors.Is(err, ErrConfigCreated) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
 	}
+	slog.SetDefault(newLogger(config.LogFormat, config.logLevel()))
 
-	var config Config
-	if err = json.NewDecoder(configFile).Decode(&config); err != nil {
-		log.Fatalf("unknown error while decoding config: %v", err)
+	if *dryRun {
+		config.DryRun = true
+	}
+	if config.DryRun {
+		slog.Info("dry-run enabled, replacements won't be broadcast")
 	}
 
-	log.Println("loading accounts...")
-	accountsFile, err := os.Open("accounts.txt")
+	slog.Info("loading accounts...")
+	accounts, err := LoadAllAccounts(config, *accountsPath)
 	if err != nil {
-		log.Fatalf("error while reading accounts: %v", err)
+		return fmt.Errorf("%w: %w", ErrInvalidAccounts, err)
 	}
+	slog.Info("loaded accounts", "count", len(accounts))
 
-	accountsScanner := bufio.NewScanner(accountsFile)
-	accounts := make(Accounts)
-
-	for accountsScanner.Scan() {
-		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(accountsScanner.Text(), "0x"))
+	if *selfTest {
+		declared, err := DeclaredAccounts(config)
 		if err != nil {
-			log.Printf("couldn't convert hex to ecdsa %s: %v", accountsScanner.Text(), err)
-			continue
+			return fmt.Errorf("%w: %w", ErrInvalidAccounts, err)
 		}
-		accounts[crypto.PubkeyToAddress(privateKey.PublicKey)] = privateKey
+		if err := SelfTest(accounts, declared); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidAccounts, err)
+		}
+		slog.Info("self-test passed", "count", len(accounts))
+		return nil
 	}
 
-	log.Printf("loaded %d accounts", len(accounts))
+	store := NewAccountStore(accounts)
 
-	log.Println("parsing endpoints...")
+	opts := config.Options()
+	opts.Stats = NewStats()
+	if *eventsJSON || config.EventsJSON {
+		opts.Events = NewEventStream(os.Stdout)
+	}
+	if config.WebhookURL != "" {
+		opts.Notifiers = append(opts.Notifiers, NewWebhook(config.WebhookURL, time.Duration(config.WebhookTimeout), config.WebhookRetries))
+	}
+	if config.DiscordWebhookURL != "" {
+		opts.Notifiers = append(opts.Notifiers, NewDiscord(config.DiscordWebhookURL))
+	}
+	if config.TelegramBotToken != "" {
+		opts.Notifiers = append(opts.Notifiers, NewTelegram(config.TelegramBotToken, config.TelegramChatID))
+	}
+	if config.ExternalSignerURL != "" {
+		opts.ExternalSigner, err = DialExternalSigner(config.ExternalSignerURL)
+		if err != nil {
+			return fmt.Errorf("couldn't connect to external signer: %w", err)
+		}
+		slog.Info("loaded external signer accounts", "count", len(opts.ExternalSigner.Addresses()))
 
-	var wg sync.WaitGroup
-	for _, endpoint := range config.Endpoints {
-		chain, err := Connect(endpoint, config.Reciever, accounts)
+		err = config.validateReceivers(func(address common.Address) bool {
+			_, ok := opts.ExternalSigner.key(address)
+			return ok
+		})
 		if err != nil {
-			log.Printf("couldn't connect to %s: %v", endpoint, err)
-			continue
+			return fmt.Errorf("%w: %w", ErrInvalidAccounts, err)
 		}
-		wg.Add(2)
-		go func(endpoint string) {
-			go func() {
-				defer wg.Done()
-				log.Printf("starting incoming scanner for %s", endpoint)
-				err := chain.ScanIncoming()
-				log.Println("incoming scanner failed:", endpoint, err)
-			}()
+	}
+	if config.HardwareWallet != "" {
+		opts.HardwareSigner, err = DialHardwareWallet(config.HardwareWallet, config.DerivationPath, max(config.HardwareAccounts, 1))
+		if err != nil {
+			return fmt.Errorf("couldn't open hardware wallet: %w", err)
+		}
+		slog.Info("loaded hardware wallet accounts", "wallet", config.HardwareWallet, "count", len(opts.HardwareSigner.Addresses()))
 
-			go func() {
-				defer wg.Done()
-				log.Printf("starting pending scanner for %s", endpoint)
-				err := chain.ScanPending()
-				log.Println("pending scanner failed:", endpoint, err)
-			}()
-		}(endpoint)
+		err = config.validateReceivers(func(address common.Address) bool {
+			_, ok := opts.HardwareSigner.key(address)
+			return ok
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidAccounts, err)
+		}
+	}
+	if config.PrivateRelayURL != "" {
+		relay, err := DialPrivateRelay(ctx, config.PrivateRelayURL, opts.Proxy)
+		if err != nil {
+			return fmt.Errorf("couldn't connect to private relay: %w", err)
+		}
+		opts.Relay = relay
+	}
+	if config.MetricsAddr != "" {
+		registry := prometheus.NewRegistry()
+		opts.Metrics = NewMetrics(registry)
+		go ServeMetrics(ctx, config.MetricsAddr, registry)
+	}
+	if config.AdminAddr != "" {
+		opts.Admin = NewAdmin(config.AdminToken, opts.Observed, opts.Stats)
+		go ServeAdmin(ctx, config.AdminAddr, opts.Admin)
+	}
+	if config.StateFile != "" {
+		opts.State, err = LoadState(config.StateFile)
+		if err != nil {
+			return fmt.Errorf("couldn't load state from %s: %w", config.StateFile, err)
+		}
+		go opts.State.Persist(ctx)
+	}
+	if *pprofAddr != "" {
+		go ServePprof(ctx, *pprofAddr)
+	}
+	if config.HealthAddr != "" {
+		opts.Health = NewHealth()
+		go ServeHealth(ctx, config.HealthAddr, opts.Health)
+	}
+
+	if *once {
+		return SweepAllOnce(ctx, config, store, opts)
+	}
+
+	slog.Info("parsing endpoints...")
+
+	chains := newChainSet(ctx, store, opts, config.MaxConcurrentChains)
+	chains.apply(config)
+	go reloadOnHangup(ctx, *configPath, *accountsPath, store, opts.Observed, chains)
+
+	select {
+	case <-ctx.Done():
+	case <-chains.idle:
+		slog.Error("no chain left running")
+	}
+	err = chains.wait()
+	if err := opts.State.Save(); err != nil {
+		slog.Error("couldn't save state", "path", config.StateFile, "err", err)
 	}
-	wg.Wait()
+	slog.Info("all scanners stopped")
+	return err
 }
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const testReceiver = "0x1111111111111111111111111111111111111111"
+
+// testKey is a throwaway private key, never fund it.
+const testKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+// writeRunFiles writes config and accounts into a temp dir and returns the
+// args pointing run at them.
+func writeRunFiles(t *testing.T, config, accounts string) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	accountsPath := filepath.Join(dir, "accounts.txt")
+	if config != "" {
+		if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(accountsPath, []byte(accounts), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return []string{"-config", configPath, "-accounts", accountsPath}
+}
+
+func TestRunErrors(t *testing.T) {
+	// Nothing listens on port 1, so connecting fails fast.
+	validConfig := `{"receiver": "` + testReceiver + `", "endpoints": [{"url": "ws://127.0.0.1:1"}], "connect_retry_delay": "1ms"}`
+
+	tests := []struct {
+		name     string
+		config   string
+		accounts string
+		extra    []string
+		want     error
+		exit     int
+	}{
+		{
+			name:     "missing config",
+			accounts: testKey,
+			want:     ErrConfigCreated,
+			exit:     exitConfig,
+		},
+		{
+			name:     "malformed config",
+			config:   `{"receiver": `,
+			accounts: testKey,
+			want:     ErrInvalidConfig,
+			exit:     exitConfig,
+		},
+		{
+			name:     "config without endpoints",
+			config:   `{"receiver": "` + testReceiver + `"}`,
+			accounts: testKey,
+			want:     ErrInvalidConfig,
+			exit:     exitConfig,
+		},
+		{
+			name:     "no usable accounts",
+			config:   validConfig,
+			accounts: "not a key\n",
+			want:     ErrInvalidAccounts,
+			exit:     exitAccounts,
+		},
+		{
+			name:     "receiver is an account",
+			config:   `{"receiver": "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", "endpoints": [{"url": "ws://127.0.0.1:1"}]}`,
+			accounts: testKey,
+			want:     ErrInvalidAccounts,
+			exit:     exitAccounts,
+		},
+		{
+			name:     "every chain failed",
+			config:   validConfig,
+			accounts: testKey,
+			extra:    []string{"-once"},
+			want:     ErrAllChainsFailed,
+			exit:     exitAllChainsFailed,
+		},
+		{
+			name:     "every scanning chain failed",
+			config:   `{"receiver": "` + testReceiver + `", "chains": [{"name": "mainnet", "endpoints": ["` + newTestNode(t, &testNode{chainID: 5}) + `"], "expected_chain_id": 1}]}`,
+			accounts: testKey,
+			want:     ErrAllChainsFailed,
+			exit:     exitAllChainsFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(writeRunFiles(t, tt.config, tt.accounts), tt.extra...)
+			err := run(args)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("run() = %v, want %v", err, tt.want)
+			}
+			if code := exitCode(err); code != tt.exit {
+				t.Fatalf("exitCode(%v) = %d, want %d", err, code, tt.exit)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("boom"), exitFailure},
+		{ErrSomeChainsFailed, exitSomeChainsFailed},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+// captureLogs sends the default logger's JSON output to the returned buffer
+// until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	return captureLogsAt(t, slog.LevelDebug)
+}
+
+// captureLogsAt is captureLogs dropping records below level.
+func captureLogsAt(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &logs
+}
+
+func TestChainLogsCarryChainID(t *testing.T) {
+	logs := captureLogs(t)
+	chain := NewChain(nil, nil, types.LatestSignerForChainID(big.NewInt(137)), testReceiverAddress, NewAccountStore(nil), Options{})
+	chain.log.Info("hello", "from", testReceiverAddress)
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("log isn't JSON: %v: %s", err, logs)
+	}
+	if record["msg"] != "hello" || record["chainID"] != float64(137) || record["from"] != testReceiverAddress.Hex() {
+		t.Fatalf("log record = %v, want msg, chainID and from attrs", record)
+	}
+}
+
+func TestReloadOnHangupSwapsAccounts(t *testing.T) {
+	// Keep a stray SIGHUP from killing the test binary before
+	// reloadOnHangup listens for it.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	clearConfigEnv(t)
+
+	config := `{"chains": [{"name": "off", "endpoints": [{"url": "ws://127.0.0.1:1"}], "receiver": "` + testReceiver + `", "enabled": false}]}`
+	args := writeRunFiles(t, config, testKey)
+	configPath, accountsPath := args[1], args[3]
+
+	store := NewAccountStore(Accounts{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chains := newChainSet(ctx, store, Options{}, 0)
+	go reloadOnHangup(ctx, configPath, accountsPath, store, NewObserveList(nil), chains)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := store.Lookup(testKeyAddress); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("accounts weren't reloaded")
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	chains.wait()
+}
+
+func TestRunFlags(t *testing.T) {
+	clearConfigEnv(t)
+	config := `{"receiver": "` + testReceiver + `", "endpoints": [{"url": "ws://127.0.0.1:1"}]}`
+
+	// The self-test only gets as far as the accounts, from the custom paths.
+	if err := run(append(writeRunFiles(t, config, testKey), "-selftest")); err != nil {
+		t.Fatalf("run() with custom paths = %v, want nil", err)
+	}
+	if err := run([]string{"-version"}); err != nil {
+		t.Fatalf("run(-version) = %v, want nil", err)
+	}
+	if err := run([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("run(-h) = %v, want %v", err, flag.ErrHelp)
+	}
+	if err := run([]string{"-no-such-flag"}); err == nil {
+		t.Fatal("run() accepted an unknown flag")
+	}
+}
+
+func TestNewLoggerFiltersLevels(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range []string{LogFormatJSON, ""} {
+		logger := newLogger(format, slog.LevelInfo)
+		if logger.Enabled(ctx, slog.LevelDebug) || !logger.Enabled(ctx, slog.LevelInfo) {
+			t.Errorf("logger of format %q at info: debug %v, info %v, want only info enabled", format, logger.Enabled(ctx, slog.LevelDebug), logger.Enabled(ctx, slog.LevelInfo))
+		}
+	}
+	if logger := newLogger("", slog.LevelWarn); logger.Enabled(ctx, slog.LevelInfo) {
+		t.Error("logger at warn logs info")
+	}
+}
+
+func TestLookupFailuresLogAtDebug(t *testing.T) {
+	logs := captureLogsAt(t, slog.LevelInfo)
+	chain, _ := newBatchTestChain(t, &testBatcher{err: errors.New("connection reset")})
+
+	chain.replaceFound(context.Background(), []pendingHash{{hash: common.HexToHash("0x01")}})
+	if logs.Len() != 0 {
+		t.Fatalf("logged %s at info, want lookup failures at debug only", logs)
+	}
+}
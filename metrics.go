@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	statusSent    = "sent"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+	statusDryRun  = "dry_run"
+	// statusObserved is a pending tx of an observed account, logged only.
+	statusObserved = "observed"
+)
+
+type Metrics struct {
+	replacements  *prometheus.CounterVec
+	sweptValue    *prometheus.CounterVec
+	subscriptions *prometheus.GaugeVec
+	confirmations *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		replacements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "autowithdraw_replacements_total",
+			Help: "Replacement transactions by outcome.",
+		}, []string{"chain", "status"}),
+		sweptValue: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "autowithdraw_swept_value_wei_total",
+			Help: "Native value sent to receivers, in wei.",
+		}, []string{"chain"}),
+		subscriptions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "autowithdraw_active_subscriptions",
+			Help: "Currently active node subscriptions.",
+		}, []string{"chain"}),
+		confirmations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "autowithdraw_confirmations_total",
+			Help: "Broadcast replacements by whether they got mined.",
+		}, []string{"chain", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "autowithdraw_replacement_latency_seconds",
+			Help:    "Time from receiving a pending hash to broadcasting its replacement.",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"chain"}),
+	}
+	reg.MustRegister(m.replacements, m.sweptValue, m.subscriptions, m.confirmations, m.latency)
+	return m
+}
+
+// The methods below are no-ops on a nil *Metrics so chains can run without
+// a registry.
+
+func (m *Metrics) replacement(chain, status string) {
+	if m == nil {
+		return
+	}
+	m.replacements.WithLabelValues(chain, status).Inc()
+}
+
+func (m *Metrics) swept(chain string, value *big.Int) {
+	if m == nil {
+		return
+	}
+	wei, _ := new(big.Float).SetInt(value).Float64()
+	m.sweptValue.WithLabelValues(chain).Add(wei)
+}
+
+func (m *Metrics) subscribed(chain string, delta float64) {
+	if m == nil {
+		return
+	}
+	m.subscriptions.WithLabelValues(chain).Add(delta)
+}
+
+func (m *Metrics) confirmation(chain, status string) {
+	if m == nil {
+		return
+	}
+	m.confirmations.WithLabelValues(chain, status).Inc()
+}
+
+func (m *Metrics) replacementLatency(chain string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.latency.WithLabelValues(chain).Observe(d.Seconds())
+}
+
+// ServeMetrics exposes reg on addr until ctx is cancelled.
+func ServeMetrics(ctx context.Context, addr string, reg prometheus.Gatherer) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("serving metrics", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("metrics server failed", "err", err)
+	}
+}
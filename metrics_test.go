@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsNilIsNoop(t *testing.T) {
+	var m *Metrics
+	m.replacement("mainnet", statusSent)
+	m.swept("mainnet", big.NewInt(1))
+	m.subscribed("mainnet", 1)
+	m.confirmation("mainnet", "mined")
+	m.replacementLatency("mainnet", time.Second)
+}
+
+func TestMetricsCountReplacements(t *testing.T) {
+	metrics := NewMetrics(prometheus.NewRegistry())
+	key, _ := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{BumpPercent: defaultBumpPercent, Metrics: metrics, ChainName: "sim"}, key)
+	ctx := context.Background()
+
+	orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+	chain.replacePending(ctx, orig, time.Now())
+	sim.Commit()
+
+	if got := testutil.ToFloat64(metrics.replacements.WithLabelValues("sim", statusSent)); got != 1 {
+		t.Fatalf("sent replacements = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.sweptValue.WithLabelValues("sim")); got <= 0 {
+		t.Fatalf("swept value = %v, want the replacement's value", got)
+	}
+	if got := testutil.CollectAndCount(metrics.latency); got != 1 {
+		t.Fatalf("latency series = %d, want 1", got)
+	}
+}
+
+func TestMetricsSubscriptionsGauge(t *testing.T) {
+	metrics := NewMetrics(prometheus.NewRegistry())
+	metrics.subscribed("mainnet", 1)
+	metrics.subscribed("mainnet", 1)
+	metrics.subscribed("mainnet", -1)
+
+	if got := testutil.ToFloat64(metrics.subscriptions.WithLabelValues("mainnet")); got != 1 {
+		t.Fatalf("active subscriptions = %v, want 1", got)
+	}
+}
+
+// latencySamples returns the count and sum of the replacement latencies reg
+// has observed.
+func latencySamples(t *testing.T, reg *prometheus.Registry) (uint64, float64) {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "autowithdraw_replacement_latency_seconds" {
+			histogram := family.GetMetric()[0].GetHistogram()
+			return histogram.GetSampleCount(), histogram.GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+func TestMetricsReplacementLatency(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, Metrics: NewMetrics(reg), ChainName: "sim"}, key)
+	ctx := context.Background()
+
+	// Failed sends aren't observed.
+	backend.errs = []error{errors.New("nonce too low")}
+	seenAt := time.Now().Add(-time.Minute)
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), seenAt)
+	if count, _ := latencySamples(t, reg); count != 0 {
+		t.Fatalf("observed %d latencies after a failed send, want none", count)
+	}
+
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei+1)), seenAt)
+	if count, sum := latencySamples(t, reg); count != 1 || sum < time.Minute.Seconds() {
+		t.Fatalf("observed %d latencies summing to %vs, want one since the hash was seen", count, sum)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// nonceTracker remembers the next nonce of every account we've sent from so
+// back to back sends don't reuse one the node hasn't reported as pending yet.
+// Callers hold the account's lock while reserving and using a nonce.
+type nonceTracker struct {
+	mu   sync.Mutex
+	next map[common.Address]uint64
+	// sent holds the hash of the tx we broadcast at each tracked nonce, to
+	// tell a nonce the node is slow to report from one it dropped.
+	sent map[common.Address]map[uint64]common.Hash
+}
+
+func newNonceTracker() *nonceTracker {
+	return &nonceTracker{next: make(map[common.Address]uint64), sent: make(map[common.Address]map[uint64]common.Hash)}
+}
+
+// used records that tx, broadcast from account, has taken its nonce.
+func (t *nonceTracker) used(account common.Address, tx *types.Transaction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sent[account] == nil {
+		t.sent[account] = make(map[uint64]common.Hash)
+	}
+	t.sent[account][tx.Nonce()] = tx.Hash()
+	if next, ok := t.next[account]; !ok || tx.Nonce() >= next {
+		t.next[account] = tx.Nonce() + 1
+	}
+}
+
+// forget drops what's known about account, e.g. after a failed send, so the
+// next nonce is seeded from the node again.
+func (t *nonceTracker) forget(account common.Address) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.next, account)
+	delete(t.sent, account)
+}
+
+// sentAt returns the hash of the tx we broadcast at nonce of account and
+// drops the hashes of lower nonces, which the node has already accounted for.
+func (t *nonceTracker) sentAt(account common.Address, nonce uint64) (common.Hash, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for n := range t.sent[account] {
+		if n < nonce {
+			delete(t.sent[account], n)
+		}
+	}
+	hash, ok := t.sent[account][nonce]
+	return hash, ok
+}
+
+func (t *nonceTracker) lookup(account common.Address) (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	next, ok := t.next[account]
+	return next, ok
+}
+
+func (t *nonceTracker) snapshot() map[common.Address]uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	next := make(map[common.Address]uint64, len(t.next))
+	for account, nonce := range t.next {
+		next[account] = nonce
+	}
+	return next
+}
+
+// restore merges next nonces saved by snapshot, keeping the higher nonce of
+// accounts already tracked.
+func (t *nonceTracker) restore(next map[common.Address]uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for account, nonce := range next {
+		if current, ok := t.next[account]; !ok || nonce > current {
+			t.next[account] = nonce
+		}
+	}
+}
+
+// nextNonce returns the nonce for a new tx from account, whichever is higher
+// of the node's pending nonce and the one tracked locally. The tracked nonce
+// is dropped once the account's mined nonce catches up with it, or when it's
+// ahead because the tx we sent at the node's pending nonce is gone, e.g.
+// evicted from the pool, as sending past the gap would queue forever.
+func (c *Chain) nextNonce(ctx context.Context, account common.Address) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	defer cancel()
+
+	pending, err := c.eth.PendingNonceAt(ctx, account)
+	if err != nil {
+		return 0, err
+	}
+
+	next, ok := c.nonces.lookup(account)
+	if !ok {
+		return pending, nil
+	}
+	if next <= pending {
+		mined, err := c.eth.NonceAt(ctx, account, nil)
+		if err != nil {
+			return 0, err
+		}
+		if mined >= next {
+			c.nonces.forget(account)
+		}
+		return pending, nil
+	}
+
+	hash, ok := c.nonces.sentAt(account, pending)
+	if ok {
+		_, _, err = c.eth.TransactionByHash(ctx, hash)
+		if err == nil {
+			return next, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return 0, err
+		}
+	}
+	c.log.Warn("dropping tracked nonce ahead of the node's pending one", "account", account, "tracked", next, "pending", pending)
+	c.nonces.forget(account)
+	return pending, nil
+}
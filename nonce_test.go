@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func nonceTx(nonce uint64) *types.Transaction {
+	return types.NewTx(&types.LegacyTx{Nonce: nonce})
+}
+
+func TestNonceTracker(t *testing.T) {
+	tracker := newNonceTracker()
+	account := common.HexToAddress("0x01")
+
+	if _, ok := tracker.lookup(account); ok {
+		t.Fatal("untracked account has a nonce")
+	}
+	tracker.used(account, nonceTx(3))
+	// An older nonce doesn't move the next one back.
+	tracker.used(account, nonceTx(1))
+	if next, ok := tracker.lookup(account); !ok || next != 4 {
+		t.Fatalf("lookup() = %d, %v, want 4, true", next, ok)
+	}
+	if hash, ok := tracker.sentAt(account, 3); !ok || hash != nonceTx(3).Hash() {
+		t.Fatalf("sentAt(3) = %s, %v, want the tx sent at 3", hash, ok)
+	}
+	if _, ok := tracker.sentAt(account, 1); ok {
+		t.Fatal("sentAt() kept a nonce below the one asked for")
+	}
+
+	tracker.forget(account)
+	if _, ok := tracker.lookup(account); ok {
+		t.Fatal("forgotten account has a nonce")
+	}
+	if _, ok := tracker.sentAt(account, 3); ok {
+		t.Fatal("forgotten account has a sent tx")
+	}
+}
+
+func TestNonceTrackerRestoreKeepsHigherNonces(t *testing.T) {
+	tracker := newNonceTracker()
+	ahead, behind := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	tracker.used(ahead, nonceTx(9))
+	tracker.used(behind, nonceTx(1))
+
+	tracker.restore(map[common.Address]uint64{ahead: 5, behind: 7})
+	want := map[common.Address]uint64{ahead: 10, behind: 7}
+	for account, nonce := range tracker.snapshot() {
+		if nonce != want[account] {
+			t.Errorf("next nonce of %s = %d, want %d", account, nonce, want[account])
+		}
+	}
+}
+
+func TestNextNonceTracksUnminedSends(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	if nonce, err := chain.nextNonce(ctx, account); err != nil || nonce != 0 {
+		t.Fatalf("nextNonce() = %d, %v, want the node's 0", nonce, err)
+	}
+	// The node knows what's recorded but doesn't count it as pending.
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx := signTestTx(t, chain.signer, key, testReceiverAddress, nonce, big.NewInt(1), big.NewInt(params.GWei))
+		if err := backend.SendTransaction(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+		chain.nonces.used(account, tx)
+	}
+	if nonce, err := chain.nextNonce(ctx, account); err != nil || nonce != 2 {
+		t.Fatalf("nextNonce() = %d, %v, want the tracked 2", nonce, err)
+	}
+}
+
+func TestNextNonceDropsGapLeftByDroppedTx(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, _ := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	// Sent, then evicted before the node reported it.
+	chain.nonces.used(account, signTestTx(t, chain.signer, key, testReceiverAddress, 0, big.NewInt(1), big.NewInt(params.GWei)))
+	if nonce, err := chain.nextNonce(ctx, account); err != nil || nonce != 0 {
+		t.Fatalf("nextNonce() = %d, %v, want the node's 0 rather than a gap", nonce, err)
+	}
+	if _, ok := chain.nonces.lookup(account); ok {
+		t.Fatal("tracked nonce kept after its tx was dropped")
+	}
+
+	// Restored nonces come without the txs behind them.
+	chain.nonces.restore(map[common.Address]uint64{account: 3})
+	if nonce, err := chain.nextNonce(ctx, account); err != nil || nonce != 0 {
+		t.Fatalf("nextNonce() = %d, %v, want the node's 0 after a stale restore", nonce, err)
+	}
+}
+
+func TestNextNonceForgetsMinedNonce(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	tx := signTestTx(t, chain.signer, key, testReceiverAddress, 0, big.NewInt(1), big.NewInt(params.GWei))
+	if err := sim.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	chain.nonces.used(account, tx)
+	sim.Commit()
+
+	if nonce, err := chain.nextNonce(ctx, account); err != nil || nonce != 1 {
+		t.Fatalf("nextNonce() = %d, %v, want 1", nonce, err)
+	}
+	if _, ok := chain.nonces.lookup(account); ok {
+		t.Fatal("tracked nonce kept after the node mined it")
+	}
+}
+
+func TestUnsentReplacementDoesNotTakeNonce(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"below min_sweep": {MinSweep: big.NewInt(params.Ether)},
+		"dry run":         {DryRun: true},
+		"over max price":  {MaxGasPrice: big.NewInt(params.GWei)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, account := newTestKey(t)
+			opts.BumpPercent = defaultBumpPercent
+			chain, backend := newRecordingChain(t, opts, key)
+
+			orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/4), big.NewInt(params.GWei))
+			chain.replacePending(context.Background(), orig, time.Now())
+			if sent := backend.sentTxs(); len(sent) != 0 {
+				t.Fatalf("sent %d txs, want none", len(sent))
+			}
+			if next, ok := chain.nonces.lookup(account); ok {
+				t.Fatalf("tracked next nonce %d without sending a replacement", next)
+			}
+		})
+	}
+}
+
+func TestReplacePendingOfRapidTxsFromOneAccount(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		orig := signTestTx(t, chain.signer, key, testAttacker, nonce, big.NewInt(params.Ether/4), big.NewInt(params.GWei))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chain.replacePending(ctx, orig, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	sent := backend.sentTxs()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d txs, want a replacement of each", len(sent))
+	}
+	sort.Slice(sent, func(i, j int) bool { return sent[i].Nonce() < sent[j].Nonce() })
+	for i, tx := range sent {
+		if tx.Nonce() != uint64(i) {
+			t.Fatalf("replacement nonces = %d, %d, want 0, 1", sent[0].Nonce(), sent[1].Nonce())
+		}
+	}
+	if nonce, err := chain.nextNonce(ctx, account); err != nil || nonce != 2 {
+		t.Fatalf("nextNonce() = %d, %v, want 2 after both replacements", nonce, err)
+	}
+}
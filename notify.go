@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	notifyTimeout    = 5 * time.Second
+	notifyAttempts   = 3
+	notifyRetryDelay = time.Second
+	// notifyQueueSize is how many events may wait for delivery to a chat
+	// before new ones are dropped.
+	notifyQueueSize = 256
+)
+
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+const (
+	EventSweep             = "sweep"
+	EventReplacementFailed = "replacement_failed"
+	EventSubscriptionLost  = "subscription_lost"
+)
+
+// Event is something an operator may want to be alerted about. Sweep is set
+// for EventSweep only.
+type Event struct {
+	Kind     string
+	Severity Severity
+	Chain    string
+	Message  string
+	Sweep    *SweepEvent
+}
+
+func (e Event) text() string {
+	return fmt.Sprintf("[%s] chain %s: %s", e.Severity, e.Chain, e.Message)
+}
+
+// Notifier delivers events somewhere. Notify must not block the caller.
+type Notifier interface {
+	Notify(event Event)
+}
+
+// Notifiers fans an event out to each of its notifiers.
+type Notifiers []Notifier
+
+func (n Notifiers) Notify(event Event) {
+	for _, notifier := range n {
+		notifier.Notify(event)
+	}
+}
+
+// notifyQueue delivers events one at a time in the background, retrying
+// each a few times before giving up with a warning.
+type notifyQueue struct {
+	name   string
+	post   func(Event) error
+	events chan Event
+}
+
+func newNotifyQueue(name string, post func(Event) error) *notifyQueue {
+	q := &notifyQueue{name: name, post: post, events: make(chan Event, notifyQueueSize)}
+	go q.run()
+	return q
+}
+
+// push queues event without blocking, it's dropped when the queue is full.
+func (q *notifyQueue) push(event Event) {
+	select {
+	case q.events <- event:
+	default:
+		slog.Warn(q.name+" queue full, dropping event", "event", event.Kind, "chain", event.Chain)
+	}
+}
+
+func (q *notifyQueue) run() {
+	for event := range q.events {
+		err := retryPost(notifyAttempts, notifyRetryDelay, func() error {
+			return q.post(event)
+		})
+		if err != nil {
+			slog.Warn("couldn't notify "+q.name, "event", event.Kind, "err", err)
+		}
+	}
+}
+
+// retryPost calls post up to attempts times, doubling delay between
+// attempts, and returns the last error.
+func retryPost(attempts int, delay time.Duration, post func() error) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = post(); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+func postJSON(client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Discord posts events to a Discord channel webhook.
+type Discord struct {
+	url    string
+	client *http.Client
+	queue  *notifyQueue
+}
+
+func NewDiscord(url string) *Discord {
+	d := &Discord{url: url, client: &http.Client{Timeout: notifyTimeout}}
+	d.queue = newNotifyQueue("discord", d.post)
+	return d
+}
+
+func (d *Discord) Notify(event Event) {
+	d.queue.push(event)
+}
+
+func (d *Discord) post(event Event) error {
+	return postJSON(d.client, d.url, map[string]string{"content": event.text()})
+}
+
+// Telegram sends events to a chat through a bot.
+type Telegram struct {
+	url    string
+	chatID string
+	client *http.Client
+	queue  *notifyQueue
+}
+
+func NewTelegram(botToken, chatID string) *Telegram {
+	t := &Telegram{
+		url:    "https://api.telegram.org/bot" + botToken + "/sendMessage",
+		chatID: chatID,
+		client: &http.Client{Timeout: notifyTimeout},
+	}
+	t.queue = newNotifyQueue("telegram", t.post)
+	return t
+}
+
+func (t *Telegram) Notify(event Event) {
+	t.queue.push(event)
+}
+
+func (t *Telegram) post(event Event) error {
+	return postJSON(t.client, t.url, map[string]string{"chat_id": t.chatID, "text": event.text()})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestDiscordPostsContent(t *testing.T) {
+	hook, url := newTestHook(t, 0)
+	discord := NewDiscord(url)
+
+	event := Event{Kind: EventReplacementFailed, Severity: SeverityError, Chain: "mainnet", Message: "couldn't replace"}
+	discord.Notify(event)
+
+	var got map[string]string
+	if err := json.Unmarshal(hook.next(t), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[error] chain mainnet: couldn't replace"; got["content"] != want {
+		t.Fatalf("content = %q, want %q", got["content"], want)
+	}
+}
+
+func TestTelegramSendsMessages(t *testing.T) {
+	hook, url := newTestHook(t, 0)
+	telegram := NewTelegram("token", "42")
+	if telegram.url != "https://api.telegram.org/bottoken/sendMessage" {
+		t.Fatalf("url = %s, want the bot's sendMessage", telegram.url)
+	}
+	telegram.url = url
+
+	telegram.Notify(Event{Kind: EventSubscriptionLost, Severity: SeverityWarning, Chain: "mainnet", Message: "dropped"})
+
+	var got map[string]string
+	if err := json.Unmarshal(hook.next(t), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["chat_id"] != "42" || got["text"] != "[warning] chain mainnet: dropped" {
+		t.Fatalf("message = %v, want the event text for chat 42", got)
+	}
+}
+
+func TestNotifyQueueDeliversInOrder(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		got  []string
+		done = make(chan struct{})
+	)
+	queue := newNotifyQueue("test", func(event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, event.Message)
+		if len(got) == 3 {
+			close(done)
+		}
+		return nil
+	})
+
+	for _, message := range []string{"a", "b", "c"} {
+		queue.push(Event{Message: message})
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("events weren't delivered")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("delivered %v, want a, b, c", got)
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	calls := 0
+	err := retryPost(3, time.Millisecond, func() error {
+		if calls++; calls < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("retryPost() = %v after %d calls, want success on the third", err, calls)
+	}
+
+	want := errors.New("down")
+	calls = 0
+	if err := retryPost(2, time.Millisecond, func() error { calls++; return want }); err != want || calls != 2 {
+		t.Fatalf("retryPost() = %v after %d calls, want %v after 2", err, calls, want)
+	}
+}
+
+// testNotifier records the events it's given.
+type testNotifier struct {
+	events []Event
+}
+
+func (n *testNotifier) Notify(event Event) {
+	n.events = append(n.events, event)
+}
+
+func TestNotifiersFanOut(t *testing.T) {
+	first, second := &testNotifier{}, &testNotifier{}
+	Notifiers{first, second}.Notify(Event{Kind: EventSweep})
+	if len(first.events) != 1 || len(second.events) != 1 {
+		t.Fatalf("notified %d and %d times, want once each", len(first.events), len(second.events))
+	}
+}
+
+func TestReplacementsNotify(t *testing.T) {
+	key, _ := newTestKey(t)
+	notifier := &testNotifier{}
+	replaceTestTransfer(t, Options{Notifiers: Notifiers{notifier}}, key, testAttacker, big.NewInt(params.Ether/2))
+
+	if len(notifier.events) != 1 {
+		t.Fatalf("notified %d events, want the sweep", len(notifier.events))
+	}
+	event := notifier.events[0]
+	if event.Kind != EventSweep || event.Severity != SeverityInfo || event.Sweep == nil || event.Sweep.Receiver != testReceiverAddress {
+		t.Fatalf("event = %+v, want an info sweep to the receiver", event)
+	}
+}
+
+func TestFailedReplacementsNotify(t *testing.T) {
+	key, _ := newTestKey(t)
+	notifier := &testNotifier{}
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, Notifiers: Notifiers{notifier}}, key)
+	backend.errs = []error{errors.New("insufficient funds")}
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+
+	if len(notifier.events) != 1 || notifier.events[0].Kind != EventReplacementFailed || notifier.events[0].Severity != SeverityError {
+		t.Fatalf("events = %+v, want a failed replacement error", notifier.events)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ObserveList holds the accounts that are only watched: their pending txs are
+// logged but never replaced, and their balances aren't swept, even once a
+// key for them is loaded. An account acts like any controlled one after
+// it's promoted off the list. A nil *ObserveList observes nothing.
+type ObserveList struct {
+	mu       sync.Mutex
+	accounts map[common.Address]bool
+}
+
+func NewObserveList(accounts []common.Address) *ObserveList {
+	return &ObserveList{accounts: addressSet(accounts)}
+}
+
+func (l *ObserveList) contains(account common.Address) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.accounts[account]
+}
+
+// promote takes account off the list and reports whether it was on it.
+func (l *ObserveList) promote(account common.Address) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.accounts[account] {
+		return false
+	}
+	delete(l.accounts, account)
+	return true
+}
+
+// Set replaces the observed accounts, e.g. on a reload that dropped some of
+// them from observe_accounts.
+func (l *ObserveList) Set(accounts []common.Address) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.accounts = addressSet(accounts)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// onceConfirmTimeout bounds how long -once waits for its sweeps to be
+	// mined.
+	onceConfirmTimeout = 5 * time.Minute
+	oncePollInterval   = 5 * time.Second
+)
+
+var errUnconfirmed = errors.New("sweeps not mined in time")
+
+// onceSummary is what a one-shot sweep of a chain did.
+type onceSummary struct {
+	sent      int
+	confirmed int
+	failed    int
+	value     *big.Int
+}
+
+// SweepAllOnce sweeps the current balances of every enabled chain once,
+// waits for the sweeps to be mined and logs a summary per chain. It fails
+// with ErrAllChainsFailed or ErrSomeChainsFailed unless every chain was
+// swept without errors.
+func SweepAllOnce(ctx context.Context, config Config, accounts *AccountStore, opts Options) error {
+	var (
+		wg            sync.WaitGroup
+		mu            sync.Mutex
+		total, failed int
+		slots         = newChainSlots(config.MaxConcurrentChains)
+	)
+	for _, chainConfig := range config.ChainConfigs() {
+		if !chainConfig.enabled() {
+			continue
+		}
+
+		name := chainConfig.Name
+		runner := newRunner(config, chainConfig, accounts, opts)
+		total++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !slots.acquire(ctx, name) {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+				return
+			}
+			defer slots.release()
+
+			summary, err := runner.SweepOnce(ctx)
+			runner.log.Info("one-shot sweep done", "sent", summary.sent, "confirmed", summary.confirmed, "failed", summary.failed, "value", summary.value)
+			if err != nil {
+				runner.log.Error("one-shot sweep failed", "err", err)
+			}
+			if err != nil || summary.failed > 0 {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	switch {
+	case failed == 0:
+		return nil
+	case failed == total:
+		return ErrAllChainsFailed
+	default:
+		return fmt.Errorf("%w: %d of %d", ErrSomeChainsFailed, failed, total)
+	}
+}
+
+// SweepOnce connects to the first reachable endpoint, sweeps the native and
+// configured token balances of every account and waits for the sweeps to be
+// mined.
+func (r *ChainRunner) SweepOnce(ctx context.Context) (onceSummary, error) {
+	summary := onceSummary{value: new(big.Int)}
+
+	var (
+		chain *Chain
+		err   error
+	)
+	for _, endpoint := range r.config.Endpoints {
+		chain, err = Connect(ctx, endpoint.URL, r.receiver, r.accounts, r.opts)
+		if err == nil {
+			break
+		}
+		r.log.Error("couldn't connect", "endpoint", endpoint.URL, "err", err)
+	}
+	if chain == nil {
+		return summary, fmt.Errorf("no endpoint reachable: %w", err)
+	}
+
+	var sent []*types.Transaction
+	for _, account := range chain.addresses() {
+		txs, err := chain.sweepNative(ctx, account)
+		if err != nil {
+			r.log.Warn("couldn't sweep balance", "from", account, "err", err)
+			summary.failed++
+		}
+		for _, tx := range txs {
+			summary.value.Add(summary.value, tx.Value())
+		}
+		sent = append(sent, txs...)
+
+		for _, token := range r.opts.SweepTokens {
+			if r.opts.BlacklistTokens[token] {
+				continue
+			}
+			tx, err := chain.sweepToken(ctx, account, token)
+			if err != nil {
+				r.log.Warn("couldn't sweep token", "token", token, "from", account, "err", err)
+				summary.failed++
+			}
+			if tx != nil {
+				sent = append(sent, tx)
+			}
+		}
+	}
+	summary.sent = len(sent)
+
+	confirmed, failed, err := chain.waitMined(ctx, sent)
+	summary.confirmed = confirmed
+	summary.failed += failed
+	return summary, err
+}
+
+// waitMined polls the receipts of txs until all of them are mined or
+// onceConfirmTimeout passes, and returns how many succeeded and reverted.
+func (c *Chain) waitMined(ctx context.Context, txs []*types.Transaction) (succeeded, reverted int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, onceConfirmTimeout)
+	defer cancel()
+
+	pending := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		pending[tx.Hash()] = true
+	}
+	for len(pending) > 0 {
+		for hash := range pending {
+			receiptCtx, cancelReceipt := context.WithTimeout(ctx, c.opts.rpcTimeout())
+			receipt, err := c.eth.TransactionReceipt(receiptCtx, hash)
+			cancelReceipt()
+			if errors.Is(err, ethereum.NotFound) {
+				continue
+			}
+			if err != nil {
+				c.log.Debug("couldn't get receipt", "replacement_tx", hash, "err", err)
+				continue
+			}
+
+			delete(pending, hash)
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				succeeded++
+			} else {
+				c.log.Warn("sweep reverted", "replacement_tx", hash)
+				reverted++
+			}
+		}
+		if len(pending) > 0 && !sleepContext(ctx, oncePollInterval) {
+			return succeeded, reverted, fmt.Errorf("%d %w", len(pending), errUnconfirmed)
+		}
+	}
+	return succeeded, reverted, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// sweepNode is a testNode holding balance for every account that mines the
+// txs sent to it right away with status.
+type sweepNode struct {
+	*testNode
+	balance *big.Int
+	status  uint64
+
+	mu   sync.Mutex
+	sent map[common.Hash]*types.Transaction
+}
+
+func newSweepNode(status uint64) *sweepNode {
+	return &sweepNode{
+		testNode: &testNode{chainID: 1337, baseFee: big.NewInt(params.GWei)},
+		balance:  big.NewInt(params.Ether),
+		status:   status,
+		sent:     make(map[common.Hash]*types.Transaction),
+	}
+}
+
+func (n *sweepNode) GetBalance(address common.Address, block rpc.BlockNumberOrHash) *hexutil.Big {
+	return (*hexutil.Big)(n.balance)
+}
+
+func (n *sweepNode) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(params.GWei))
+}
+
+func (n *sweepNode) GetTransactionCount(address common.Address, block rpc.BlockNumberOrHash) hexutil.Uint64 {
+	return 0
+}
+
+func (n *sweepNode) SendRawTransaction(input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent[tx.Hash()] = tx
+	return tx.Hash(), nil
+}
+
+func (n *sweepNode) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	tx, ok := n.sent[hash]
+	if !ok {
+		return nil
+	}
+	return &types.Receipt{Status: n.status, TxHash: hash, GasUsed: tx.Gas(), Logs: []*types.Log{}, BlockNumber: big.NewInt(2)}
+}
+
+func TestSweepOnce(t *testing.T) {
+	node := newSweepNode(types.ReceiptStatusSuccessful)
+	key, address := newTestKey(t)
+	config := ChainConfig{Name: "test", Endpoints: []Endpoint{{URL: newTestNode(t, node)}}}
+	runner := NewChainRunner(config, testReceiverAddress, NewAccountStore(Accounts{address: key}), Options{})
+
+	summary, err := runner.SweepOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee := big.NewInt(transferGas * params.GWei)
+	want := new(big.Int).Sub(node.balance, fee)
+	if summary.sent != 1 || summary.confirmed != 1 || summary.failed != 0 || summary.value.Cmp(want) != 0 {
+		t.Fatalf("SweepOnce() = %+v, want one confirmed sweep of %s", summary, want)
+	}
+}
+
+func TestSweepAllOnce(t *testing.T) {
+	key, address := newTestKey(t)
+	accounts := NewAccountStore(Accounts{address: key})
+
+	tests := []struct {
+		name   string
+		status uint64
+		want   error
+	}{
+		{"mined", types.ReceiptStatusSuccessful, nil},
+		{"reverted", types.ReceiptStatusFailed, ErrAllChainsFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{Receiver: testReceiverAddress, Endpoints: []Endpoint{{URL: newTestNode(t, newSweepNode(test.status))}}}
+			if err := SweepAllOnce(context.Background(), config, accounts, Options{}); !errors.Is(err, test.want) {
+				t.Fatalf("SweepAllOnce() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+// wsBufferSize matches the buffers of rpc's own websocket dialer.
+const wsBufferSize = 1024
+
+// dialRPC dials endpoint, routing HTTP and websocket connections through
+// proxy when it's set. IPC endpoints are always dialed directly.
+func dialRPC(ctx context.Context, endpoint string, proxy *url.URL) (*rpc.Client, error) {
+	if proxy == nil {
+		return rpc.DialContext(ctx, dialTarget(endpoint))
+	}
+
+	proxyFunc := http.ProxyURL(proxy)
+	return rpc.DialOptions(ctx, dialTarget(endpoint),
+		rpc.WithHTTPClient(&http.Client{Transport: &http.Transport{Proxy: proxyFunc}}),
+		rpc.WithWebsocketDialer(websocket.Dialer{
+			Proxy:           proxyFunc,
+			ReadBufferSize:  wsBufferSize,
+			WriteBufferSize: wsBufferSize,
+		}),
+	)
+}
+
+// parseProxy parses a proxy URL, which must be http or socks5. Those are the
+// only schemes the websocket dialer can tunnel through, https and socks5h
+// would only work for HTTP endpoints.
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "socks5":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
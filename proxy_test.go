@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testProxy is an HTTP proxy that serves plain requests with node itself
+// and tunnels CONNECT requests to their target, counting both.
+type testProxy struct {
+	node     http.Handler
+	requests atomic.Int64
+	tunnels  atomic.Int64
+}
+
+func (p *testProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		p.requests.Add(1)
+		p.node.ServeHTTP(w, r)
+		return
+	}
+
+	p.tunnels.Add(1)
+	target, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+// newTestProxy serves a proxy whose plain requests reach server, and returns
+// it with its URL.
+func newTestProxy(t *testing.T, server *rpc.Server) (*testProxy, *url.URL) {
+	t.Helper()
+
+	proxy := &testProxy{node: server}
+	httpServer := httptest.NewServer(proxy)
+	t.Cleanup(httpServer.Close)
+	proxyURL, err := url.Parse(httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy, proxyURL
+}
+
+// newTestRPCServer serves the eth_ methods of a testNode.
+func newTestRPCServer(t *testing.T) *rpc.Server {
+	t.Helper()
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &testNode{chainID: 1337}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	return server
+}
+
+// checkChainID fails the test unless client reaches a testNode.
+func checkChainID(t *testing.T, client *rpc.Client) {
+	t.Helper()
+
+	var chainID string
+	if err := client.CallContext(context.Background(), &chainID, "eth_chainId"); err != nil || chainID != "0x539" {
+		t.Fatalf("eth_chainId = %q, %v, want 0x539", chainID, err)
+	}
+}
+
+func TestDialRPCThroughProxyOverHTTP(t *testing.T) {
+	proxy, proxyURL := newTestProxy(t, newTestRPCServer(t))
+
+	// Only the proxy knows the way to the node.
+	client, err := dialRPC(context.Background(), "http://node.invalid:8545", proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	checkChainID(t, client)
+	if proxy.requests.Load() == 0 {
+		t.Fatal("request didn't go through the proxy")
+	}
+}
+
+func TestDialRPCThroughProxyOverWebsocket(t *testing.T) {
+	server := newTestRPCServer(t)
+	wsServer := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	t.Cleanup(wsServer.Close)
+	proxy, proxyURL := newTestProxy(t, server)
+
+	client, err := dialRPC(context.Background(), "ws://"+strings.TrimPrefix(wsServer.URL, "http://"), proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	checkChainID(t, client)
+	if proxy.tunnels.Load() != 1 {
+		t.Fatalf("proxy tunnelled %d connections, want the websocket's", proxy.tunnels.Load())
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		proxy   string
+		wantErr bool
+	}{
+		{"http://proxy:3128", false},
+		{"socks5://proxy:1080", false},
+		{"https://proxy:3128", true},
+		{"socks5h://proxy:1080", true},
+		{"proxy:3128", true},
+	}
+	for _, test := range tests {
+		if _, err := parseProxy(test.proxy); (err != nil) != test.wantErr {
+			t.Errorf("parseProxy(%q) error = %v, want error %v", test.proxy, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// maxUnderpricedRetries is how many times a replacement rejected as
+// underpriced is bumped again right away.
+const maxUnderpricedRetries = 3
+
+type inflightKey struct {
+	from  common.Address
+	nonce uint64
+}
+
+type inflightTx struct {
+	tx *types.Transaction
+	// sentAt is the first block seen after broadcasting tx.
+	sentAt uint64
+}
+
+// inflightTracker remembers broadcast replacements until they're mined so
+// stuck ones can be bumped again.
+type inflightTracker struct {
+	mu  sync.Mutex
+	txs map[inflightKey]*inflightTx
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{txs: make(map[inflightKey]*inflightTx)}
+}
+
+func (t *inflightTracker) track(from common.Address, tx *types.Transaction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.txs[inflightKey{from: from, nonce: tx.Nonce()}] = &inflightTx{tx: tx}
+}
+
+func (t *inflightTracker) snapshot() map[inflightKey]inflightTx {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	txs := make(map[inflightKey]inflightTx, len(t.txs))
+	for key, tx := range t.txs {
+		txs[key] = *tx
+	}
+	return txs
+}
+
+func (t *inflightTracker) markSent(key inflightKey, block uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tx, ok := t.txs[key]; ok && tx.sentAt == 0 {
+		tx.sentAt = block
+	}
+}
+
+func (t *inflightTracker) forget(key inflightKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.txs, key)
+}
+
+// ChaseReplacements watches new heads and re-broadcasts replacements that
+// haven't been mined within RebumpBlocks with a further bumped fee.
+func (c *Chain) ChaseReplacements(ctx context.Context) error {
+	heads, unsubscribe := c.heads.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case header := <-heads:
+			c.rebumpStuck(ctx, header.Number.Uint64())
+		}
+	}
+}
+
+func (c *Chain) rebumpStuck(ctx context.Context, block uint64) {
+	for key, inflight := range c.inflight.snapshot() {
+		nonce, err := c.nonceAt(ctx, key.from)
+		if err != nil {
+			c.log.Warn("couldn't get nonce", "from", key.from, "err", err)
+			continue
+		}
+		if nonce > key.nonce {
+			c.inflight.forget(key)
+			continue
+		}
+
+		if inflight.sentAt == 0 {
+			c.inflight.markSent(key, block)
+			continue
+		}
+		if block-inflight.sentAt < c.opts.RebumpBlocks {
+			continue
+		}
+
+		c.rebump(ctx, key, inflight.tx)
+	}
+}
+
+func (c *Chain) rebump(ctx context.Context, key inflightKey, tx *types.Transaction) {
+	signingKey, ok := c.accountFor(key.from)
+	if !ok {
+		c.inflight.forget(key)
+		return
+	}
+
+	bumpedTx, err := c.bumpAgain(ctx, key.from, *c.receiverFor(key.from), tx)
+	if err != nil {
+		c.log.Warn("giving up on stuck replacement", "from", key.from, "replacement_tx", tx.Hash(), "reason", err)
+		c.inflight.forget(key)
+		return
+	}
+
+	signedTx, err := signingKey.sign(bumpedTx, c.signer)
+	if err != nil {
+		c.log.Error("couldn't sign re-bumped tx", "from", key.from, "replacement_tx", tx.Hash(), "err", err)
+		return
+	}
+
+	signedTx, err = c.sendReplacement(ctx, signingKey, key.from, *c.receiverFor(key.from), signedTx)
+	if err != nil {
+		c.log.Error("couldn't send re-bumped tx", "from", key.from, "replacement_tx", tx.Hash(), "err", err)
+		return
+	}
+	c.nonces.used(key.from, signedTx)
+	c.inflight.track(key.from, signedTx)
+	c.confirmations.watch(key.from, signedTx)
+	c.replaced.Add(key, signedTx)
+
+	c.log.Info("re-bumped stuck replacement", "from", key.from, "orig_tx", tx.Hash(), "replacement_tx", signedTx.Hash(), "value", signedTx.Value(), "gas_price", signedTx.GasPrice())
+}
+
+// bumpAgain returns the unsigned successor of tx, one of our own
+// replacements or cancels of from, with its fees bumped once more.
+func (c *Chain) bumpAgain(ctx context.Context, from, receiver common.Address, tx *types.Transaction) (*types.Transaction, error) {
+	if isCancel(from, tx) {
+		return buildCancel(tx, from, !c.london, c.fees(), c.baseFeeFor(ctx, tx))
+	}
+	return buildReplacement(tx, receiver, c.opts.ReceiverData, c.opts.Rescues, !c.london, tx.Gas(), c.fees(), c.baseFeeFor(ctx, tx))
+}
+
+// isUnderpriced reports whether err is a node refusing a replacement for not
+// outbidding the tx it already holds for that nonce.
+func isUnderpriced(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "replacement transaction underpriced")
+}
+
+// sendReplacement broadcasts signedTx, bumping it by BumpPercent again while
+// nodes reject it as underpriced, up to maxUnderpricedRetries times or until
+// MaxGasPrice stops it. It returns the replacement that was sent last.
+func (c *Chain) sendReplacement(ctx context.Context, key accountKey, from, receiver common.Address, signedTx *types.Transaction) (*types.Transaction, error) {
+	err := c.broadcastReplacement(ctx, signedTx)
+	for retry := 0; retry < maxUnderpricedRetries && isUnderpriced(err); retry++ {
+		bumpedTx, bumpErr := c.bumpAgain(ctx, from, receiver, signedTx)
+		if bumpErr != nil {
+			return signedTx, fmt.Errorf("%w, can't bump further: %v", err, bumpErr)
+		}
+
+		bumpedTx, signErr := key.sign(bumpedTx, c.signer)
+		if signErr != nil {
+			return signedTx, fmt.Errorf("couldn't sign bumped replacement: %w", signErr)
+		}
+
+		c.log.Info("replacement underpriced, bumping again", "from", from, "replacement_tx", signedTx.Hash(), "gas_price", bumpedTx.GasPrice())
+		signedTx = bumpedTx
+		err = c.broadcastReplacement(ctx, signedTx)
+	}
+	return signedTx, err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestRebumpStuckReplacements(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, RebumpBlocks: 3}, key)
+	ctx := context.Background()
+
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	if sent := backend.sentTxs(); len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the replacement", len(sent))
+	}
+
+	// The first head after sending starts the count, it's not stuck before
+	// RebumpBlocks more.
+	chain.rebumpStuck(ctx, 10)
+	chain.rebumpStuck(ctx, 12)
+	if sent := backend.sentTxs(); len(sent) != 1 {
+		t.Fatalf("sent %d txs before the replacement got stuck, want 1", len(sent))
+	}
+
+	chain.rebumpStuck(ctx, 13)
+	sent := backend.sentTxs()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d txs, want the re-bumped replacement too", len(sent))
+	}
+	replacementTx, rebumpedTx := sent[0], sent[1]
+	if rebumpedTx.Nonce() != replacementTx.Nonce() || *rebumpedTx.To() != testReceiverAddress {
+		t.Fatalf("re-bumped tx = nonce %d to %s, want nonce %d to the receiver", rebumpedTx.Nonce(), rebumpedTx.To(), replacementTx.Nonce())
+	}
+	if want, _ := bumpPrice(replacementTx.GasPrice(), defaultBumpPercent, nil); rebumpedTx.GasPrice().Cmp(want) != 0 {
+		t.Fatalf("re-bumped gas price = %s, want %s", rebumpedTx.GasPrice(), want)
+	}
+	if got, _ := chain.replaced.Get(inflightKey{from: account, nonce: 0}); got.Hash() != rebumpedTx.Hash() {
+		t.Fatal("re-bumped tx isn't recorded as the replacement")
+	}
+}
+
+func TestRebumpStuckForgetsMinedReplacements(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{BumpPercent: defaultBumpPercent, RebumpBlocks: 1}, key)
+	ctx := context.Background()
+
+	chain.replacePending(ctx, signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	sim.Commit()
+
+	chain.rebumpStuck(ctx, 1)
+	if _, ok := chain.inflight.snapshot()[inflightKey{from: account, nonce: 0}]; ok {
+		t.Fatal("mined replacement is still tracked")
+	}
+}
+
+func TestReplacementsUntrackedWithoutRebump(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	if sent := backend.sentTxs(); len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the replacement", len(sent))
+	}
+	if tracked := chain.inflight.snapshot(); len(tracked) != 0 {
+		t.Fatalf("tracking %d replacements with rebump_blocks unset, nothing would forget them", len(tracked))
+	}
+}
+
+func TestIsUnderpriced(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("replacement transaction underpriced"), true},
+		{errors.New("Replacement Transaction Underpriced"), true},
+		{fmt.Errorf("couldn't send: %w", errors.New("replacement transaction underpriced")), true},
+		{errors.New("transaction underpriced"), false},
+		{errors.New("nonce too low"), false},
+	}
+	for _, test := range tests {
+		if got := isUnderpriced(test.err); got != test.want {
+			t.Errorf("isUnderpriced(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestReplacePendingBumpsUnderpricedReplacements(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	backend.errs = []error{errors.New("replacement transaction underpriced")}
+
+	orig := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei))
+	chain.replacePending(context.Background(), orig, time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the bumped retry", len(sent))
+	}
+	first, _ := bumpPrice(orig.GasPrice(), defaultBumpPercent, nil)
+	want, _ := bumpPrice(first, defaultBumpPercent, nil)
+	if sent[0].GasPrice().Cmp(want) != 0 {
+		t.Fatalf("retry gas price = %s, want %s bumped twice", sent[0].GasPrice(), want)
+	}
+	if got, _ := chain.replaced.Get(inflightKey{from: account, nonce: 0}); got.Hash() != sent[0].Hash() {
+		t.Fatal("retry isn't recorded as the replacement")
+	}
+}
+
+func TestReplacePendingStopsBumpingAtMaxGasPrice(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, MaxGasPrice: big.NewInt(13 * params.GWei / 10)}, key)
+	underpriced := errors.New("replacement transaction underpriced")
+	backend.errs = []error{underpriced, underpriced, underpriced, underpriced}
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs, want none", len(sent))
+	}
+	// 1.11 and 1.2321 gwei were sent, a third bump would exceed the cap.
+	if len(backend.errs) != 2 {
+		t.Fatalf("%d sends left unattempted, want 2", len(backend.errs))
+	}
+}
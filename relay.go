@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PrivateSender submits transactions without exposing them to the public
+// mempool.
+type PrivateSender interface {
+	SendPrivateTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// PrivateRelay talks to a Flashbots-style relay exposing
+// eth_sendPrivateTransaction.
+type PrivateRelay struct {
+	client *rpc.Client
+}
+
+func DialPrivateRelay(ctx context.Context, endpoint string, proxy *url.URL) (*PrivateRelay, error) {
+	client, err := dialRPC(ctx, endpoint, proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateRelay{client: client}, nil
+}
+
+func (r *PrivateRelay) SendPrivateTransaction(ctx context.Context, tx *types.Transaction) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	params := map[string]interface{}{"tx": hexutil.Encode(raw)}
+	return r.client.CallContext(ctx, nil, "eth_sendPrivateTransaction", params)
+}
+
+// broadcastReplacement sends a race-critical replacement through the private
+// relay when one is configured, falling back to the public mempool if the
+// relay rejects it.
+func (c *Chain) broadcastReplacement(ctx context.Context, tx *types.Transaction) error {
+	if c.opts.Relay == nil {
+		return c.sendPublic(ctx, tx)
+	}
+
+	relayCtx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+	err := c.opts.Relay.SendPrivateTransaction(relayCtx, tx)
+	cancel()
+	if err == nil {
+		return nil
+	}
+
+	c.log.Warn("private relay rejected replacement, sending publicly", "replacement_tx", tx.Hash(), "err", err)
+	return c.sendPublic(ctx, tx)
+}
+
+// isAlreadyKnown reports whether err is a node refusing tx because it has
+// it already, e.g. after another endpoint propagated it.
+func isAlreadyKnown(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// sendPublic sends tx to the connected endpoint and at the same time to the
+// chain's other endpoints when there are peers. It succeeds when any of them
+// accepted tx, the connected endpoint's error is returned otherwise.
+func (c *Chain) sendPublic(ctx context.Context, tx *types.Transaction) error {
+	if len(c.peers) == 0 {
+		return c.sendTransaction(ctx, tx)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted bool
+	)
+	for _, peer := range c.peers {
+		wg.Add(1)
+		go func(peer TxSender) {
+			defer wg.Done()
+			peerCtx, cancel := context.WithTimeout(ctx, c.opts.rpcTimeout())
+			err := peer.SendTransaction(peerCtx, tx)
+			cancel()
+			if err != nil && !isAlreadyKnown(err) {
+				c.log.Debug("peer endpoint rejected tx", "replacement_tx", tx.Hash(), "err", err)
+				return
+			}
+			mu.Lock()
+			accepted = true
+			mu.Unlock()
+		}(peer)
+	}
+
+	err := c.sendTransaction(ctx, tx)
+	wg.Wait()
+	if err != nil && accepted {
+		c.log.Warn("endpoint rejected tx, a peer endpoint accepted it", "replacement_tx", tx.Hash(), "err", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testRelay records the txs submitted to it, or rejects them with err.
+type testRelay struct {
+	err  error
+	mu   sync.Mutex
+	sent []*types.Transaction
+}
+
+func (r *testRelay) SendPrivateTransaction(ctx context.Context, tx *types.Transaction) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, tx)
+	return nil
+}
+
+func (r *testRelay) sentTxs() []*types.Transaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*types.Transaction(nil), r.sent...)
+}
+
+func TestReplacePendingSendsThroughRelay(t *testing.T) {
+	key, _ := newTestKey(t)
+	relay := &testRelay{}
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, Relay: relay}, key)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+
+	if sent := relay.sentTxs(); len(sent) != 1 || *sent[0].To() != testReceiverAddress {
+		t.Fatalf("relay got %d txs, want the replacement", len(sent))
+	}
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs publicly, want none", len(sent))
+	}
+}
+
+func TestReplacePendingFallsBackWhenRelayRejects(t *testing.T) {
+	key, _ := newTestKey(t)
+	relay := &testRelay{err: errors.New("bundle rejected")}
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, Relay: relay}, key)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+
+	if sent := backend.sentTxs(); len(sent) != 1 || *sent[0].To() != testReceiverAddress {
+		t.Fatalf("sent %d txs publicly, want the replacement", len(sent))
+	}
+}
+
+// relayService records the raw txs sent with eth_sendPrivateTransaction.
+type relayService struct {
+	raw chan string
+}
+
+func (s *relayService) SendPrivateTransaction(params map[string]string) error {
+	s.raw <- params["tx"]
+	return nil
+}
+
+func TestPrivateRelaySendsRawTx(t *testing.T) {
+	service := &relayService{raw: make(chan string, 1)}
+	ctx := context.Background()
+	relay, err := DialPrivateRelay(ctx, newTestNode(t, service), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := newTestKey(t)
+	tx := signTestTx(t, types.LatestSignerForChainID(big.NewInt(1)), key, testReceiverAddress, 0, big.NewInt(1), big.NewInt(params.GWei))
+	if err := relay.SendPrivateTransaction(ctx, tx); err != nil {
+		t.Fatalf("SendPrivateTransaction: %v", err)
+	}
+
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-service.raw; got != hexutil.Encode(raw) {
+		t.Fatalf("relay got %s, want %s", got, hexutil.Encode(raw))
+	}
+}
+
+func TestReplacePendingBroadcastsToPeers(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+	peer := &recordingBackend{}
+	knownPeer := &recordingBackend{errs: []error{errors.New("already known")}}
+	chain.peers = []TxSender{peer, knownPeer}
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs to the connected endpoint, want the replacement", len(sent))
+	}
+	if got := peer.sentTxs(); len(got) != 1 || got[0].Hash() != sent[0].Hash() {
+		t.Fatalf("peer got %d txs, want the replacement", len(got))
+	}
+	if len(knownPeer.errs) != 0 {
+		t.Fatal("replacement wasn't sent to every peer")
+	}
+}
+
+func TestSendPublicSucceedsWhenAPeerAccepts(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{}, key)
+	tx := signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(1), big.NewInt(params.GWei))
+	rejected := errors.New("txpool is full")
+
+	backend.errs = []error{rejected}
+	chain.peers = []TxSender{&recordingBackend{errs: []error{errors.New("already known")}}}
+	if err := chain.sendPublic(context.Background(), tx); err != nil {
+		t.Fatalf("sendPublic() = %v, want the peer's acceptance", err)
+	}
+
+	backend.errs = []error{rejected}
+	chain.peers = []TxSender{&recordingBackend{errs: []error{errors.New("nonce too low")}}}
+	if err := chain.sendPublic(context.Background(), tx); !errors.Is(err, rejected) {
+		t.Fatalf("sendPublic() = %v, want %v", err, rejected)
+	}
+}
+
+func TestDialPeers(t *testing.T) {
+	url := newTestNode(t, &testNode{chainID: 1337})
+	config := ChainConfig{Name: "test", Endpoints: []Endpoint{{URL: url}, {URL: "unknown://endpoint"}}}
+	runner := NewChainRunner(config, testReceiverAddress, NewAccountStore(nil), Options{BroadcastAll: true})
+
+	peers := runner.dialPeers(context.Background())
+	defer func() {
+		for _, peer := range peers {
+			peer.Close()
+		}
+	}()
+	if _, ok := peers[url]; len(peers) != 1 || !ok {
+		t.Fatalf("dialed %d peers, want only %s", len(peers), url)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	errCantOutbid      = errors.New("max gas price can't outbid original")
+	errFeesExceedValue = errors.New("value doesn't cover replacement fees")
+	errBelowReserve    = errors.New("balance doesn't cover fees and gas reserve")
+)
+
+// bumpDelta returns percent% of price, multiplying before dividing so small
+// prices don't truncate to zero.
+func bumpDelta(price *big.Int, percent uint64) *big.Int {
+	delta := new(big.Int).Mul(price, new(big.Int).SetUint64(percent))
+	return delta.Div(delta, big.NewInt(100))
+}
+
+// bumpPrice raises price by percent, clamped to maxPrice when set. It reports
+// false when the clamped price is too low for nodes to accept it as a
+// replacement.
+func bumpPrice(price *big.Int, percent uint64, maxPrice *big.Int) (*big.Int, bool) {
+	bumped := new(big.Int).Add(price, bumpDelta(price, percent))
+	if maxPrice == nil || bumped.Cmp(maxPrice) <= 0 {
+		return bumped, true
+	}
+
+	minimum := new(big.Int).Add(price, bumpDelta(price, minBumpPercent))
+	return new(big.Int).Set(maxPrice), maxPrice.Cmp(minimum) >= 0
+}
+
+// replacementCall returns what a replacement for orig calls: receiver
+// directly with receiverData, or for a token call one of rescues recognizes
+// the token with that method's rescue.
+func replacementCall(orig *types.Transaction, receiver common.Address, receiverData []byte, rescues rescueSet) (to common.Address, data []byte, isTokenCall bool) {
+	if method, _, ok := rescues.match(orig.Data()); ok {
+		return *orig.To(), method.rescue(orig.Data()[4:], receiver), true
+	}
+	return receiver, receiverData, false
+}
+
+// feePolicy is how a replacement's fees are derived from the original's:
+// bumped by bumpPercent, raised to the floors and capped at maxGasPrice. Nil
+// limits don't apply.
+type feePolicy struct {
+	bumpPercent uint64
+	maxGasPrice *big.Int
+	// minGasPrice is the floor of gas prices and fee caps, minFeeCap one of
+	// fee caps only and minTip the one of dynamic fee tips.
+	minGasPrice *big.Int
+	minFeeCap   *big.Int
+	minTip      *big.Int
+}
+
+// atLeast returns price raised to floor, unless that exceeds maxPrice.
+func atLeast(price, floor, maxPrice *big.Int) *big.Int {
+	if floor == nil || price.Cmp(floor) >= 0 {
+		return price
+	}
+	if maxPrice != nil && floor.Cmp(maxPrice) > 0 {
+		return new(big.Int).Set(maxPrice)
+	}
+	return new(big.Int).Set(floor)
+}
+
+// buildReplacement returns the unsigned replacement for orig: the same nonce,
+// gas as given, its fees bumped as fees says. A plain replacement sends what
+// orig could spend minus its own fees to receiver, calling it with
+// receiverData. A token call in rescues is replaced by its rescue instead,
+// e.g. an ERC-20 transfer by a transfer of the same amount to receiver, its
+// fees are paid from the account's native balance. When baseFee is known a
+// dynamic fee replacement's fee cap leaves room for it to double. With
+// legacyOnly the replacement is a legacy tx whatever orig's type, its gas
+// price bumped from orig's fee cap. It fails with errCantOutbid or
+// errFeesExceedValue when no worthwhile replacement exists.
+func buildReplacement(orig *types.Transaction, receiver common.Address, receiverData []byte, rescues rescueSet, legacyOnly bool, gas uint64, fees feePolicy, baseFee *big.Int) (*types.Transaction, error) {
+	to, data, isTokenCall := replacementCall(orig, receiver, receiverData, rescues)
+	return bumpedTx(orig, to, data, !isTokenCall, legacyOnly, gas, fees, baseFee)
+}
+
+// buildCancel returns the unsigned cancel of orig: a zero-value self-send
+// from from at orig's nonce, its fees bumped as fees says and paid from the
+// account's balance. It fails like buildReplacement.
+func buildCancel(orig *types.Transaction, from common.Address, legacyOnly bool, fees feePolicy, baseFee *big.Int) (*types.Transaction, error) {
+	tx, err := bumpedTx(orig, from, nil, false, legacyOnly, params.TxGas, fees, baseFee)
+	if err != nil {
+		return nil, err
+	}
+	return withValue(tx, new(big.Int)), nil
+}
+
+// isCancel reports whether tx is a cancel built by buildCancel.
+func isCancel(from common.Address, tx *types.Transaction) bool {
+	return tx.To() != nil && *tx.To() == from && tx.Value().Sign() == 0 && len(tx.Data()) == 0
+}
+
+func bumpedTx(orig *types.Transaction, to common.Address, data []byte, feesFromValue, legacyOnly bool, gas uint64, fees feePolicy, baseFee *big.Int) (*types.Transaction, error) {
+	txType := orig.Type()
+	if legacyOnly {
+		txType = types.LegacyTxType
+	}
+
+	switch txType {
+	case types.DynamicFeeTxType:
+		feeCap, ok := bumpPrice(orig.GasFeeCap(), fees.bumpPercent, fees.maxGasPrice)
+		if !ok {
+			return nil, errCantOutbid
+		}
+		tipCap, _ := bumpPrice(orig.GasTipCap(), fees.bumpPercent, fees.maxGasPrice)
+		tipCap = atLeast(tipCap, fees.minTip, fees.maxGasPrice)
+		feeCap = atLeast(feeCap, fees.minGasPrice, fees.maxGasPrice)
+		feeCap = atLeast(feeCap, fees.minFeeCap, fees.maxGasPrice)
+		// A raised tip would be cut off by a lower fee cap.
+		feeCap = atLeast(feeCap, tipCap, fees.maxGasPrice)
+		if baseFee != nil {
+			feeCap = withHeadroom(feeCap, tipCap, baseFee, fees.maxGasPrice)
+		}
+		if tipCap.Cmp(feeCap) > 0 {
+			tipCap = feeCap
+		}
+
+		value, err := replacementValue(orig, feeCap, gas, feesFromValue)
+		if err != nil {
+			return nil, err
+		}
+
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    orig.ChainId(),
+			To:         &to,
+			Value:      value,
+			Gas:        gas,
+			GasTipCap:  tipCap,
+			GasFeeCap:  feeCap,
+			Nonce:      orig.Nonce(),
+			Data:       data,
+			AccessList: orig.AccessList(),
+		}), nil
+	default:
+		gasPrice, ok := bumpPrice(orig.GasPrice(), fees.bumpPercent, fees.maxGasPrice)
+		if !ok {
+			return nil, errCantOutbid
+		}
+		gasPrice = atLeast(gasPrice, fees.minGasPrice, fees.maxGasPrice)
+
+		value, err := replacementValue(orig, gasPrice, gas, feesFromValue)
+		if err != nil {
+			return nil, err
+		}
+
+		// Access lists are kept, the original may rely on them being warm.
+		if txType == types.AccessListTxType {
+			return types.NewTx(&types.AccessListTx{
+				ChainID:    orig.ChainId(),
+				To:         &to,
+				Value:      value,
+				Gas:        gas,
+				GasPrice:   gasPrice,
+				Nonce:      orig.Nonce(),
+				Data:       data,
+				AccessList: orig.AccessList(),
+			}), nil
+		}
+		return types.NewTx(&types.LegacyTx{
+			To:       &to,
+			Value:    value,
+			Gas:      gas,
+			GasPrice: gasPrice,
+			Nonce:    orig.Nonce(),
+			Data:     data,
+		}), nil
+	}
+}
+
+// outbids reports whether tx pays more than replacement in fee cap or tip,
+// so replacement no longer wins that nonce. replacement doesn't outbid
+// itself.
+func outbids(tx, replacement *types.Transaction) bool {
+	return tx.GasFeeCap().Cmp(replacement.GasFeeCap()) > 0 || tx.GasTipCap().Cmp(replacement.GasTipCap()) > 0
+}
+
+// withHeadroom raises feeCap to baseFee*2 + tipCap, clamped to maxGasPrice,
+// so the replacement stays includable if the base fee keeps rising.
+func withHeadroom(feeCap, tipCap, baseFee, maxGasPrice *big.Int) *big.Int {
+	headroom := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tipCap)
+	if maxGasPrice != nil && headroom.Cmp(maxGasPrice) > 0 {
+		headroom.Set(maxGasPrice)
+	}
+	if headroom.Cmp(feeCap) > 0 {
+		return headroom
+	}
+	return feeCap
+}
+
+// replacementValue returns what a replacement paying up to gasPrice for gas
+// can send without costing more than orig could: orig's value plus its
+// maximum fee, minus the replacement's maximum fee. Without feesFromValue the
+// fees come out of the balance and orig's value is kept.
+func replacementValue(orig *types.Transaction, gasPrice *big.Int, gas uint64, feesFromValue bool) (*big.Int, error) {
+	if !feesFromValue {
+		return new(big.Int).Set(orig.Value()), nil
+	}
+
+	fees := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	value := new(big.Int).Sub(orig.Cost(), fees)
+	if value.Sign() <= 0 {
+		return nil, errFeesExceedValue
+	}
+	return value, nil
+}
+
+// fullBalanceValue returns what a replacement paying up to gasPrice for gas
+// can send when it sweeps balance, leaving reserve behind.
+func fullBalanceValue(balance, reserve, gasPrice *big.Int, gas uint64) (*big.Int, error) {
+	value := new(big.Int).Sub(balance, new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas)))
+	if reserve != nil {
+		value.Sub(value, reserve)
+	}
+	if value.Sign() <= 0 {
+		return nil, errBelowReserve
+	}
+	return value, nil
+}
+
+// withValue returns a copy of the unsigned tx sending value instead.
+func withValue(tx *types.Transaction, value *big.Int) *types.Transaction {
+	switch tx.Type() {
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			To:         tx.To(),
+			Value:      value,
+			Gas:        tx.Gas(),
+			GasTipCap:  tx.GasTipCap(),
+			GasFeeCap:  tx.GasFeeCap(),
+			Nonce:      tx.Nonce(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    tx.ChainId(),
+			To:         tx.To(),
+			Value:      value,
+			Gas:        tx.Gas(),
+			GasPrice:   tx.GasPrice(),
+			Nonce:      tx.Nonce(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	default:
+		return types.NewTx(&types.LegacyTx{
+			To:       tx.To(),
+			Value:    value,
+			Gas:      tx.Gas(),
+			GasPrice: tx.GasPrice(),
+			Nonce:    tx.Nonce(),
+			Data:     tx.Data(),
+		})
+	}
+}
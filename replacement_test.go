@@ -0,0 +1,472 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestBumpPriceKeepsPrecision(t *testing.T) {
+	tests := []struct {
+		price   int64
+		percent uint64
+		want    int64
+	}{
+		// Dividing first would truncate 9*11/100 to 0 and not bump at all.
+		{9, 11, 9},
+		{10, 11, 11},
+		{100, 11, 111},
+		{1_000_000_007, 11, 1_110_000_007},
+		{50, 100, 100},
+	}
+	for _, tt := range tests {
+		got, ok := bumpPrice(big.NewInt(tt.price), tt.percent, nil)
+		if !ok || got.Int64() != tt.want {
+			t.Errorf("bumpPrice(%d, %d) = %s, %v, want %d, true", tt.price, tt.percent, got, ok, tt.want)
+		}
+	}
+}
+
+func TestBumpPriceDeltaOfLargePrices(t *testing.T) {
+	// 10^30 wei is beyond float64 precision.
+	price, _ := new(big.Int).SetString("1000000000000000000000000000001", 10)
+	want, _ := new(big.Int).SetString("1110000000000000000000000000001", 10)
+	if got, _ := bumpPrice(price, 11, nil); got.Cmp(want) != 0 {
+		t.Fatalf("bumpPrice() = %s, want %s", got, want)
+	}
+}
+
+// testFees is the fee policy of tests, bumping by the default percent.
+var testFees = feePolicy{bumpPercent: defaultBumpPercent}
+
+func newDynamicTx(nonce uint64, value, tipCap, feeCap int64, data []byte) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     nonce,
+		To:        &testAttacker,
+		Value:     big.NewInt(value),
+		Gas:       transferGas,
+		GasTipCap: big.NewInt(tipCap),
+		GasFeeCap: big.NewInt(feeCap),
+		Data:      data,
+	})
+}
+
+func newLegacyTx(nonce uint64, value, gasPrice int64) *types.Transaction {
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       &testAttacker,
+		Value:    big.NewInt(value),
+		Gas:      transferGas,
+		GasPrice: big.NewInt(gasPrice),
+	})
+}
+
+func TestBuildReplacementOfDynamicFeeTx(t *testing.T) {
+	orig := newDynamicTx(7, params.Ether, 2*params.GWei, 100*params.GWei, nil)
+
+	replacementTx, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, transferGas, testFees, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacementTx.Type() != types.DynamicFeeTxType {
+		t.Fatalf("replacement type = %d, want a dynamic fee tx", replacementTx.Type())
+	}
+	if replacementTx.Nonce() != orig.Nonce() || *replacementTx.To() != testReceiverAddress {
+		t.Fatalf("replacement = nonce %d to %s, want nonce %d to %s", replacementTx.Nonce(), replacementTx.To(), orig.Nonce(), testReceiverAddress)
+	}
+	if got, want := replacementTx.GasTipCap(), big.NewInt(2220000000); got.Cmp(want) != 0 {
+		t.Fatalf("tip = %s, want %s", got, want)
+	}
+	if got, want := replacementTx.GasFeeCap(), big.NewInt(111*params.GWei); got.Cmp(want) != 0 {
+		t.Fatalf("fee cap = %s, want %s", got, want)
+	}
+	if !outbids(replacementTx, orig) {
+		t.Fatal("replacement doesn't outbid the original")
+	}
+
+	// It spends what the original could at most, value and fee cap.
+	fee := new(big.Int).Mul(replacementTx.GasFeeCap(), big.NewInt(transferGas))
+	if got, want := new(big.Int).Add(replacementTx.Value(), fee), orig.Cost(); got.Cmp(want) != 0 {
+		t.Fatalf("replacement costs %s, want %s", got, want)
+	}
+}
+
+func TestBuildReplacementKeepsTipBelowFeeCap(t *testing.T) {
+	// A raised tip floor above the fee cap lifts the fee cap along.
+	fees := feePolicy{bumpPercent: defaultBumpPercent, minTip: big.NewInt(50 * params.GWei)}
+	orig := newDynamicTx(0, params.Ether, params.GWei, 20*params.GWei, nil)
+
+	replacementTx, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, transferGas, fees, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacementTx.GasTipCap().Cmp(replacementTx.GasFeeCap()) > 0 {
+		t.Fatalf("tip %s exceeds fee cap %s", replacementTx.GasTipCap(), replacementTx.GasFeeCap())
+	}
+	if replacementTx.GasTipCap().Cmp(fees.minTip) != 0 {
+		t.Fatalf("tip = %s, want the floor %s", replacementTx.GasTipCap(), fees.minTip)
+	}
+}
+
+func TestBuildReplacementRejectsFeesAboveValue(t *testing.T) {
+	// 1 wei at 1 gwei: the bumped fee exceeds everything the original spends.
+	orig := newLegacyTx(0, 1, params.GWei)
+	if _, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, transferGas, testFees, nil); !errors.Is(err, errFeesExceedValue) {
+		t.Fatalf("buildReplacement() = %v, want %v", err, errFeesExceedValue)
+	}
+}
+
+func TestReplacementValue(t *testing.T) {
+	orig := newLegacyTx(0, params.Ether, params.GWei)
+	gasPrice := big.NewInt(2 * params.GWei)
+
+	value, err := replacementValue(orig, gasPrice, transferGas, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The original's cost minus the replacement's fee.
+	want := new(big.Int).Sub(orig.Cost(), new(big.Int).Mul(gasPrice, big.NewInt(transferGas)))
+	if value.Cmp(want) != 0 {
+		t.Fatalf("replacementValue() = %s, want %s", value, want)
+	}
+
+	// Without feesFromValue the value is kept, fees come from the balance.
+	if value, _ := replacementValue(orig, gasPrice, transferGas, false); value.Cmp(orig.Value()) != 0 {
+		t.Fatalf("replacementValue() = %s, want %s", value, orig.Value())
+	}
+
+	// A fee exactly eating the value leaves nothing to send.
+	exact := new(big.Int).Div(orig.Cost(), big.NewInt(transferGas))
+	if _, err := replacementValue(newLegacyTx(0, 0, exact.Int64()), exact, transferGas, true); !errors.Is(err, errFeesExceedValue) {
+		t.Fatalf("replacementValue() = %v, want %v", err, errFeesExceedValue)
+	}
+}
+
+func TestBumpPriceClampsToMaxGasPrice(t *testing.T) {
+	price := big.NewInt(100)
+
+	// Within the cap the full bump applies.
+	if got, ok := bumpPrice(price, 20, big.NewInt(200)); !ok || got.Int64() != 120 {
+		t.Fatalf("bumpPrice() = %s, %v, want 120, true", got, ok)
+	}
+	// Above it the cap applies as long as it's still a 10% bump.
+	if got, ok := bumpPrice(price, 20, big.NewInt(112)); !ok || got.Int64() != 112 {
+		t.Fatalf("bumpPrice() = %s, %v, want 112, true", got, ok)
+	}
+	if _, ok := bumpPrice(price, 20, big.NewInt(105)); ok {
+		t.Fatal("bumpPrice() accepted a cap nodes won't take as a replacement")
+	}
+}
+
+func TestBuildReplacementRespectsMaxGasPrice(t *testing.T) {
+	orig := newLegacyTx(0, params.Ether, 100*params.GWei)
+	fees := feePolicy{bumpPercent: defaultBumpPercent, maxGasPrice: big.NewInt(105 * params.GWei)}
+	if _, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, transferGas, fees, nil); !errors.Is(err, errCantOutbid) {
+		t.Fatalf("buildReplacement() = %v, want %v", err, errCantOutbid)
+	}
+
+	fees.maxGasPrice = big.NewInt(110 * params.GWei)
+	replacementTx, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, transferGas, fees, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacementTx.GasPrice().Cmp(fees.maxGasPrice) != 0 {
+		t.Fatalf("gas price = %s, want the cap %s", replacementTx.GasPrice(), fees.maxGasPrice)
+	}
+}
+
+func TestBuildReplacement(t *testing.T) {
+	capped := feePolicy{bumpPercent: defaultBumpPercent, maxGasPrice: big.NewInt(105 * params.GWei)}
+	tests := []struct {
+		name         string
+		orig         *types.Transaction
+		fees         feePolicy
+		wantType     uint8
+		wantGasPrice int64
+		wantErr      error
+	}{
+		{"legacy", newLegacyTx(0, params.Ether, 10*params.GWei), testFees, types.LegacyTxType, 111 * params.GWei / 10, nil},
+		{"dynamic", newDynamicTx(0, params.Ether, params.GWei, 10*params.GWei, nil), testFees, types.DynamicFeeTxType, 111 * params.GWei / 10, nil},
+		{"underflow", newLegacyTx(0, 1, params.GWei), testFees, 0, 0, errFeesExceedValue},
+		{"clamped to the cap", newLegacyTx(0, params.Ether, 95*params.GWei), capped, types.LegacyTxType, 105 * params.GWei, nil},
+		{"cap can't outbid", newLegacyTx(0, params.Ether, 100*params.GWei), capped, 0, 0, errCantOutbid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			origHash := test.orig.Hash()
+			replacementTx, err := buildReplacement(test.orig, testReceiverAddress, nil, nil, false, transferGas, test.fees, nil)
+			if test.orig.Hash() != origHash {
+				t.Fatal("buildReplacement() modified the original")
+			}
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("buildReplacement() = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replacementTx.Type() != test.wantType {
+				t.Fatalf("replacement type = %d, want %d", replacementTx.Type(), test.wantType)
+			}
+			// GasFeeCap is the gas price of legacy txs.
+			if got := replacementTx.GasFeeCap(); got.Cmp(big.NewInt(test.wantGasPrice)) != 0 {
+				t.Fatalf("fee cap = %s, want %d", got, test.wantGasPrice)
+			}
+			if replacementTx.Nonce() != test.orig.Nonce() || *replacementTx.To() != testReceiverAddress {
+				t.Fatalf("replacement = nonce %d to %s, want nonce %d to the receiver", replacementTx.Nonce(), replacementTx.To(), test.orig.Nonce())
+			}
+		})
+	}
+}
+
+func TestWithHeadroom(t *testing.T) {
+	tests := []struct {
+		feeCap, tipCap, baseFee int64
+		maxGasPrice             *big.Int
+		want                    int64
+	}{
+		// The bumped cap already covers twice the base fee.
+		{100, 2, 10, nil, 100},
+		{100, 2, 60, nil, 122},
+		{100, 2, 60, big.NewInt(110), 110},
+		// The cap never lowers the bumped fee cap.
+		{100, 2, 60, big.NewInt(90), 100},
+	}
+	for _, tt := range tests {
+		got := withHeadroom(big.NewInt(tt.feeCap), big.NewInt(tt.tipCap), big.NewInt(tt.baseFee), tt.maxGasPrice)
+		if got.Int64() != tt.want {
+			t.Errorf("withHeadroom(%d, %d, %d, %v) = %s, want %d", tt.feeCap, tt.tipCap, tt.baseFee, tt.maxGasPrice, got, tt.want)
+		}
+	}
+}
+
+func TestBuildReplacementUnderBaseFees(t *testing.T) {
+	orig := newDynamicTx(0, params.Ether, params.GWei, 10*params.GWei, nil)
+	bumpedTip := int64(111 * params.GWei / 100)
+	tests := []struct {
+		name       string
+		baseFee    *big.Int
+		wantFeeCap int64
+	}{
+		{"unknown", nil, 111 * params.GWei / 10},
+		{"low", big.NewInt(params.GWei), 111 * params.GWei / 10},
+		{"risen", big.NewInt(20 * params.GWei), 40*params.GWei + bumpedTip},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replacementTx, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, transferGas, testFees, test.baseFee)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := replacementTx.GasTipCap(); got.Int64() != bumpedTip {
+				t.Fatalf("tip = %s, want %d", got, bumpedTip)
+			}
+			if got := replacementTx.GasFeeCap(); got.Int64() != test.wantFeeCap {
+				t.Fatalf("fee cap = %s, want %d", got, test.wantFeeCap)
+			}
+		})
+	}
+}
+
+func TestReplacementsNeverCostMoreThanOriginal(t *testing.T) {
+	capped := feePolicy{bumpPercent: 50, maxGasPrice: big.NewInt(300 * params.GWei)}
+	for _, fees := range []feePolicy{testFees, capped} {
+		for _, gasPrice := range []int64{1, params.GWei, 37 * params.GWei, 200 * params.GWei} {
+			for _, value := range []int64{params.GWei * transferGas * 3, params.Ether} {
+				for _, orig := range []*types.Transaction{
+					newLegacyTx(0, value, gasPrice),
+					newDynamicTx(0, value, gasPrice/2, gasPrice, nil),
+				} {
+					for _, baseFee := range []*big.Int{nil, big.NewInt(gasPrice)} {
+						replacementTx, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, transferGas, fees, baseFee)
+						if err != nil {
+							continue
+						}
+						fee := new(big.Int).Mul(replacementTx.GasFeeCap(), new(big.Int).SetUint64(replacementTx.Gas()))
+						if cost := new(big.Int).Add(replacementTx.Value(), fee); cost.Cmp(orig.Cost()) > 0 {
+							t.Errorf("replacement of type %d at %d wei with base fee %v costs %s, more than the original's %s", orig.Type(), gasPrice, baseFee, cost, orig.Cost())
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+var testAccessList = types.AccessList{{
+	Address:     testToken,
+	StorageKeys: []common.Hash{common.HexToHash("0x01")},
+}}
+
+func TestBuildReplacementKeepsAccessLists(t *testing.T) {
+	origs := []*types.Transaction{
+		types.NewTx(&types.AccessListTx{
+			ChainID:    big.NewInt(1),
+			To:         &testAttacker,
+			Value:      big.NewInt(params.Ether),
+			Gas:        50_000,
+			GasPrice:   big.NewInt(params.GWei),
+			AccessList: testAccessList,
+		}),
+		types.NewTx(&types.DynamicFeeTx{
+			ChainID:    big.NewInt(1),
+			To:         &testAttacker,
+			Value:      big.NewInt(params.Ether),
+			Gas:        50_000,
+			GasTipCap:  big.NewInt(params.GWei),
+			GasFeeCap:  big.NewInt(10 * params.GWei),
+			AccessList: testAccessList,
+		}),
+	}
+	for _, orig := range origs {
+		replacementTx, err := buildReplacement(orig, testReceiverAddress, nil, nil, false, orig.Gas(), testFees, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replacementTx.Type() != orig.Type() {
+			t.Fatalf("replacement type = %d, want the original's %d", replacementTx.Type(), orig.Type())
+		}
+		if !reflect.DeepEqual(replacementTx.AccessList(), testAccessList) {
+			t.Fatalf("replacement access list = %v, want %v", replacementTx.AccessList(), testAccessList)
+		}
+		if rebuilt := withValue(replacementTx, big.NewInt(1)); !reflect.DeepEqual(rebuilt.AccessList(), testAccessList) || rebuilt.Type() != orig.Type() {
+			t.Fatalf("withValue() dropped the access list of a type %d tx", orig.Type())
+		}
+	}
+}
+
+func TestReplacePendingOfAccessListTx(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRecordingChain(t, Options{BumpPercent: defaultBumpPercent}, key)
+
+	orig, err := types.SignNewTx(key, chain.signer, &types.AccessListTx{
+		ChainID:    chain.signer.ChainID(),
+		To:         &testAttacker,
+		Value:      big.NewInt(params.Ether / 2),
+		Gas:        50_000,
+		GasPrice:   big.NewInt(params.GWei),
+		AccessList: testAccessList,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.replacePending(context.Background(), orig, time.Now())
+
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the replacement", len(sent))
+	}
+	if sent[0].Type() != types.AccessListTxType || !reflect.DeepEqual(sent[0].AccessList(), testAccessList) {
+		t.Fatalf("replacement = type %d with access list %v, want the original's list", sent[0].Type(), sent[0].AccessList())
+	}
+	// A transfer plus one address and one storage key.
+	if intrinsic := uint64(transferGas + params.TxAccessListAddressGas + params.TxAccessListStorageKeyGas); sent[0].Gas() < intrinsic {
+		t.Fatalf("replacement gas = %d, want at least the intrinsic %d", sent[0].Gas(), intrinsic)
+	}
+}
+
+func TestFullBalanceValue(t *testing.T) {
+	gasPrice := big.NewInt(10 * params.GWei)
+	fee := int64(10 * params.GWei * transferGas)
+	ether := int64(params.Ether)
+
+	tests := []struct {
+		name    string
+		balance int64
+		reserve *big.Int
+		want    int64
+		wantErr error
+	}{
+		{"no reserve", ether, nil, ether - fee, nil},
+		{"with reserve", ether, big.NewInt(ether / 10), ether - fee - ether/10, nil},
+		{"fee only", fee + 1, nil, 1, nil},
+		{"below fee", fee, nil, 0, errBelowReserve},
+		{"below reserve", fee + 1, big.NewInt(1), 0, errBelowReserve},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := fullBalanceValue(big.NewInt(test.balance), test.reserve, gasPrice, transferGas)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("fullBalanceValue() error = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && got.Int64() != test.want {
+				t.Fatalf("fullBalanceValue() = %s, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildReplacementLegacyOnly(t *testing.T) {
+	orig := newDynamicTx(0, params.Ether, params.GWei, 10*params.GWei, nil)
+	replacementTx, err := buildReplacement(orig, testReceiverAddress, nil, nil, true, transferGas, testFees, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bumped fee cap becomes the gas price.
+	if replacementTx.Type() != types.LegacyTxType || replacementTx.GasPrice().Cmp(big.NewInt(111*params.GWei/10)) != 0 {
+		t.Fatalf("replacement = type %d gas price %s, want a legacy tx at 11.1 gwei", replacementTx.Type(), replacementTx.GasPrice())
+	}
+}
+
+func TestBuildReplacementRaisesFeesToFloors(t *testing.T) {
+	floors := feePolicy{bumpPercent: defaultBumpPercent, minGasPrice: big.NewInt(30 * params.GWei), minTip: big.NewInt(3 * params.GWei)}
+	tests := []struct {
+		name                string
+		orig                *types.Transaction
+		fees                feePolicy
+		wantFeeCap, wantTip int64
+	}{
+		{"legacy below floor", newLegacyTx(0, params.Ether, 10*params.GWei), floors, 30 * params.GWei, 30 * params.GWei},
+		{"legacy above floor", newLegacyTx(0, params.Ether, 50*params.GWei), floors, 555 * params.GWei / 10, 555 * params.GWei / 10},
+		{"dynamic below floors", newDynamicTx(0, params.Ether, params.GWei, 10*params.GWei, nil), floors, 30 * params.GWei, 3 * params.GWei},
+		{"dynamic above floors", newDynamicTx(0, params.Ether, 10*params.GWei, 50*params.GWei, nil), floors, 555 * params.GWei / 10, 111 * params.GWei / 10},
+		{"floor above cap", newLegacyTx(0, params.Ether, 10*params.GWei), feePolicy{bumpPercent: defaultBumpPercent, minGasPrice: big.NewInt(30 * params.GWei), maxGasPrice: big.NewInt(20 * params.GWei)}, 20 * params.GWei, 20 * params.GWei},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replacementTx, err := buildReplacement(test.orig, testReceiverAddress, nil, nil, false, transferGas, test.fees, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replacementTx.GasFeeCap().Int64() != test.wantFeeCap || replacementTx.GasTipCap().Int64() != test.wantTip {
+				t.Fatalf("fee cap %s tip %s, want %d and %d", replacementTx.GasFeeCap(), replacementTx.GasTipCap(), test.wantFeeCap, test.wantTip)
+			}
+		})
+	}
+}
+
+func TestBuildCancel(t *testing.T) {
+	from := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	tests := []struct {
+		name string
+		orig *types.Transaction
+	}{
+		{"legacy", newLegacyTx(3, params.Ether, 10*params.GWei)},
+		{"dynamic", newDynamicTx(3, params.Ether, params.GWei, 10*params.GWei, nil)},
+		{"contract call", newDynamicTx(3, 0, params.GWei, 10*params.GWei, transferData(testAttacker, big.NewInt(1)))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cancelTx, err := buildCancel(test.orig, from, false, testFees, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isCancel(from, cancelTx) || cancelTx.Nonce() != test.orig.Nonce() || cancelTx.Gas() != params.TxGas {
+				t.Fatalf("cancel = nonce %d to %s value %s gas %d, want a zero-value self-send at nonce %d", cancelTx.Nonce(), cancelTx.To(), cancelTx.Value(), cancelTx.Gas(), test.orig.Nonce())
+			}
+			if !outbids(cancelTx, test.orig) {
+				t.Fatal("cancel doesn't outbid the original")
+			}
+		})
+	}
+}
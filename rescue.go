@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// tokenMethod is a token call pending txs are recognized by and rewritten
+// so they benefit the receiver instead.
+type tokenMethod struct {
+	selector []byte
+	// words is how many static 32 byte arguments the call takes.
+	words int
+	// beneficiary returns who a call with args hands tokens or allowance
+	// to, false when the call needs no rescue.
+	beneficiary func(args []byte) (common.Address, bool)
+	// rescue returns the calldata replacing a call with args.
+	rescue func(args []byte, receiver common.Address) []byte
+}
+
+var (
+	approveSelector          = []byte{0x09, 0x5e, 0xa7, 0xb3}
+	safeTransferFromSelector = []byte{0x42, 0x84, 0x2e, 0x0e}
+)
+
+// tokenMethods are the rescues rescue_methods can enable, by name.
+var tokenMethods = map[string]tokenMethod{
+	// ERC-20 transfer(to, amount) becomes a transfer of the amount to the
+	// receiver.
+	"transfer": {
+		selector: transferSelector,
+		words:    2,
+		beneficiary: func(args []byte) (common.Address, bool) {
+			return addressArg(args, 0)
+		},
+		rescue: func(args []byte, receiver common.Address) []byte {
+			return transferData(receiver, new(big.Int).SetBytes(wordArg(args, 1)))
+		},
+	},
+	// approve(spender, amount) becomes revoking the spender's allowance.
+	// Revoking calls, including our own rescues, pass through.
+	"approve": {
+		selector: approveSelector,
+		words:    2,
+		beneficiary: func(args []byte) (common.Address, bool) {
+			spender, ok := addressArg(args, 0)
+			return spender, ok && new(big.Int).SetBytes(wordArg(args, 1)).Sign() != 0
+		},
+		rescue: func(args []byte, _ common.Address) []byte {
+			return callData(approveSelector, wordArg(args, 0), make([]byte, 32))
+		},
+	},
+	// ERC-721 safeTransferFrom(from, to, tokenId) sends the token to the
+	// receiver instead.
+	"safeTransferFrom": {
+		selector: safeTransferFromSelector,
+		words:    3,
+		beneficiary: func(args []byte) (common.Address, bool) {
+			if _, ok := addressArg(args, 0); !ok {
+				return common.Address{}, false
+			}
+			return addressArg(args, 1)
+		},
+		rescue: func(args []byte, receiver common.Address) []byte {
+			return callData(safeTransferFromSelector, wordArg(args, 0), common.LeftPadBytes(receiver.Bytes(), 32), wordArg(args, 2))
+		},
+	},
+}
+
+// defaultRescueMethods keeps replacing ERC-20 transfers only when
+// rescue_methods isn't set.
+var defaultRescueMethods = []string{"transfer"}
+
+// rescueSet holds the enabled token methods by selector.
+type rescueSet map[[4]byte]tokenMethod
+
+// newRescueSet returns the methods named in names, which must be known.
+func newRescueSet(names []string) (rescueSet, error) {
+	if len(names) == 0 {
+		names = defaultRescueMethods
+	}
+
+	set := make(rescueSet, len(names))
+	for _, name := range names {
+		method, ok := tokenMethods[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rescue method %q", name)
+		}
+		set[[4]byte(method.selector)] = method
+	}
+	return set, nil
+}
+
+// match returns the enabled method data calls and who the call benefits,
+// reporting false for unknown calls and ones that need no rescue.
+func (s rescueSet) match(data []byte) (method tokenMethod, beneficiary common.Address, ok bool) {
+	if len(data) < 4 {
+		return tokenMethod{}, common.Address{}, false
+	}
+	method, ok = s[[4]byte(data[:4])]
+	if !ok || len(data) != 4+32*method.words {
+		return tokenMethod{}, common.Address{}, false
+	}
+
+	beneficiary, ok = method.beneficiary(data[4:])
+	return method, beneficiary, ok
+}
+
+// addressArg returns the i-th argument word as an address, false when it
+// isn't left padded with zeroes.
+func addressArg(args []byte, i int) (common.Address, bool) {
+	word := wordArg(args, i)
+	if !bytes.Equal(word[:12], make([]byte, 12)) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(word[12:]), true
+}
+
+func wordArg(args []byte, i int) []byte {
+	return args[32*i : 32*(i+1)]
+}
+
+func callData(selector []byte, words ...[]byte) []byte {
+	data := append([]byte{}, selector...)
+	for _, word := range words {
+		data = append(data, word...)
+	}
+	return data
+}
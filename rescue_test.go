@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// signTestCall signs a legacy call of to with data from key at nonce.
+func signTestCall(t testing.TB, signer types.Signer, key *ecdsa.PrivateKey, to common.Address, nonce uint64, data []byte) *types.Transaction {
+	t.Helper()
+
+	tx, err := types.SignNewTx(key, signer, &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &to,
+		Gas:      100_000,
+		GasPrice: big.NewInt(params.GWei),
+		Data:     data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// newRescueChain returns a recording chain defending key that rescues the
+// token calls in names.
+func newRescueChain(t *testing.T, key *ecdsa.PrivateKey, names ...string) (*Chain, *recordingBackend) {
+	t.Helper()
+
+	rescues, err := newRescueSet(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRecordingChain(t, Options{BumpPercent: defaultBumpPercent, Rescues: rescues}, key)
+}
+
+func TestReplacePendingRescuesTokenTransfers(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRescueChain(t, key)
+	amount := big.NewInt(1_000_000)
+
+	orig := signTestCall(t, chain.signer, key, testToken, 0, transferData(testAttacker, amount))
+	chain.replacePending(context.Background(), orig, time.Now())
+
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the rescue", len(sent))
+	}
+	rescueTx := sent[0]
+	if *rescueTx.To() != testToken || rescueTx.Nonce() != orig.Nonce() {
+		t.Fatalf("rescue = nonce %d to %s, want nonce %d to the token", rescueTx.Nonce(), rescueTx.To(), orig.Nonce())
+	}
+	if want := transferData(testReceiverAddress, amount); !bytes.Equal(rescueTx.Data(), want) {
+		t.Fatalf("rescue data = %x, want %x", rescueTx.Data(), want)
+	}
+	if !outbids(rescueTx, orig) {
+		t.Fatal("rescue doesn't outbid the original")
+	}
+}
+
+func TestReplacePendingLeavesTokenTransfersToReceiver(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRescueChain(t, key)
+
+	orig := signTestCall(t, chain.signer, key, testToken, 0, transferData(testReceiverAddress, big.NewInt(1_000_000)))
+	chain.replacePending(context.Background(), orig, time.Now())
+
+	if sent := backend.sentTxs(); len(sent) != 0 {
+		t.Fatalf("sent %d txs for a transfer to the receiver, want none", len(sent))
+	}
+}
+
+func TestRescueSetMatchesTransfers(t *testing.T) {
+	rescues, err := newRescueSet(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := transferData(testAttacker, big.NewInt(1))
+	if _, beneficiary, ok := rescues.match(data); !ok || beneficiary != testAttacker {
+		t.Fatalf("match() = %s, %v, want %s, true", beneficiary, ok, testAttacker)
+	}
+	// Malformed calls aren't taken for transfers.
+	for _, data := range [][]byte{data[:4], data[:len(data)-1], append(data, 0)} {
+		if _, _, ok := rescues.match(data); ok {
+			t.Errorf("match(%x) took malformed calldata for a transfer", data)
+		}
+	}
+}
+
+func TestRescueSetMethods(t *testing.T) {
+	rescues, err := newRescueSet([]string{"transfer", "approve", "safeTransferFrom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	word := func(v int64) []byte { return common.LeftPadBytes(big.NewInt(v).Bytes(), 32) }
+	address := func(a common.Address) []byte { return common.LeftPadBytes(a.Bytes(), 32) }
+	owner := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantOK    bool
+		wantTo    common.Address
+		wantCalls []byte
+	}{
+		{"transfer", transferData(testAttacker, big.NewInt(7)), true, testAttacker, transferData(testReceiverAddress, big.NewInt(7))},
+		{"approve", callData(approveSelector, address(testAttacker), word(7)), true, testAttacker, callData(approveSelector, address(testAttacker), word(0))},
+		{"revoking approve", callData(approveSelector, address(testAttacker), word(0)), false, testAttacker, nil},
+		{"safeTransferFrom", callData(safeTransferFromSelector, address(owner), address(testAttacker), word(42)), true, testAttacker, callData(safeTransferFromSelector, address(owner), address(testReceiverAddress), word(42))},
+		{"unknown selector", callData([]byte{0x23, 0xb8, 0x72, 0xdd}, address(owner), address(testAttacker), word(7)), false, testAttacker, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method, beneficiary, ok := rescues.match(test.data)
+			if ok != test.wantOK {
+				t.Fatalf("match() = %v, want %v", ok, test.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if beneficiary != test.wantTo {
+				t.Fatalf("match() beneficiary = %s, want %s", beneficiary, test.wantTo)
+			}
+			if got := method.rescue(test.data[4:], testReceiverAddress); !bytes.Equal(got, test.wantCalls) {
+				t.Fatalf("rescue() = %x, want %x", got, test.wantCalls)
+			}
+		})
+	}
+
+	if _, err := newRescueSet([]string{"transferFrom"}); err == nil {
+		t.Fatal("newRescueSet() accepted an unknown method")
+	}
+}
+
+func TestReplacePendingRevokesApprovals(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, backend := newRescueChain(t, key, "approve")
+	spender := common.LeftPadBytes(testAttacker.Bytes(), 32)
+
+	orig := signTestCall(t, chain.signer, key, testToken, 0, callData(approveSelector, spender, common.LeftPadBytes(big.NewInt(1_000_000).Bytes(), 32)))
+	chain.replacePending(context.Background(), orig, time.Now())
+
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the revoke", len(sent))
+	}
+	if want := callData(approveSelector, spender, make([]byte, 32)); *sent[0].To() != testToken || !bytes.Equal(sent[0].Data(), want) {
+		t.Fatalf("rescue = %x to %s, want %x to the token", sent[0].Data(), sent[0].To(), want)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// SelfTest signs a dummy transaction with the key of every account and
+// checks that its sender recovers to the account's address. Loaded accounts
+// are keyed by the address their key derives, so declared, the addresses the
+// config and key files name independently of the keys, must each be signed
+// for by a loaded key too, catching keys that were corrupted or stored under
+// the wrong address. Every mismatch is logged, it fails if there was any.
+func SelfTest(accounts Accounts, declared map[common.Address]string) error {
+	addresses := make([]common.Address, 0, len(accounts))
+	for address := range accounts {
+		addresses = append(addresses, address)
+	}
+	for address := range declared {
+		if _, ok := accounts[address]; !ok {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool { return bytes.Compare(addresses[i][:], addresses[j][:]) < 0 })
+
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	failed := 0
+	for _, address := range addresses {
+		privateKey, ok := accounts[address]
+		if !ok {
+			slog.Error("account failed self-test", "account", address, "source", declared[address], "err", "no loaded key signs as it")
+			failed++
+			continue
+		}
+		if err := selfTestKey(signer, address, localKey{key: privateKey}); err != nil {
+			slog.Error("account failed self-test", "account", address, "err", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d accounts failed the self-test", failed, len(addresses))
+	}
+	return nil
+}
+
+// DeclaredAccounts returns the account addresses config names apart from the
+// keys themselves, mapped to where they're named: the address field of every
+// keystore file and the accounts receivers are set for. The latter are left
+// out when an external signer or hardware wallet holds keys the self-test
+// doesn't load.
+func DeclaredAccounts(config Config) (map[common.Address]string, error) {
+	declared := make(map[common.Address]string)
+	if config.ExternalSignerURL == "" && config.HardwareWallet == "" {
+		for account := range config.Receivers {
+			declared[account] = "receivers"
+		}
+	}
+	if config.KeystoreDir == "" {
+		return declared, nil
+	}
+
+	entries, err := os.ReadDir(config.KeystoreDir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read keystore: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		// Files that can't be read were already logged while loading.
+		path := filepath.Join(config.KeystoreDir, entry.Name())
+		keyJSON, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var keyFile struct {
+			Address string `json:"address"`
+		}
+		if json.Unmarshal(keyJSON, &keyFile) != nil || !common.IsHexAddress(keyFile.Address) {
+			continue
+		}
+		declared[common.HexToAddress(keyFile.Address)] = path
+	}
+	return declared, nil
+}
+
+func selfTestKey(signer types.Signer, address common.Address, key accountKey) error {
+	dummy := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   signer.ChainID(),
+		To:        &address,
+		Value:     new(big.Int),
+		Gas:       21000,
+		GasTipCap: new(big.Int),
+		GasFeeCap: new(big.Int),
+	})
+
+	signedTx, err := key.sign(dummy, signer)
+	if err != nil {
+		return fmt.Errorf("couldn't sign: %w", err)
+	}
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil {
+		return fmt.Errorf("couldn't recover sender: %w", err)
+	}
+	if sender != address {
+		return fmt.Errorf("key signs as %s", sender)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// writeKeystoreFile encrypts a new key into dir and returns its address.
+func writeKeystoreFile(t *testing.T, dir, passphrase string) common.Address {
+	t.Helper()
+
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &keystore.Key{
+		Id:         uuid.New(),
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		PrivateKey: privateKey,
+	}
+	keyJSON, err := keystore.EncryptKey(key, passphrase, keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, key.Address.Hex()+".json"), keyJSON, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return key.Address
+}
+
+func TestSelfTestPassesGoodKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeKeystoreFile(t, dir, "secret")
+	writeKeystoreFile(t, dir, "secret")
+
+	accounts, err := LoadKeystore(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared, err := DeclaredAccounts(Config{KeystoreDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(declared) != 2 {
+		t.Fatalf("declared %d accounts, want 2", len(declared))
+	}
+	if err := SelfTest(accounts, declared); err != nil {
+		t.Fatalf("SelfTest() = %v, want nil", err)
+	}
+}
+
+func TestSelfTestFailsTamperedKeystoreAddress(t *testing.T) {
+	dir := t.TempDir()
+	address := writeKeystoreFile(t, dir, "secret")
+
+	// Point the file at another account, the key still derives the old one.
+	path := filepath.Join(dir, address.Hex()+".json")
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tampered := strings.Replace(string(keyJSON), strings.ToLower(address.Hex()[2:]), strings.ToLower(other.Hex()[2:]), 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := LoadKeystore(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared, err := DeclaredAccounts(Config{KeystoreDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := declared[other]; !ok {
+		t.Fatalf("declared = %v, want %s", declared, other)
+	}
+	if err := SelfTest(accounts, declared); err == nil {
+		t.Fatal("SelfTest() = nil, want an error for the tampered file")
+	}
+}
+
+func TestSelfTestFailsReceiverAccountWithoutKey(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := crypto.PubkeyToAddress(privateKey.PublicKey)
+	missing := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	receiver := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+
+	config := Config{Receivers: map[common.Address]common.Address{loaded: receiver, missing: receiver}}
+	declared, err := DeclaredAccounts(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SelfTest(Accounts{loaded: privateKey}, declared); err == nil {
+		t.Fatal("SelfTest() = nil, want an error for the account without a key")
+	}
+
+	delete(config.Receivers, missing)
+	if declared, err = DeclaredAccounts(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := SelfTest(Accounts{loaded: privateKey}, declared); err != nil {
+		t.Fatalf("SelfTest() = %v, want nil", err)
+	}
+}
+
+func TestSelfTestKeyRejectsWrongAddress(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	if err := SelfTest(Accounts{other: privateKey}, nil); err == nil {
+		t.Fatal("SelfTest() = nil, want an error for a key stored under the wrong address")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// accountKey signs txs for one controlled account.
+type accountKey interface {
+	sign(tx *types.Transaction, signer types.Signer) (*types.Transaction, error)
+}
+
+type localKey struct {
+	key *ecdsa.PrivateKey
+}
+
+func (k localKey) sign(tx *types.Transaction, signer types.Signer) (*types.Transaction, error) {
+	return types.SignTx(tx, signer, k.key)
+}
+
+// ExternalSigner signs for the accounts held by a clef compatible signer, so
+// their keys never enter this process.
+type ExternalSigner struct {
+	signer   *external.ExternalSigner
+	accounts map[common.Address]bool
+}
+
+// DialExternalSigner connects to the signer at url and lists its accounts
+// once, clef asks for approval every time they're listed.
+func DialExternalSigner(url string) (*ExternalSigner, error) {
+	signer, err := external.NewExternalSigner(url)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := signer.Accounts()
+	if len(listed) == 0 {
+		return nil, errors.New("external signer has no accounts")
+	}
+
+	addresses := make(map[common.Address]bool, len(listed))
+	for _, account := range listed {
+		addresses[account.Address] = true
+	}
+	return &ExternalSigner{signer: signer, accounts: addresses}, nil
+}
+
+// key returns the key for address when the signer holds it. It's false on a
+// nil *ExternalSigner.
+func (s *ExternalSigner) key(address common.Address) (accountKey, bool) {
+	if s == nil || !s.accounts[address] {
+		return nil, false
+	}
+	return externalKey{signer: s, account: address}, true
+}
+
+func (s *ExternalSigner) Addresses() []common.Address {
+	if s == nil {
+		return nil
+	}
+
+	addresses := make([]common.Address, 0, len(s.accounts))
+	for address := range s.accounts {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+type externalKey struct {
+	signer  *ExternalSigner
+	account common.Address
+}
+
+func (k externalKey) sign(tx *types.Transaction, signer types.Signer) (*types.Transaction, error) {
+	signed, err := k.signer.signer.SignTx(accounts.Account{Address: k.account}, tx, signer.ChainID())
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't trust the signer to have signed what was asked for.
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return nil, errors.New("external signer returned another tx")
+	}
+	from, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, err
+	}
+	if from != k.account {
+		return nil, fmt.Errorf("external signer signed as %s instead of %s", from, k.account)
+	}
+	return signed, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// testClef serves the account_ methods of a clef compatible signer, signing
+// every tx with key.
+type testClef struct {
+	key     *ecdsa.PrivateKey
+	account common.Address
+}
+
+func (c *testClef) Version() string {
+	return "6.0.0"
+}
+
+func (c *testClef) List() []common.Address {
+	return []common.Address{c.account}
+}
+
+type testSignResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func (c *testClef) SignTransaction(args apitypes.SendTxArgs) (*testSignResult, error) {
+	tx, err := types.SignTx(args.ToTransaction(), types.LatestSignerForChainID((*big.Int)(args.ChainID)), c.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &testSignResult{Raw: raw, Tx: tx}, nil
+}
+
+// newTestClef serves clef on an HTTP endpoint and dials it.
+func newTestClef(t *testing.T, clef *testClef) *ExternalSigner {
+	t.Helper()
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", clef); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+
+	signer, err := DialExternalSigner(httpServer.URL)
+	if err != nil {
+		t.Fatalf("DialExternalSigner: %v", err)
+	}
+	return signer
+}
+
+func TestExternalSignerSignsReplacements(t *testing.T) {
+	key, account := newTestKey(t)
+	signer := newTestClef(t, &testClef{key: key, account: account})
+	if _, ok := signer.key(testAttacker); ok {
+		t.Fatal("signer holds a key it doesn't list")
+	}
+
+	sim, _ := newSimulatedBackend(t, key)
+	backend := &recordingBackend{SimulatedBackend: sim}
+	opts := Options{BumpPercent: defaultBumpPercent, ExternalSigner: signer}
+	chain := NewChain(backend, nil, simulatedSigner(sim), testReceiverAddress, NewAccountStore(nil), opts)
+
+	chain.replacePending(context.Background(), signTestTx(t, chain.signer, key, testAttacker, 0, big.NewInt(params.Ether/2), big.NewInt(params.GWei)), time.Now())
+	sent := backend.sentTxs()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d txs, want the externally signed replacement", len(sent))
+	}
+	if from, err := types.Sender(chain.signer, sent[0]); err != nil || from != account {
+		t.Fatalf("replacement signed by %s (%v), want %s", from, err, account)
+	}
+}
+
+func TestExternalSignerRejectsOtherSigners(t *testing.T) {
+	_, account := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+	signer := newTestClef(t, &testClef{key: otherKey, account: account})
+
+	key, _ := signer.key(account)
+	ethSigner := types.LatestSignerForChainID(big.NewInt(1337))
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1337), To: &testReceiverAddress, Gas: 21000, GasFeeCap: big.NewInt(params.GWei), GasTipCap: big.NewInt(params.GWei)})
+	if _, err := key.sign(tx, ethSigner); err == nil {
+		t.Fatal("sign() accepted a tx signed by another account")
+	}
+}
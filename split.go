@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WeightedReceiver gets Weight parts of every balance sweep split between
+// several receivers.
+type WeightedReceiver struct {
+	Address common.Address `json:"address"`
+	Weight  uint64         `json:"weight"`
+}
+
+func validateSplit(receivers []WeightedReceiver) error {
+	seen := make(map[common.Address]bool, len(receivers))
+	total := new(big.Int)
+	for _, receiver := range receivers {
+		if receiver.Address == (common.Address{}) {
+			return ErrNoReceiver
+		}
+		if receiver.Weight == 0 {
+			return fmt.Errorf("receiver %s has no weight", receiver.Address)
+		}
+		if seen[receiver.Address] {
+			return fmt.Errorf("receiver %s is listed twice", receiver.Address)
+		}
+		seen[receiver.Address] = true
+		total.Add(total, new(big.Int).SetUint64(receiver.Weight))
+	}
+	if !total.IsUint64() {
+		return errors.New("receiver weights overflow")
+	}
+	return nil
+}
+
+// heaviest returns the receiver with the highest weight, the first one listed
+// on a tie. It's where single-nonce replacements go.
+func heaviest(receivers []WeightedReceiver) common.Address {
+	var best WeightedReceiver
+	for _, receiver := range receivers {
+		if receiver.Weight > best.Weight {
+			best = receiver
+		}
+	}
+	return best.Address
+}
+
+// splitValue divides value between receivers by weight. Rounding leftovers
+// go to the first receiver so the shares always add up to value.
+func splitValue(value *big.Int, receivers []WeightedReceiver) []*big.Int {
+	total := new(big.Int)
+	for _, receiver := range receivers {
+		total.Add(total, new(big.Int).SetUint64(receiver.Weight))
+	}
+
+	shares := make([]*big.Int, len(receivers))
+	remaining := new(big.Int).Set(value)
+	for i, receiver := range receivers {
+		share := new(big.Int).Mul(value, new(big.Int).SetUint64(receiver.Weight))
+		shares[i] = share.Div(share, total)
+		remaining.Sub(remaining, shares[i])
+	}
+	shares[0].Add(shares[0], remaining)
+	return shares
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	testHotReceiver  = common.HexToAddress("0x3333333333333333333333333333333333333333")
+	testColdReceiver = common.HexToAddress("0x4444444444444444444444444444444444444444")
+)
+
+func TestSplitValue(t *testing.T) {
+	tests := []struct {
+		value   int64
+		weights []uint64
+		want    []int64
+	}{
+		{100, []uint64{1}, []int64{100}},
+		{100, []uint64{1, 1}, []int64{50, 50}},
+		{100, []uint64{1, 3}, []int64{25, 75}},
+		// The rounding leftover goes to the first receiver.
+		{100, []uint64{1, 1, 1}, []int64{34, 33, 33}},
+		{1, []uint64{1, 1}, []int64{1, 0}},
+	}
+	for _, tt := range tests {
+		receivers := make([]WeightedReceiver, len(tt.weights))
+		for i, weight := range tt.weights {
+			receivers[i] = WeightedReceiver{Address: common.BigToAddress(big.NewInt(int64(i + 1))), Weight: weight}
+		}
+
+		shares := splitValue(big.NewInt(tt.value), receivers)
+		for i, share := range shares {
+			if share.Int64() != tt.want[i] {
+				t.Errorf("splitValue(%d, %v) = %v, want %v", tt.value, tt.weights, shares, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHeaviest(t *testing.T) {
+	receivers := []WeightedReceiver{{testHotReceiver, 1}, {testColdReceiver, 3}}
+	if got := heaviest(receivers); got != testColdReceiver {
+		t.Fatalf("heaviest() = %s, want %s", got, testColdReceiver)
+	}
+	// Ties go to the first listed.
+	receivers[0].Weight = 3
+	if got := heaviest(receivers); got != testHotReceiver {
+		t.Fatalf("heaviest() of a tie = %s, want %s", got, testHotReceiver)
+	}
+}
+
+func TestValidateSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		receivers []WeightedReceiver
+		valid     bool
+	}{
+		{"valid", []WeightedReceiver{{testHotReceiver, 1}, {testColdReceiver, 3}}, true},
+		{"no address", []WeightedReceiver{{common.Address{}, 1}}, false},
+		{"no weight", []WeightedReceiver{{testHotReceiver, 0}}, false},
+		{"listed twice", []WeightedReceiver{{testHotReceiver, 1}, {testHotReceiver, 1}}, false},
+		{"overflow", []WeightedReceiver{{testHotReceiver, 1 << 63}, {testColdReceiver, 1 << 63}}, false},
+	}
+	for _, test := range tests {
+		if err := validateSplit(test.receivers); (err == nil) != test.valid {
+			t.Errorf("%s: validateSplit() = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestSweepNativeSplitsBetweenReceivers(t *testing.T) {
+	key, account := newTestKey(t)
+	receivers := []WeightedReceiver{{testHotReceiver, 1}, {testColdReceiver, 3}}
+	chain, backend := newRecordingChain(t, Options{SplitReceivers: receivers}, key)
+
+	if _, err := chain.sweepNative(context.Background(), account); err != nil {
+		t.Fatal(err)
+	}
+	sent := backend.sentTxs()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d txs, want one to each receiver", len(sent))
+	}
+	if *sent[0].To() != testHotReceiver || *sent[1].To() != testColdReceiver || sent[1].Nonce() != sent[0].Nonce()+1 {
+		t.Fatalf("sweeps = %s at %d and %s at %d, want both receivers at consecutive nonces", sent[0].To(), sent[0].Nonce(), sent[1].To(), sent[1].Nonce())
+	}
+	// 1:3 give or take the rounding.
+	if threefold := new(big.Int).Mul(sent[0].Value(), big.NewInt(3)); new(big.Int).Sub(sent[1].Value(), threefold).CmpAbs(big.NewInt(3)) > 0 {
+		t.Fatalf("sweep values = %s and %s, want them split 1:3", sent[0].Value(), sent[1].Value())
+	}
+}
+
+func TestSplitReceiversConfig(t *testing.T) {
+	_, err := loadTestConfig(t, `"split_receivers": [{"address": "`+testHotReceiver.Hex()+`", "weight": 1}, {"address": "`+testColdReceiver.Hex()+`", "weight": 3}]`)
+	if err == nil {
+		t.Fatal("LoadConfig() accepted both receiver and split_receivers")
+	}
+
+	// Single-nonce replacements go to the heaviest receiver.
+	config := Config{SplitReceivers: []WeightedReceiver{{testHotReceiver, 1}, {testColdReceiver, 3}}}
+	if got := config.receiverFor(ChainConfig{}); got != testColdReceiver {
+		t.Fatalf("receiverFor() = %s, want the heaviest %s", got, testColdReceiver)
+	}
+	// A chain's own receiver takes every sweep.
+	if split := config.splitFor(ChainConfig{Receiver: &testHotReceiver}); split != nil {
+		t.Fatalf("splitFor() = %v, want nil for a chain with a receiver", split)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const stateSaveInterval = 30 * time.Second
+
+// chainState is what's persisted for one chain: the next nonce of every
+// account we've sent from, the pending tx hashes already handled and what
+// was rescued from each account.
+type chainState struct {
+	Nonces map[common.Address]uint64       `json:"nonces"`
+	Seen   []common.Hash                   `json:"seen"`
+	Stats  map[common.Address]accountTally `json:"stats,omitempty"`
+}
+
+// StateStore persists chain state to a file so a restart doesn't replace the
+// same pending txs again or reuse nonces the node hasn't caught up on.
+type StateStore struct {
+	path string
+
+	mu     sync.Mutex
+	saved  map[string]chainState
+	chains map[string]*Chain
+}
+
+// LoadState reads the state saved at path. A missing file is an empty state.
+func LoadState(path string) (*StateStore, error) {
+	store := &StateStore{path: path, saved: make(map[string]chainState), chains: make(map[string]*Chain)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.saved); err != nil {
+		return nil, fmt.Errorf("couldn't decode state: %w", err)
+	}
+	return store, nil
+}
+
+// restore seeds chain with what was saved under name and keeps track of it
+// for the next save. It's a no-op on a nil *StateStore.
+func (s *StateStore) restore(name string, chain *Chain) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if saved, ok := s.saved[name]; ok {
+		chain.nonces.restore(saved.Nonces)
+		for _, hash := range saved.Seen {
+			chain.seen.Add(hash, struct{}{})
+		}
+		chain.opts.Stats.restore(name, saved.Stats)
+	}
+	s.chains[name] = chain
+}
+
+// Save writes the current state of every chain, replacing the file
+// atomically.
+func (s *StateStore) Save() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	for name, chain := range s.chains {
+		s.saved[name] = chainState{Nonces: chain.nonces.snapshot(), Seen: chain.seen.Keys(), Stats: chain.opts.Stats.chain(name)}
+	}
+	data, err := json.Marshal(s.saved)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Persist saves the state every stateSaveInterval until ctx is cancelled.
+func (s *StateStore) Persist(ctx context.Context) {
+	ticker := time.NewTicker(stateSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				slog.Error("couldn't save state", "path", s.path, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func newStateTestChain() *Chain {
+	return NewChain(nil, nil, types.LatestSignerForChainID(big.NewInt(1)), testReceiverAddress, NewAccountStore(nil), Options{})
+}
+
+func TestStateRoundTrips(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	account := common.HexToAddress("0x01")
+	hash := common.HexToHash("0x02")
+
+	store, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() of a missing file = %v, want an empty state", err)
+	}
+	chain := newStateTestChain()
+	store.restore("mainnet", chain)
+	chain.nonces.used(account, types.NewTx(&types.LegacyTx{Nonce: 6}))
+	chain.seen.Add(hash, struct{}{})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming from the saved file.
+	store, err = LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := newStateTestChain()
+	store.restore("mainnet", resumed)
+	if next, ok := resumed.nonces.lookup(account); !ok || next != 7 {
+		t.Fatalf("restored next nonce = %d, %v, want 7, true", next, ok)
+	}
+	if _, ok := resumed.seen.Get(hash); !ok {
+		t.Fatal("restored chain forgot the handled hash")
+	}
+
+	// Other chains start fresh.
+	other := newStateTestChain()
+	store.restore("sepolia", other)
+	if _, ok := other.nonces.lookup(account); ok {
+		t.Fatal("state of another chain was restored")
+	}
+}
+
+func TestStateSaveReplacesFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	store, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.restore("mainnet", newStateTestChain())
+
+	for i := 0; i < 2; i++ {
+		if err := store.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Fatalf("state dir holds %v, want only state.json", entries)
+	}
+}
+
+func TestLoadStateRejectsCorruptFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(path); err == nil {
+		t.Fatal("LoadState() accepted a corrupt file")
+	}
+}
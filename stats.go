@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// accountTally is what was rescued from one account on one chain, amounts
+// in wei or token units as decimal strings.
+type accountTally struct {
+	Sweeps int                       `json:"sweeps"`
+	Native string                    `json:"native"`
+	Tokens map[common.Address]string `json:"tokens,omitempty"`
+}
+
+type tally struct {
+	sweeps int
+	native *big.Int
+	tokens map[common.Address]*big.Int
+}
+
+// Stats tallies confirmed sweeps and replacements per chain and account. A
+// nil *Stats tallies nothing.
+type Stats struct {
+	mu     sync.Mutex
+	chains map[string]map[common.Address]*tally
+}
+
+func NewStats() *Stats {
+	return &Stats{chains: make(map[string]map[common.Address]*tally)}
+}
+
+// confirmed adds tx, mined successfully from account, to the tally of chain.
+// ERC-20 transfers count towards their token, cancels aren't counted.
+func (s *Stats) confirmed(chain string, account common.Address, tx *types.Transaction) {
+	if s == nil || tx.To() == nil || *tx.To() == account {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.tallyOf(chain, account)
+	t.sweeps++
+	t.native.Add(t.native, tx.Value())
+	if data := tx.Data(); len(data) == 4+64 && bytes.Equal(data[:4], transferSelector) {
+		token := *tx.To()
+		if t.tokens[token] == nil {
+			t.tokens[token] = new(big.Int)
+		}
+		t.tokens[token].Add(t.tokens[token], new(big.Int).SetBytes(wordArg(data[4:], 1)))
+	}
+}
+
+func (s *Stats) tallyOf(chain string, account common.Address) *tally {
+	accounts, ok := s.chains[chain]
+	if !ok {
+		accounts = make(map[common.Address]*tally)
+		s.chains[chain] = accounts
+	}
+	t, ok := accounts[account]
+	if !ok {
+		t = &tally{native: new(big.Int), tokens: make(map[common.Address]*big.Int)}
+		accounts[account] = t
+	}
+	return t
+}
+
+// chain returns the tally of chain by account.
+func (s *Stats) chain(name string) map[common.Address]accountTally {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshot(name)
+}
+
+func (s *Stats) snapshot(name string) map[common.Address]accountTally {
+	accounts := make(map[common.Address]accountTally, len(s.chains[name]))
+	for account, t := range s.chains[name] {
+		tokens := make(map[common.Address]string, len(t.tokens))
+		for token, amount := range t.tokens {
+			tokens[token] = amount.String()
+		}
+		accounts[account] = accountTally{Sweeps: t.sweeps, Native: t.native.String(), Tokens: tokens}
+	}
+	return accounts
+}
+
+// restore seeds the tally of chain with saved unless it's tallied already,
+// e.g. when a chain reconnects.
+func (s *Stats) restore(name string, saved map[common.Address]accountTally) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chains[name]; ok {
+		return
+	}
+	accounts := make(map[common.Address]*tally, len(saved))
+	for account, saved := range saved {
+		t := &tally{sweeps: saved.Sweeps, native: decimal(saved.Native), tokens: make(map[common.Address]*big.Int, len(saved.Tokens))}
+		for token, amount := range saved.Tokens {
+			t.tokens[token] = decimal(amount)
+		}
+		accounts[account] = t
+	}
+	s.chains[name] = accounts
+}
+
+// decimal parses a saved amount, a corrupted one counts as zero.
+func decimal(amount string) *big.Int {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return value
+}
+
+// ServeHTTP writes the tally of every chain as JSON.
+func (s *Stats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	chains := make(map[string]map[common.Address]accountTally, len(s.chains))
+	for name := range s.chains {
+		chains[name] = s.snapshot(name)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chains)
+}
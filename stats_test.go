@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestStatsTallyConfirmedSweepsOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     uint64
+		wantSweeps int
+	}{
+		{"mined", types.ReceiptStatusSuccessful, 1},
+		{"reverted", types.ReceiptStatusFailed, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, backend, _, replacementTx := newConfirmingChain(t, 5)
+			stats := NewStats()
+			chain.opts.Stats = stats
+			account := chain.addresses()[0]
+			ctx := context.Background()
+
+			// Broadcast isn't rescued yet.
+			chain.checkConfirmations(ctx, 10)
+			chain.checkConfirmations(ctx, 11)
+			if tally := stats.chain("sim"); len(tally) != 0 {
+				t.Fatalf("tally = %v before the replacement was mined, want none", tally)
+			}
+
+			backend.mine(replacementTx, test.status, 12)
+			chain.checkConfirmations(ctx, 12)
+			tally := stats.chain("sim")[account]
+			if tally.Sweeps != test.wantSweeps {
+				t.Fatalf("sweeps = %d, want %d", tally.Sweeps, test.wantSweeps)
+			}
+			if test.wantSweeps > 0 && tally.Native != replacementTx.Value().String() {
+				t.Fatalf("native rescued = %s, want %s", tally.Native, replacementTx.Value())
+			}
+		})
+	}
+}
+
+func TestStatsConfirmed(t *testing.T) {
+	stats := NewStats()
+	account := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	sweep := types.NewTx(&types.LegacyTx{To: &testReceiverAddress, Value: big.NewInt(100)})
+	rescue := types.NewTx(&types.LegacyTx{To: &testToken, Data: transferData(testReceiverAddress, big.NewInt(7))})
+	cancel := types.NewTx(&types.LegacyTx{To: &account})
+
+	for _, tx := range []*types.Transaction{sweep, sweep, rescue, rescue, cancel} {
+		stats.confirmed("mainnet", account, tx)
+	}
+	tally := stats.chain("mainnet")[account]
+	if tally.Sweeps != 4 || tally.Native != "200" || tally.Tokens[testToken] != "14" {
+		t.Fatalf("tally = %+v, want 4 sweeps of 200 wei and 14 tokens", tally)
+	}
+
+	var nilStats *Stats
+	nilStats.confirmed("mainnet", account, sweep)
+	if tally := nilStats.chain("mainnet"); tally != nil {
+		t.Fatalf("nil Stats tallied %v", tally)
+	}
+}
+
+func TestStatsServeHTTP(t *testing.T) {
+	stats := NewStats()
+	stats.restore("mainnet", map[common.Address]accountTally{testAttacker: {Sweeps: 2, Native: "50", Tokens: map[common.Address]string{testToken: "corrupted"}}})
+	// Restoring a tallied chain keeps its tally.
+	stats.restore("mainnet", map[common.Address]accountTally{testAttacker: {Sweeps: 9, Native: "1"}})
+
+	w := httptest.NewRecorder()
+	stats.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var chains map[string]map[common.Address]accountTally
+	if err := json.NewDecoder(w.Body).Decode(&chains); err != nil {
+		t.Fatal(err)
+	}
+	tally := chains["mainnet"][testAttacker]
+	if tally.Sweeps != 2 || tally.Native != "50" || tally.Tokens[testToken] != "0" {
+		t.Fatalf("GET /stats = %+v, want the first restored tally", chains)
+	}
+}
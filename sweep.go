@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	defaultPollInterval = 15 * time.Second
+	transferGas         = 21000
+)
+
+// SweepOnBalance polls the native balance of every account and sweeps it to
+// the receiver. It's the fallback for providers without pending-tx
+// subscriptions.
+func (c *Chain) SweepOnBalance(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// There's no subscription to lose, the poller counts as connected while
+	// it runs.
+	c.health.setConnected(true)
+	defer c.health.setConnected(false)
+
+	for {
+		c.health.event()
+		for _, account := range c.addresses() {
+			if _, err := c.sweepNative(ctx, account); err != nil {
+				c.log.Warn("couldn't sweep balance", "from", account, "err", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepReceivers returns the receivers a balance sweep of account is split
+// between, a single one unless SplitReceivers applies.
+func (c *Chain) sweepReceivers(account common.Address) []WeightedReceiver {
+	if _, ok := c.opts.Receivers[account]; ok || len(c.opts.SplitReceivers) == 0 {
+		return []WeightedReceiver{{Address: *c.receiverFor(account), Weight: 1}}
+	}
+	return c.opts.SplitReceivers
+}
+
+// sweepNative sends the native balance of account to its receivers and
+// returns the broadcast sweeps.
+func (c *Chain) sweepNative(ctx context.Context, account common.Address) (sent []*types.Transaction, err error) {
+	key, ok := c.sweepKeyFor(account)
+	if !ok {
+		return nil, nil
+	}
+
+	balance, err := c.balanceAt(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get balance: %w", err)
+	}
+	if balance.Sign() == 0 {
+		c.dust.take(account)
+		return nil, nil
+	}
+
+	gasPrice, err := c.suggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get gas price: %w", err)
+	}
+
+	// Every sweep tx pays its own fee, a balance that can't cover all of
+	// them is left as dust until later polls find enough of it.
+	receivers := c.sweepReceivers(account)
+	gas, err := c.sweepGas(ctx, account, receivers[0].Address, balance)
+	if err != nil {
+		return nil, err
+	}
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	value := new(big.Int).Sub(balance, new(big.Int).Mul(fee, big.NewInt(int64(len(receivers)))))
+	if value.Sign() <= 0 || (c.opts.MinSweep != nil && value.Cmp(c.opts.MinSweep) < 0) {
+		if c.dust.left(account, balance) {
+			c.log.Debug("balance below sweep threshold, leaving it to accumulate", "from", account, "balance", balance, "fee", fee)
+		}
+		return nil, nil
+	}
+	if dust := c.dust.take(account); dust != nil {
+		c.log.Info("accumulated dust is sweepable", "from", account, "dust", dust, "balance", balance)
+	}
+
+	unlock := c.lockAccount(account)
+	defer unlock()
+
+	nonce, err := c.nextNonce(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get nonce: %w", err)
+	}
+
+	for i, share := range splitValue(value, receivers) {
+		if share.Sign() == 0 {
+			continue
+		}
+		receiver := receivers[i].Address
+
+		signedTx, err := key.sign(types.NewTx(&types.LegacyTx{
+			To:       &receiver,
+			Value:    share,
+			Gas:      gas,
+			GasPrice: gasPrice,
+			Nonce:    nonce,
+			Data:     c.opts.ReceiverData,
+		}), c.signer)
+		if err != nil {
+			return sent, fmt.Errorf("couldn't sign sweep: %w", err)
+		}
+
+		if c.opts.DryRun {
+			c.log.Info("[DRY-RUN] would sweep balance", "from", account, "receiver", receiver, "value", share, "replacement_tx", signedTx.Hash())
+			nonce++
+			continue
+		}
+
+		if err = c.sendTransaction(ctx, signedTx); err != nil {
+			c.nonces.forget(account)
+			return sent, fmt.Errorf("couldn't send sweep: %w", err)
+		}
+		c.nonces.used(account, signedTx)
+		nonce++
+		c.confirmations.watch(account, signedTx)
+		c.swept(account, &receiver, nil, signedTx)
+		sent = append(sent, signedTx)
+
+		c.log.Info("swept balance", "from", account, "receiver", receiver, "replacement_tx", signedTx.Hash(), "value", share, "gas_price", signedTx.GasPrice())
+	}
+	return sent, nil
+}
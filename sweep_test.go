@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSweepNative(t *testing.T) {
+	key, account := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{}, key)
+	ctx := context.Background()
+
+	sent, err := chain.sweepNative(ctx, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("sweepNative() sent %d txs, want 1", len(sent))
+	}
+	sim.Commit()
+
+	// The whole balance but the fee ends up with the receiver.
+	fee := new(big.Int).Mul(sent[0].GasPrice(), big.NewInt(transferGas))
+	want := new(big.Int).Sub(big.NewInt(params.Ether), fee)
+	if received, _ := sim.BalanceAt(ctx, testReceiverAddress, nil); received.Cmp(want) != 0 {
+		t.Fatalf("receiver balance = %s, want %s", received, want)
+	}
+	if left, _ := sim.BalanceAt(ctx, account, nil); left.Sign() != 0 {
+		t.Fatalf("account balance = %s, want 0", left)
+	}
+
+	// Nothing is left to sweep.
+	if sent, err := chain.sweepNative(ctx, account); err != nil || len(sent) != 0 {
+		t.Fatalf("second sweepNative() = %d txs, %v, want none", len(sent), err)
+	}
+}
+
+func TestSweepNativeSkipsUnknownAccounts(t *testing.T) {
+	key, _ := newTestKey(t)
+	chain, _ := newSimulatedChain(t, Options{}, key)
+
+	if sent, err := chain.sweepNative(context.Background(), testAttacker); err != nil || len(sent) != 0 {
+		t.Fatalf("sweepNative() of an account without key = %d txs, %v, want none", len(sent), err)
+	}
+}
+
+func TestSweepNativeWaitsForDustToAccumulate(t *testing.T) {
+	key, account := newTestKey(t)
+	funderKey, _ := newTestKey(t)
+	chain, sim := newSimulatedChain(t, Options{}, key, funderKey)
+	ctx := context.Background()
+
+	if _, err := chain.sweepNative(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+	sim.Commit()
+
+	// fund sends account value from funderKey.
+	nonce := uint64(0)
+	fund := func(value int64) {
+		t.Helper()
+		if err := sim.SendTransaction(ctx, signTestTx(t, chain.signer, funderKey, account, nonce, big.NewInt(value), big.NewInt(10*params.GWei))); err != nil {
+			t.Fatal(err)
+		}
+		nonce++
+		sim.Commit()
+	}
+
+	// Dust that can't pay for its own sweep is left behind.
+	fund(1000)
+	if sent, err := chain.sweepNative(ctx, account); err != nil || len(sent) != 0 {
+		t.Fatalf("sweepNative() of dust = %d txs, %v, want none", len(sent), err)
+	}
+	if dust := chain.dust.balances[account]; dust == nil || dust.Int64() != 1000 {
+		t.Fatalf("tracked dust = %v, want 1000", dust)
+	}
+
+	// Once it accumulates it's swept along.
+	fund(params.Ether / 10)
+	sent, err := chain.sweepNative(ctx, account)
+	if err != nil || len(sent) != 1 {
+		t.Fatalf("sweepNative() = %d txs, %v, want the accumulated balance swept", len(sent), err)
+	}
+	fee := new(big.Int).Mul(sent[0].GasPrice(), new(big.Int).SetUint64(sent[0].Gas()))
+	if want := new(big.Int).Sub(big.NewInt(params.Ether/10+1000), fee); sent[0].Value().Cmp(want) != 0 {
+		t.Fatalf("swept %s, want %s", sent[0].Value(), want)
+	}
+	if dust := chain.dust.take(account); dust != nil {
+		t.Fatalf("dust %s is still tracked after the sweep", dust)
+	}
+}
+
+func TestSweepNativeAttachesReceiverData(t *testing.T) {
+	key, account := newTestKey(t)
+	data := common.FromHex("0xd0e30db0")
+	chain, backend := newEstimatingChain(t, Options{ReceiverData: data}, 40_000, nil, key)
+
+	sent, err := chain.sweepNative(context.Background(), account)
+	if err != nil || len(sent) != 1 {
+		t.Fatalf("sweepNative() = %d txs, %v, want 1", len(sent), err)
+	}
+	if got := backend.sentTxs()[0]; !bytes.Equal(got.Data(), data) || got.Gas() != 48_000 {
+		t.Fatalf("sweep data %x gas %d, want %x with the estimate's headroom", got.Data(), got.Gas(), data)
+	}
+
+	// A sweep whose gas can't be estimated isn't sent.
+	backend.err = errors.New("execution reverted")
+	if _, err := chain.sweepNative(context.Background(), account); err == nil {
+		t.Fatal("sweepNative() succeeded without a gas estimate")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// webhookQueueSize is how many sweeps may wait for delivery before new ones
+// are dropped.
+const webhookQueueSize = 256
+
+// SweepEvent is the payload POSTed to the webhook after a successful sweep.
+// OrigTx is empty for sweeps that weren't triggered by a transaction.
+type SweepEvent struct {
+	Chain         string         `json:"chain"`
+	From          common.Address `json:"from"`
+	Receiver      common.Address `json:"receiver"`
+	OrigTx        *common.Hash   `json:"orig_tx,omitempty"`
+	ReplacementTx common.Hash    `json:"replacement_tx"`
+	Value         string         `json:"value"`
+}
+
+// Webhook POSTs a SweepEvent after every sweep, other events are ignored.
+// Sweeps are delivered one at a time from a queue, each retried with backoff.
+type Webhook struct {
+	url     string
+	client  *http.Client
+	retries int
+	queue   chan Event
+}
+
+// NewWebhook starts delivering to url, each POST bounded by timeout and
+// retried up to retries times. Zero ones mean the defaults of the other
+// notifiers.
+func NewWebhook(url string, timeout time.Duration, retries int) *Webhook {
+	if timeout <= 0 {
+		timeout = notifyTimeout
+	}
+	if retries <= 0 {
+		retries = notifyAttempts - 1
+	}
+
+	w := &Webhook{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		queue:   make(chan Event, webhookQueueSize),
+	}
+	go w.run()
+	return w
+}
+
+// Notify queues event without blocking, so it never stalls a scanner. It's
+// dropped when the queue is full.
+func (w *Webhook) Notify(event Event) {
+	if event.Sweep == nil {
+		return
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		slog.Warn("webhook queue full, dropping event", "event", event.Kind, "chain", event.Chain, "replacement_tx", event.Sweep.ReplacementTx)
+	}
+}
+
+func (w *Webhook) run() {
+	for event := range w.queue {
+		err := retryPost(w.retries+1, notifyRetryDelay, func() error {
+			return postJSON(w.client, w.url, event.Sweep)
+		})
+		if err != nil {
+			slog.Warn("couldn't notify webhook", "event", event.Kind, "replacement_tx", event.Sweep.ReplacementTx, "err", err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testHook records the bodies POSTed to it, failing the first fail of them.
+type testHook struct {
+	fail   int
+	bodies chan []byte
+}
+
+func newTestHook(t *testing.T, fail int) (*testHook, string) {
+	t.Helper()
+
+	hook := &testHook{fail: fail, bodies: make(chan []byte, 16)}
+	server := httptest.NewServer(hook)
+	t.Cleanup(server.Close)
+	return hook, server.URL
+}
+
+func (h *testHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	json.NewDecoder(r.Body).Decode(&body)
+	if h.fail > 0 {
+		h.fail--
+		http.Error(w, "try again", http.StatusBadGateway)
+		return
+	}
+	h.bodies <- body
+}
+
+// next waits for the next delivered body.
+func (h *testHook) next(t *testing.T) []byte {
+	t.Helper()
+
+	select {
+	case body := <-h.bodies:
+		return body
+	case <-time.After(10 * time.Second):
+		t.Fatal("nothing delivered")
+		return nil
+	}
+}
+
+func testSweepEvent() Event {
+	origTx := common.HexToHash("0x01")
+	return Event{
+		Kind:     EventSweep,
+		Severity: SeverityInfo,
+		Chain:    "mainnet",
+		Message:  "swept",
+		Sweep: &SweepEvent{
+			Chain:         "mainnet",
+			From:          testAttacker,
+			Receiver:      testReceiverAddress,
+			OrigTx:        &origTx,
+			ReplacementTx: common.HexToHash("0x02"),
+			Value:         "1000",
+		},
+	}
+}
+
+func TestWebhookPostsSweeps(t *testing.T) {
+	hook, url := newTestHook(t, 0)
+	webhook := NewWebhook(url, 0, 0)
+
+	// Only sweeps are posted.
+	webhook.Notify(Event{Kind: EventSubscriptionLost, Severity: SeverityWarning, Chain: "mainnet"})
+	event := testSweepEvent()
+	webhook.Notify(event)
+
+	var got SweepEvent
+	if err := json.Unmarshal(hook.next(t), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ReplacementTx != event.Sweep.ReplacementTx || got.From != event.Sweep.From || got.Value != event.Sweep.Value || *got.OrigTx != *event.Sweep.OrigTx {
+		t.Fatalf("posted %+v, want %+v", got, *event.Sweep)
+	}
+	select {
+	case body := <-hook.bodies:
+		t.Fatalf("posted %s too, want only the sweep", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetriesFailedPosts(t *testing.T) {
+	hook, url := newTestHook(t, 1)
+	webhook := NewWebhook(url, 0, 1)
+
+	webhook.Notify(testSweepEvent())
+	var got SweepEvent
+	if err := json.Unmarshal(hook.next(t), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ReplacementTx != testSweepEvent().Sweep.ReplacementTx {
+		t.Fatalf("posted %+v, want the retried sweep", got)
+	}
+}
+
+func TestNewWebhookSettings(t *testing.T) {
+	tests := []struct {
+		timeout     time.Duration
+		retries     int
+		wantTimeout time.Duration
+		wantRetries int
+	}{
+		{0, 0, notifyTimeout, notifyAttempts - 1},
+		{time.Second, 5, time.Second, 5},
+	}
+	for _, test := range tests {
+		webhook := NewWebhook("http://127.0.0.1:1", test.timeout, test.retries)
+		if webhook.client.Timeout != test.wantTimeout || webhook.retries != test.wantRetries {
+			t.Errorf("NewWebhook(%v, %d) = timeout %v, %d retries, want %v, %d", test.timeout, test.retries, webhook.client.Timeout, webhook.retries, test.wantTimeout, test.wantRetries)
+		}
+		close(webhook.queue)
+	}
+}
+
+func TestWebhookDropsEventsWhenQueueIsFull(t *testing.T) {
+	logs := captureLogs(t)
+	// Not delivering, so the queue fills up.
+	webhook := &Webhook{queue: make(chan Event, 1)}
+
+	done := make(chan struct{})
+	go func() {
+		webhook.Notify(testSweepEvent())
+		webhook.Notify(testSweepEvent())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify blocked on a full queue")
+	}
+
+	if len(webhook.queue) != 1 || !strings.Contains(logs.String(), "webhook queue full") {
+		t.Fatalf("queued %d events, logs %s, want one queued and one dropped", len(webhook.queue), logs)
+	}
+}